@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -14,6 +15,7 @@ import (
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/mux"
 
 	"authentication/internal/config"
@@ -21,6 +23,7 @@ import (
 	"authentication/internal/handlers"
 	"authentication/internal/repository"
 	"authentication/internal/service"
+	"navik-backend/pkg/redisclient"
 )
 
 func main() {
@@ -63,11 +66,17 @@ func main() {
 
 	userRepo := repository.NewUserRepository(dynamoClient, cfg.DynamoDBTableName)
 
-	redisConfig := service.RedisConfig{
-		Addr:     "redis:6379",
-		Password: "",
-		DB:       0,
-		Enabled:  true,
+	var redisClient redis.UniversalClient
+	if cfg.RedisEnabled {
+		if err := cfg.Redis.Validate(); err != nil {
+			log.Fatalf("invalid redis config: %v", err)
+		}
+		redisClient, err = redisclient.New(context.Background(), cfg.Redis)
+		if err != nil {
+			log.Printf("Warning: %v, continuing without caching", err)
+		} else {
+			defer redisClient.Close()
+		}
 	}
 
 	// Initialize services
@@ -79,7 +88,7 @@ func main() {
 		Issuer:              cfg.JWTIssuer,
 		AccessTokenCacheTTL: 60 * 2,
 	}
-	authService := service.NewAuthService(userRepo, jwtConfig, redisConfig)
+	authService := service.NewAuthService(userRepo, jwtConfig, redisClient)
 
 	profileService := service.NewProfileService(userRepo)
 
@@ -90,6 +99,26 @@ func main() {
 	// Create router
 	router := mux.NewRouter()
 
+	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		// Without Redis, tokens are neither cached nor revocable, so a failed
+		// connection is unhealthy while a disabled cache is not
+		var health redisclient.Health
+		switch {
+		case !cfg.RedisEnabled:
+			health.Status = "disabled"
+		case redisClient == nil:
+			health = redisclient.Health{Status: redisclient.StatusDown, Error: "not connected"}
+		default:
+			health = redisclient.Check(r.Context(), redisClient)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if health.Status == redisclient.StatusDown {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"redis": health})
+	}).Methods("GET")
+
 	// Public routes
 	router.HandleFunc("/api/auth/register", authHandler.Register).Methods("POST")
 	router.HandleFunc("/api/auth/login", authHandler.Login).Methods("POST")
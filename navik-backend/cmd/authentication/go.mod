@@ -15,6 +15,7 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/mux v1.8.1
 	golang.org/x/crypto v0.36.0
+	navik-backend/pkg/redisclient v0.0.0-00010101000000-000000000000
 )
 
 require (
@@ -40,3 +41,5 @@ require (
 	golang.org/x/sys v0.31.0 // indirect
 	golang.org/x/text v0.23.0 // indirect
 )
+
+replace navik-backend/pkg/redisclient => ../../pkg/redisclient
@@ -3,7 +3,10 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"navik-backend/pkg/redisclient"
 )
 
 type Config struct {
@@ -20,11 +23,38 @@ type Config struct {
 	JWTAccessExpiry  time.Duration
 	JWTRefreshExpiry time.Duration
 	JWTIssuer        string
+
+	RedisEnabled bool
+	Redis        redisclient.Config
 }
 
 func LoadConfig() *Config {
 	accessExpiry, _ := strconv.Atoi(getEnv("JWT_ACCESS_EXPIRY_MINUTES", "15"))
 	refreshExpiry, _ := strconv.Atoi(getEnv("JWT_REFRESH_EXPIRY_DAYS", "7"))
+	redisDB, _ := strconv.Atoi(getEnv("REDIS_DB", "0"))
+	redisPoolSize, _ := strconv.Atoi(getEnv("REDIS_POOL_SIZE", "0"))
+	redisMinIdleConns, _ := strconv.Atoi(getEnv("REDIS_MIN_IDLE_CONNS", "0"))
+	redisConnectAttempts, _ := strconv.Atoi(getEnv("REDIS_CONNECT_ATTEMPTS", "0"))
+
+	redisConfig := redisclient.Config{
+		Mode:             getEnv("REDIS_MODE", redisclient.ModeStandalone),
+		Addrs:            strings.Split(getEnv("REDIS_ADDRS", "redis:6379"), ","),
+		MasterName:       os.Getenv("REDIS_MASTER_NAME"),
+		Username:         os.Getenv("REDIS_USERNAME"),
+		Password:         os.Getenv("REDIS_PASSWORD"),
+		SentinelPassword: os.Getenv("REDIS_SENTINEL_PASSWORD"),
+		DB:               redisDB,
+		TLS: redisclient.TLSConfig{
+			Enabled:            getEnv("REDIS_TLS_ENABLED", "false") == "true",
+			ServerName:         os.Getenv("REDIS_TLS_SERVER_NAME"),
+			CAFile:             os.Getenv("REDIS_TLS_CA_FILE"),
+			InsecureSkipVerify: getEnv("REDIS_TLS_INSECURE_SKIP_VERIFY", "false") == "true",
+		},
+		PoolSize:        redisPoolSize,
+		MinIdleConns:    redisMinIdleConns,
+		ConnectAttempts: redisConnectAttempts,
+	}
+	redisConfig.SetDefaults()
 
 	return &Config{
 		ServerPort: getEnv("SERVER_PORT", "8080"),
@@ -40,6 +70,9 @@ func LoadConfig() *Config {
 		JWTAccessExpiry:  time.Duration(accessExpiry) * time.Minute,
 		JWTRefreshExpiry: time.Duration(refreshExpiry) * 24 * time.Hour,
 		JWTIssuer:        getEnv("JWT_ISSUER", "auth-service"),
+
+		RedisEnabled: getEnv("REDIS_ENABLED", "true") == "true",
+		Redis:        redisConfig,
 	}
 }
 
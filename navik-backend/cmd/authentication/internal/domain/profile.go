@@ -22,6 +22,9 @@ type DriverProfileResponse struct {
 	VehicleInfo   string `json:"vehicle_info,omitempty"`
 	IsVerified    bool   `json:"is_verified"`
 	CreatedAt     string `json:"created_at"`
+
+	Gender       string              `json:"gender,omitempty"`
+	Capabilities VehicleCapabilities `json:"capabilities"`
 }
 
 type CustomerProfileUpdate struct {
@@ -38,4 +41,8 @@ type DriverProfileUpdate struct {
 	VehicleInfo   string `json:"vehicle_info,omitempty"`
 	LicenseNumber string `json:"license_number,omitempty"`
 	LicenseExpiry string `json:"license_expiry,omitempty"`
+
+	Gender string `json:"gender,omitempty"`
+	// Capabilities replace the stored ones when given
+	Capabilities *VehicleCapabilities `json:"capabilities,omitempty"`
 }
@@ -37,8 +37,29 @@ type Driver struct {
     LicenseExpiry time.Time `json:"license_expiry,omitempty" dynamodbav:"license_expiry,omitempty"`
     VehicleInfo   string    `json:"vehicle_info,omitempty" dynamodbav:"vehicle_info,omitempty"`
     IsVerified    bool      `json:"is_verified" dynamodbav:"is_verified"`
+    // Gender and Capabilities are sent with the driver's location, so that
+    // riders can ask for them when matching
+    Gender        string              `json:"gender,omitempty" dynamodbav:"gender,omitempty"`
+    Capabilities  VehicleCapabilities `json:"capabilities" dynamodbav:"capabilities"`
 }
 
+// VehicleCapabilities are what a driver's vehicle offers beyond its type
+type VehicleCapabilities struct {
+    WheelchairAccessible bool `json:"wheelchair_accessible" dynamodbav:"wheelchair_accessible"`
+    ChildSeat            bool `json:"child_seat" dynamodbav:"child_seat"`
+    PetFriendly          bool `json:"pet_friendly" dynamodbav:"pet_friendly"`
+    Electric             bool `json:"electric" dynamodbav:"electric"`
+    // LuggageCapacity is the number of bags the vehicle takes
+    LuggageCapacity      int  `json:"luggage_capacity" dynamodbav:"luggage_capacity"`
+}
+
+// Driver genders
+const (
+    GenderFemale = "female"
+    GenderMale   = "male"
+    GenderOther  = "other"
+)
+
 type Registration struct {
     Email       string   `json:"email" validate:"required,email"`
     Password    string   `json:"password" validate:"required,min=8"`
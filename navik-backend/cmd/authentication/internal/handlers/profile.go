@@ -3,6 +3,7 @@ package handlers
 
 import (
     "encoding/json"
+    "errors"
     "net/http"
     
     "authentication/internal/domain"
@@ -107,6 +108,10 @@ func (h *ProfileHandler) UpdateDriverProfile(w http.ResponseWriter, r *http.Requ
     
     // Update profile
     if err := h.profileService.UpdateDriverProfile(r.Context(), userID, update); err != nil {
+        if errors.Is(err, service.ErrInvalidGender) || errors.Is(err, service.ErrInvalidCapabilities) {
+            respondWithError(w, http.StatusBadRequest, err.Error())
+            return
+        }
         respondWithError(w, http.StatusInternalServerError, "Failed to update profile")
         return
     }
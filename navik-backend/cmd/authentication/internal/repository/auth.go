@@ -330,6 +330,18 @@ func (r *UserRepository) GetDriverByID(ctx context.Context, id string) (*domain.
                 driver.IsVerified = verifiedValue.Value
             }
         }
+        
+        if gender, ok := result.Item["gender"]; ok {
+            if genderValue, ok := gender.(*types.AttributeValueMemberS); ok {
+                driver.Gender = genderValue.Value
+            }
+        }
+        
+        if capabilities, ok := result.Item["capabilities"]; ok {
+            if err := attributevalue.Unmarshal(capabilities, &driver.Capabilities); err != nil {
+                return nil, err
+            }
+        }
     }
     
     return driver, nil
@@ -426,6 +438,14 @@ func (r *UserRepository) UpdateDriverProfile(ctx context.Context, id string, upd
         updateExpr = updateExpr.Set(expression.Name("license_expiry"), expression.Value(update.LicenseExpiry))
     }
     
+    if update.Gender != "" {
+        updateExpr = updateExpr.Set(expression.Name("gender"), expression.Value(update.Gender))
+    }
+    
+    if update.Capabilities != nil {
+        updateExpr = updateExpr.Set(expression.Name("capabilities"), expression.Value(*update.Capabilities))
+    }
+    
     expr, err := expression.NewBuilder().WithUpdate(updateExpr).Build()
     if err != nil {
         return err
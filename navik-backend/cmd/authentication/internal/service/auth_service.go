@@ -13,6 +13,7 @@ import (
 
 	"authentication/internal/domain"
 	"authentication/internal/repository"
+	"navik-backend/pkg/redisclient"
 )
 
 var (
@@ -21,13 +22,6 @@ var (
 	ErrExpiredToken       = errors.New("token has expired")
 )
 
-type RedisConfig struct {
-	Addr     string
-	Password string
-	DB       int
-	Enabled  bool
-}
-
 type JWTConfig struct {
 	AccessTokenSecret   string
 	RefreshTokenSecret  string
@@ -40,39 +34,16 @@ type JWTConfig struct {
 type AuthService struct {
 	userRepo    *repository.UserRepository
 	jwtConfig   JWTConfig
-	redisClient *redis.Client
+	redisClient redis.UniversalClient
 	useCache    bool
 }
 
-func NewAuthService(userRepo *repository.UserRepository, jwtConfig JWTConfig, redisConfig RedisConfig) *AuthService {
-
-	var redisClient *redis.Client
-	useCache := false
-
-	if redisConfig.Enabled {
-		redisClient = redis.NewClient(&redis.Options{
-			Addr:     redisConfig.Addr,
-			Password: redisConfig.Password,
-			DB:       redisConfig.DB,
-		})
-
-		// Test connection
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		if _, err := redisClient.Ping(ctx).Result(); err == nil {
-			useCache = true
-		} else {
-			fmt.Printf("Warning: Redis connection failed: %v, continuing without caching\n", err)
-		}
-		fmt.Printf("Redis connection established: %s\n", redisConfig.Addr)
-	}
-
+func NewAuthService(userRepo *repository.UserRepository, jwtConfig JWTConfig, redisClient redis.UniversalClient) *AuthService {
 	return &AuthService{
 		userRepo:    userRepo,
 		jwtConfig:   jwtConfig,
 		redisClient: redisClient,
-		useCache:    useCache,
+		useCache:    redisClient != nil,
 	}
 }
 
@@ -195,7 +166,7 @@ func (s *AuthService) cacheAccessToken(ctx context.Context, userID, tokenID stri
 		return nil
 	}
 
-	key := fmt.Sprintf("access_token:%s:%s", userID, tokenID)
+	key := redisclient.AccessTokenKey(userID, tokenID)
 	return s.redisClient.Set(ctx, key, "valid", expiresIn).Err()
 }
 
@@ -204,7 +175,7 @@ func (s *AuthService) getAccessToken(ctx context.Context, userID, tokenID string
 		return false, nil
 	}
 
-	key := fmt.Sprintf("access_token:%s:%s", userID, tokenID)
+	key := redisclient.AccessTokenKey(userID, tokenID)
 	val, err := s.redisClient.Get(ctx, key).Result()
 
 	if err == redis.Nil {
@@ -221,18 +192,17 @@ func (s *AuthService) invalidateUserTokens(ctx context.Context, userID string) e
 		return nil
 	}
 
-	// Invalidate all user tokens by pattern
-	pattern := fmt.Sprintf("access_token:%s:*", userID)
-	keys, err := s.redisClient.Keys(ctx, pattern).Result()
-	if err != nil {
+	// Invalidate all user tokens by pattern. The keys can be in different
+	// cluster slots, so they are deleted one at a time.
+	pattern := redisclient.AccessTokenKey(userID, "*")
+	return redisclient.Scan(ctx, s.redisClient, pattern, func(keys []string) error {
+		pipe := s.redisClient.Pipeline()
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		_, err := pipe.Exec(ctx)
 		return err
-	}
-
-	if len(keys) > 0 {
-		return s.redisClient.Del(ctx, keys...).Err()
-	}
-
-	return nil
+	})
 }
 
 func (s *AuthService) blacklistToken(ctx context.Context, tokenID string, duration time.Duration) error {
@@ -240,7 +210,7 @@ func (s *AuthService) blacklistToken(ctx context.Context, tokenID string, durati
 		return nil
 	}
 
-	key := fmt.Sprintf("blacklist:%s", tokenID)
+	key := redisclient.BlacklistKey(tokenID)
 	return s.redisClient.Set(ctx, key, "revoked", duration).Err()
 }
 
@@ -249,7 +219,7 @@ func (s *AuthService) isTokenBlacklisted(ctx context.Context, tokenID string) (b
 		return false, nil
 	}
 
-	key := fmt.Sprintf("blacklist:%s", tokenID)
+	key := redisclient.BlacklistKey(tokenID)
 	_, err := s.redisClient.Get(ctx, key).Result()
 
 	if err == redis.Nil {
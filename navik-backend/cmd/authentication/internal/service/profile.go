@@ -3,11 +3,19 @@ package service
 
 import (
 	"context"
+	"errors"
 
 	"authentication/internal/domain"
 	"authentication/internal/repository"
 )
 
+var (
+	// ErrInvalidGender is returned for a driver gender other than female, male or other
+	ErrInvalidGender = errors.New("gender must be female, male or other")
+	// ErrInvalidCapabilities is returned for a negative luggage capacity
+	ErrInvalidCapabilities = errors.New("luggage_capacity must not be negative")
+)
+
 type ProfileService struct {
 	userRepo *repository.UserRepository
 }
@@ -65,10 +73,22 @@ func (s *ProfileService) GetDriverProfile(ctx context.Context, userID string) (*
 		VehicleInfo:   driver.VehicleInfo,
 		IsVerified:    driver.IsVerified,
 		CreatedAt:     driver.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		Gender:        driver.Gender,
+		Capabilities:  driver.Capabilities,
 	}, nil
 }
 
 // UpdateDriverProfile updates a driver's profile
 func (s *ProfileService) UpdateDriverProfile(ctx context.Context, userID string, update domain.DriverProfileUpdate) error {
+	switch update.Gender {
+	case "", domain.GenderFemale, domain.GenderMale, domain.GenderOther:
+	default:
+		return ErrInvalidGender
+	}
+
+	if update.Capabilities != nil && update.Capabilities.LuggageCapacity < 0 {
+		return ErrInvalidCapabilities
+	}
+
 	return s.userRepo.UpdateDriverProfile(ctx, userID, update)
 }
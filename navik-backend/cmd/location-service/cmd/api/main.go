@@ -11,8 +11,14 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
 	"location-service/internal/config"
 	"location-service/internal/handler"
+	"location-service/internal/repository"
 	"location-service/internal/service"
 	"location-service/pkg/kafka"
 )
@@ -32,7 +38,16 @@ func main() {
 	}
 	defer producer.Close()
 
-	locationService := service.NewLocationService(nil, producer)
+	sess := session.Must(session.NewSession(&aws.Config{
+		Endpoint:    aws.String(cfg.DynamoDB.Endpoint),
+		Region:      aws.String(cfg.DynamoDB.Region),
+		Credentials: credentials.NewStaticCredentials("localkey", "localsecret", ""),
+		DisableSSL:  aws.Bool(true),
+	}))
+	profiles := repository.NewDynamoDBDriverProfileRepository(dynamodb.New(sess), cfg.DynamoDB.UsersTable,
+		time.Duration(cfg.DynamoDB.ProfileCacheTTLSeconds)*time.Second)
+
+	locationService := service.NewLocationService(nil, profiles, producer)
 	locationHandler := handler.NewLocationHandler(locationService)
 
 	mux := http.NewServeMux()
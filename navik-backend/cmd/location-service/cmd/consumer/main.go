@@ -52,7 +52,7 @@ func main() {
 	}
 	log.Println("DynamoDB table is ready")
 
-	locationService := service.NewLocationService(repo, nil)
+	locationService := service.NewLocationService(repo, nil, nil)
 
 	// Handler function for location updates
 	locationHandler := func(loc model.Location) error {
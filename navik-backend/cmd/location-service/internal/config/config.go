@@ -17,6 +17,14 @@ type Config struct {
 	Server struct {
 		Port int `json:"port"`
 	} `json:"server"`
+	// DynamoDB is where driver profiles are read from, in the authentication
+	// service's users table
+	DynamoDB struct {
+		Endpoint               string `json:"endpoint"`
+		Region                 string `json:"region"`
+		UsersTable             string `json:"users_table"`
+		ProfileCacheTTLSeconds int    `json:"profile_cache_ttl_seconds"`
+	} `json:"dynamodb"`
 }
 
 // Load loads configuration from environment variables or a file
@@ -37,5 +45,18 @@ func Load(filename string) (*Config, error) {
 		config.Kafka.Brokers = strings.Split(brokers, ",")
 	}
 
+	if config.DynamoDB.Endpoint == "" {
+		config.DynamoDB.Endpoint = "http://dynamodb-local:8000"
+	}
+	if config.DynamoDB.Region == "" {
+		config.DynamoDB.Region = "us-west-2"
+	}
+	if config.DynamoDB.UsersTable == "" {
+		config.DynamoDB.UsersTable = "Users"
+	}
+	if config.DynamoDB.ProfileCacheTTLSeconds == 0 {
+		config.DynamoDB.ProfileCacheTTLSeconds = 300
+	}
+
 	return &config, nil
 }
@@ -13,6 +13,29 @@ type Location struct {
 	Timestamp   int64   `json:"timestamp"`
 	VehicleType string  `json:"vehicle_type"`
 	Status      string  `json:"status"`
+	// Heading is the direction of travel in degrees clockwise from north
+	Heading float64 `json:"heading,omitempty"`
+	// Capabilities and DriverGender are loaded from the driver's profile
+	// before the update is published. Riders' safety constraints match on
+	// them, so whatever a driver sends in their update is replaced.
+	Capabilities VehicleCapabilities `json:"capabilities,omitempty"`
+	DriverGender string              `json:"driver_gender,omitempty"`
+}
+
+// DriverProfile is what a location is stored with from the driver's profile
+type DriverProfile struct {
+	Gender       string              `dynamodbav:"gender"`
+	Capabilities VehicleCapabilities `dynamodbav:"capabilities"`
+}
+
+// VehicleCapabilities are what a driver's vehicle offers beyond its type
+type VehicleCapabilities struct {
+	WheelchairAccessible bool `json:"wheelchair_accessible,omitempty" dynamodbav:"wheelchair_accessible"`
+	ChildSeat            bool `json:"child_seat,omitempty" dynamodbav:"child_seat"`
+	PetFriendly          bool `json:"pet_friendly,omitempty" dynamodbav:"pet_friendly"`
+	Electric             bool `json:"electric,omitempty" dynamodbav:"electric"`
+	// LuggageCapacity is the number of bags the vehicle takes
+	LuggageCapacity int `json:"luggage_capacity,omitempty" dynamodbav:"luggage_capacity"`
 }
 
 type LocationDB struct {
@@ -23,12 +46,16 @@ type LocationDB struct {
 	GSI2PK    string `json:"gsi2pk" dynamodbav:"GSI2PK"`
     GSI3PK    string `json:"gsi3pk" dynamodbav:"GSI3PK"`
 	DriverID  string `json:"driver_id" dynamodbav:"driver_id"`
+	City      string `json:"city" dynamodbav:"city"`
 	Location  string `json:"location" dynamodbav:"location"`
 	H3Res9    string `json:"h3_res9" dynamodbav:"h3_res9"`
 	H3Res8    string `json:"h3_res8" dynamodbav:"h3_res8"`
 	H3Res7    string `json:"h3_res7" dynamodbav:"h3_res7"`
 	VehicleType   string `json:"vehicle_type" dynamodbav:"vehicle_type"`
 	Status        string `json:"status" dynamodbav:"status"`
+	Heading       float64 `json:"heading" dynamodbav:"heading"`
+	Capabilities  VehicleCapabilities `json:"capabilities" dynamodbav:"capabilities"`
+	DriverGender  string `json:"driver_gender,omitempty" dynamodbav:"driver_gender,omitempty"`
 	UpdatedAt     int64  `json:"updated_at" dynamodbav:"updated_at"`
 	ExpiresAt     int64  `json:"expires_at" dynamodbav:"expires_at"`
 }
@@ -47,6 +74,10 @@ func (l *Location) Validate() error {
 		return fmt.Errorf("longitude must be between -180 and 180")
 	}
 
+	if l.Heading < 0 || l.Heading >= 360 {
+		return fmt.Errorf("heading must be between 0 and 360")
+	}
+
 	if l.VehicleType == "" {
 		return fmt.Errorf("vehicle_type is required")
 	}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+
+	"location-service/internal/model"
+)
+
+// ErrDriverProfileNotFound is returned when there is no driver with the ID
+var ErrDriverProfileNotFound = errors.New("driver profile not found")
+
+type DriverProfileRepository interface {
+	Get(ctx context.Context, driverID string) (model.DriverProfile, error)
+}
+
+type cachedProfile struct {
+	profile   model.DriverProfile
+	expiresAt time.Time
+}
+
+// DynamoDBDriverProfileRepository reads driver profiles from the
+// authentication service's users table. Drivers send a location every few
+// seconds, so profiles are cached for cacheTTL.
+type DynamoDBDriverProfileRepository struct {
+	ddb       *dynamodb.DynamoDB
+	tableName string
+	cacheTTL  time.Duration
+	mutex     sync.Mutex
+	cache     map[string]cachedProfile
+}
+
+func NewDynamoDBDriverProfileRepository(ddb *dynamodb.DynamoDB, tableName string, cacheTTL time.Duration) *DynamoDBDriverProfileRepository {
+	return &DynamoDBDriverProfileRepository{
+		ddb:       ddb,
+		tableName: tableName,
+		cacheTTL:  cacheTTL,
+		cache:     make(map[string]cachedProfile),
+	}
+}
+
+func (r *DynamoDBDriverProfileRepository) Get(ctx context.Context, driverID string) (model.DriverProfile, error) {
+	r.mutex.Lock()
+	cached, ok := r.cache[driverID]
+	r.mutex.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.profile, nil
+	}
+
+	result, err := r.ddb.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(driverID)},
+		},
+		ProjectionExpression: aws.String("user_type, gender, capabilities"),
+	})
+	if err != nil {
+		return model.DriverProfile{}, fmt.Errorf("failed to read profile of driver %s: %w", driverID, err)
+	}
+
+	userType := result.Item["user_type"]
+	if userType == nil || aws.StringValue(userType.S) != "driver" {
+		return model.DriverProfile{}, ErrDriverProfileNotFound
+	}
+
+	var profile model.DriverProfile
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &profile); err != nil {
+		return model.DriverProfile{}, fmt.Errorf("failed to unmarshal profile of driver %s: %w", driverID, err)
+	}
+
+	r.mutex.Lock()
+	r.cache[driverID] = cachedProfile{profile: profile, expiresAt: time.Now().Add(r.cacheTTL)}
+	r.mutex.Unlock()
+
+	return profile, nil
+}
@@ -68,15 +68,19 @@ func (r *DynamoDBLocationRepository) convertToLocationDB(loc model.Location) (mo
 	h3Prefix := r.safePrefix(h3Indexes[0], 5)
 
 	locDB := model.LocationDB{
-		DriverID:    loc.DriverID,
-		Location:    fmt.Sprintf("%f,%f", loc.Latitude, loc.Longitude),
-		H3Res9:      h3Indexes[0],
-		H3Res8:      h3Indexes[1],
-		H3Res7:      h3Indexes[2],
-		VehicleType: loc.VehicleType,
-		Status:      loc.Status,
-		UpdatedAt:   time.Now().Unix(),
-		ExpiresAt:   time.Now().Unix() + locationTTL,
+		DriverID:     loc.DriverID,
+		City:         loc.City,
+		Location:     fmt.Sprintf("%f,%f", loc.Latitude, loc.Longitude),
+		H3Res9:       h3Indexes[0],
+		H3Res8:       h3Indexes[1],
+		H3Res7:       h3Indexes[2],
+		VehicleType:  loc.VehicleType,
+		Status:       loc.Status,
+		Heading:      loc.Heading,
+		Capabilities: loc.Capabilities,
+		DriverGender: loc.DriverGender,
+		UpdatedAt:    time.Now().Unix(),
+		ExpiresAt:    time.Now().Unix() + locationTTL,
 	}
 
 	var shard string
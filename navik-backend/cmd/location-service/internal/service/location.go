@@ -18,12 +18,14 @@ type LocationService interface {
 
 type locationService struct {
 	repository repository.LocationRepository
+	profiles   repository.DriverProfileRepository
 	producer   *kafka.Producer
 }
 
-func NewLocationService(repo repository.LocationRepository, producer *kafka.Producer) LocationService {
+func NewLocationService(repo repository.LocationRepository, profiles repository.DriverProfileRepository, producer *kafka.Producer) LocationService {
 	return &locationService{
 		repository: repo,
+		profiles:   profiles,
 		producer:   producer,
 	}
 }
@@ -33,6 +35,8 @@ func (s *locationService) UpdateLocation(ctx context.Context, loc model.Location
 		return fmt.Errorf("invalid location data: %w", err)
 	}
 
+	s.applyProfile(ctx, &loc)
+
 	if s.producer != nil {
 		if err := s.producer.SendToProducer(loc, loc.City, ""); err != nil {
 			log.Printf("Warning: Failed to publish location to Kafka: %v", err)
@@ -56,3 +60,22 @@ func (s *locationService) ProcessLocationUpdate(loc model.Location) error {
 
 	return s.repository.Store(ctx, loc)
 }
+
+// applyProfile replaces the profile fields of an update with the driver's
+// profile before it is published, so that the location store and matching's
+// driver index, which both read the location topics, see the same values. A
+// driver whose profile cannot be read is published without capabilities, so
+// they are only left out of rides that need them.
+func (s *locationService) applyProfile(ctx context.Context, loc *model.Location) {
+	loc.Capabilities, loc.DriverGender = model.VehicleCapabilities{}, ""
+	if s.profiles == nil {
+		return
+	}
+
+	profile, err := s.profiles.Get(ctx, loc.DriverID)
+	if err != nil {
+		log.Printf("Publishing location of driver %s without profile: %v", loc.DriverID, err)
+		return
+	}
+	loc.Capabilities, loc.DriverGender = profile.Capabilities, profile.Gender
+}
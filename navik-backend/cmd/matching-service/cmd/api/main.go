@@ -11,12 +11,19 @@ import (
 	"syscall"
 	"time"
 
+	"matching-service/internal/auth"
 	"matching-service/internal/config"
 	"matching-service/internal/handler"
+	"matching-service/internal/hub"
+	"matching-service/internal/repository"
 	"matching-service/internal/service"
 	"matching-service/pkg/kafka"
+	"navik-backend/pkg/redisclient"
 
-	"github.com/go-redis/redis/v8"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
 func main() {
@@ -34,20 +41,109 @@ func main() {
 	}
 	defer producer.Close()
 
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     "redis:6379", // Use environment variable in production
-		DB:       0,            // use default DB
-		Password: "",
-	})
+	var events service.EventPublisher
+	if cfg.Events.Enabled {
+		eventProducer, err := kafka.NewProducer(cfg.Kafka.Brokers, cfg.Events.TopicFormat)
+		if err != nil {
+			log.Fatalf("Failed to create match event producer: %v", err)
+		}
+		events = service.NewEventPublisher(eventProducer, cfg.Events.QueueSize)
+		defer events.Close()
+	}
+
+	redisClient, err := redisclient.New(context.Background(), cfg.Redis)
+	if err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
+	}
 	defer redisClient.Close()
 
-	locationService := service.NewLocationService(nil, producer)
-	locationHandler := handler.NewLocationHandler(locationService)
-	wsHandler := handler.NewWebSocketHandler(redisClient)
+	tokenValidator := auth.NewTokenValidator(cfg.Auth.JWTAccessSecret, cfg.Auth.JWTIssuer, redisClient)
+	ticketStore := auth.NewTicketStore(redisClient, time.Duration(cfg.Auth.TicketTTLSeconds)*time.Second)
+	authenticator := auth.NewAuthenticator(tokenValidator, ticketStore)
+	searchRepo := repository.NewSearchRepository(redisClient,
+		time.Duration(cfg.Matching.SearchTTLSeconds)*time.Second)
+	locationService := service.NewLocationService(searchRepo, producer, events)
+	locationHandler := handler.NewLocationHandler(locationService, authenticator)
+	matchStream := repository.NewMatchStreamRepository(redisClient, cfg.Matching.StreamMaxLen,
+		time.Duration(cfg.Matching.StreamTTLSeconds)*time.Second)
+
+	hubCtx, stopHub := context.WithCancel(context.Background())
+	defer stopHub()
+
+	wsHub := hub.NewHub(redisClient, hub.Config{
+		SendQueueSize:   cfg.WebSocket.SendQueueSize,
+		PingInterval:    time.Duration(cfg.WebSocket.PingIntervalSeconds) * time.Second,
+		PongTimeout:     time.Duration(cfg.WebSocket.PongTimeoutSeconds) * time.Second,
+		WriteTimeout:    time.Duration(cfg.WebSocket.WriteTimeoutSeconds) * time.Second,
+		MaxMessageBytes: cfg.WebSocket.MaxMessageBytes,
+	})
+	go func() {
+		for {
+			if err := wsHub.Run(hubCtx); err != nil && hubCtx.Err() == nil {
+				log.Printf("WebSocket hub stopped: %v, restarting", err)
+				time.Sleep(time.Second)
+				continue
+			}
+			return
+		}
+	}()
+
+	reservationRepo := repository.NewReservationRepository(redisClient)
+	driverStatsRepo := repository.NewDriverStatsRepository(redisClient)
+	reservationService := service.NewReservationService(reservationRepo, matchStream, searchRepo, driverStatsRepo, events,
+		time.Duration(cfg.Reservation.AssignmentTTLSeconds)*time.Second)
+	reservationHandler := handler.NewReservationHandler(reservationService, authenticator)
+
+	traceRepo := repository.NewSearchTraceRepository(redisClient,
+		time.Duration(cfg.Matching.SearchTTLSeconds)*time.Second)
+	searchService := service.NewSearchService(searchRepo, traceRepo, reservationRepo, driverStatsRepo, matchStream, events)
+	searchHandler := handler.NewSearchHandler(searchService, authenticator)
+	rideRepo := repository.NewScheduledRideRepository(redisClient,
+		time.Duration(cfg.Scheduling.RetentionHours)*time.Hour)
+	scheduledRideService := service.NewScheduledRideService(rideRepo, searchService, service.NewScheduledRideConfig(cfg))
+	scheduledRideHandler := handler.NewScheduledRideHandler(scheduledRideService, authenticator)
+	pooledTripRepo := repository.NewPooledTripRepository(redisClient,
+		time.Duration(cfg.Pool.TripTTLHours)*time.Hour)
+	poolHandler := handler.NewPoolHandler(service.NewPoolTripService(pooledTripRepo, reservationRepo), authenticator)
+	experimentService := service.NewExperimentService(service.NewExperiments(cfg), repository.NewExperimentRepository(redisClient))
+	experimentHandler := handler.NewExperimentHandler(experimentService, authenticator)
+	sess := session.Must(session.NewSession(&aws.Config{
+		Endpoint: aws.String(cfg.DynamoDB.Endpoint),
+		Region:   aws.String(cfg.DynamoDB.Region),
+		Credentials: credentials.NewStaticCredentials(
+			cfg.DynamoDB.AccessKey,
+			cfg.DynamoDB.SecretKey,
+			""),
+		DisableSSL: aws.Bool(true),
+	}))
+	driverRepo := repository.NewDriverRepository(dynamodb.New(sess), cfg.DynamoDB.TableName)
+	nearbyService := service.NewNearbyService(driverRepo, reservationRepo, service.NearbyConfig{
+		Interval:       time.Duration(cfg.Nearby.IntervalSeconds) * time.Second,
+		MaxRadiusKm:    cfg.Nearby.MaxRadiusKm,
+		MaxCars:        cfg.Nearby.MaxCars,
+		SnapResolution: cfg.Nearby.SnapResolution,
+	})
+	nearbyHandler := handler.NewNearbyHandler(nearbyService, authenticator)
+	blockHandler := handler.NewBlockHandler(service.NewBlockService(repository.NewBlockRepository(redisClient)), authenticator)
+	socketHandler := handler.NewSocketHandler(locationService, searchService)
+	wsHub.HandleMessages(socketHandler.HandleMessage)
+
+	wsHandler := handler.NewWebSocketHandler(redisClient, wsHub, matchStream, authenticator, cfg.Auth.AllowedOrigins)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/ws", wsHandler.HandleWebSocket)
+	mux.HandleFunc("/sse", wsHandler.HandleEventStream)
+	mux.HandleFunc("/api/matching/ws-ticket", wsHandler.HandleTicket)
+	mux.HandleFunc("/metrics", wsHandler.HandleMetrics)
+	mux.HandleFunc("/health/redis", wsHandler.HandleHealth)
 	locationHandler.SetupRoutes(mux)
+	reservationHandler.SetupRoutes(mux)
+	searchHandler.SetupRoutes(mux)
+	scheduledRideHandler.SetupRoutes(mux)
+	poolHandler.SetupRoutes(mux)
+	experimentHandler.SetupRoutes(mux)
+	nearbyHandler.SetupRoutes(mux)
+	blockHandler.SetupRoutes(mux)
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
@@ -69,6 +165,7 @@ func main() {
 
 	<-stop
 	log.Println("Shutting down server...")
+	stopHub()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
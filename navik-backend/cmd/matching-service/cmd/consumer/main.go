@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -13,14 +14,14 @@ import (
 	"matching-service/internal/handler"
 	"matching-service/internal/repository"
 	"matching-service/internal/service"
+	"matching-service/pkg/kafka"
+	"navik-backend/pkg/redisclient"
 
 	"github.com/IBM/sarama"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-
-	"github.com/go-redis/redis/v8"
 )
 
 func main() {
@@ -34,11 +35,10 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 	// Initialize Redis client
-	redisClient := redis.NewClient(&redis.Options{
-		Addr: "redis:6379", 
-		DB:   0,            // use default DB
-		Password: "",      // no password set
-	})
+	redisClient, err := redisclient.New(context.Background(), cfg.Redis)
+	if err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
+	}
 	defer redisClient.Close()
 
 	// Initialize DynamoDB client
@@ -53,17 +53,59 @@ func main() {
 	}))
 	ddb := dynamodb.New(sess)
 
-	// Create driver repository
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create driver repository, answering from the in-memory index if enabled
 	driverRepo := repository.NewDriverRepository(ddb, cfg.DynamoDB.TableName)
+	if cfg.DriverIndex.Enabled {
+		driverRepo = startDriverIndex(ctx, cfg, ddb)
+	}
+
+	// Create match stream repository
+	matchStream := repository.NewMatchStreamRepository(redisClient, cfg.Matching.StreamMaxLen,
+		time.Duration(cfg.Matching.StreamTTLSeconds)*time.Second)
+
+	// Create driver reservation repository
+	reservationRepo := repository.NewReservationRepository(redisClient)
+
+	// Create search repository
+	searchRepo := repository.NewSearchRepository(redisClient,
+		time.Duration(cfg.Matching.SearchTTLSeconds)*time.Second)
+
+	// Create search trace repository
+	traceRepo := repository.NewSearchTraceRepository(redisClient,
+		time.Duration(cfg.Matching.SearchTTLSeconds)*time.Second)
+
+	// Create pooled trip repository
+	pooledTripRepo := repository.NewPooledTripRepository(redisClient,
+		time.Duration(cfg.Pool.TripTTLHours)*time.Hour)
+
+	// Publish match events if enabled
+	var events service.EventPublisher
+	if cfg.Events.Enabled {
+		eventProducer, err := kafka.NewProducer(cfg.Kafka.Brokers, cfg.Events.TopicFormat)
+		if err != nil {
+			log.Fatalf("Failed to create match event producer: %v", err)
+		}
+		events = service.NewEventPublisher(eventProducer, cfg.Events.QueueSize)
+		defer events.Close()
+	}
 
 	// Create matching service
-	matchingService := service.NewMatchingService(driverRepo, struct {
-		MinDriversToReturn int
-		MaxDistanceKm      float64
-	}{
-		MinDriversToReturn: cfg.Matching.MinDriversToReturn,
-		MaxDistanceKm:      cfg.Matching.MaxDistanceKm,
-	},redisClient)
+	matchingService := service.NewMatchingService(service.MatchingDependencies{
+		Drivers:         driverRepo,
+		MatchStream:     matchStream,
+		Reservations:    reservationRepo,
+		Searches:        searchRepo,
+		Traces:          traceRepo,
+		PooledTrips:     pooledTripRepo,
+		ExperimentStats: repository.NewExperimentRepository(redisClient),
+		Blocks:          repository.NewBlockRepository(redisClient),
+		DriverStats:     repository.NewDriverStatsRepository(redisClient),
+		Events:          events,
+		RedisClient:     redisClient,
+	}, service.NewMatchingConfig(cfg))
 
 	// Setup Kafka consumer config
 	kafkaConfig := sarama.NewConfig()
@@ -95,10 +137,8 @@ func main() {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	handler := handler.NewConsumerGroupHandler(matchingService)
+	handler := handler.NewConsumerGroupHandler(matchingService, consumerGroup,
+		cfg.Kafka.Workers, cfg.Kafka.QueueSize)
 
 	// Start consuming in a goroutine
 	go func() {
@@ -137,4 +177,52 @@ func main() {
 	
 	// Wait for all in-flight messages to be processed
 	time.Sleep(2 * time.Second)
-}
\ No newline at end of file
+}
+
+// startDriverIndex tails the city location topics into an in-memory driver
+// index. The feed starts before the DynamoDB bootstrap so that no update
+// published while bootstrapping is missed.
+func startDriverIndex(ctx context.Context, cfg *config.Config, ddb *dynamodb.DynamoDB) *repository.DriverIndex {
+	ttl := time.Duration(cfg.DriverIndex.TTLSeconds) * time.Second
+	index := repository.NewDriverIndex(ttl)
+
+	// Riders in boundary zones are also matched with drivers of the
+	// neighbouring cities, so those cities' locations are indexed too
+	var topics []string
+	seen := make(map[string]bool)
+	cities := append([]string{}, cfg.Kafka.Cities...)
+	for _, boundary := range cfg.Boundaries {
+		cities = append(cities, boundary.Cities...)
+	}
+	for _, city := range cities {
+		if !seen[city] {
+			seen[city] = true
+			topics = append(topics, fmt.Sprintf(cfg.DriverIndex.TopicFormat, city))
+		}
+	}
+
+	feed, err := kafka.NewTailConsumer(cfg.Kafka.Brokers, topics)
+	if err != nil {
+		log.Fatalf("Error creating driver location consumer: %v", err)
+	}
+	locationHandler := handler.NewDriverLocationHandler(index)
+	if err := feed.Start(ctx, locationHandler.HandleMessage); err != nil {
+		log.Fatalf("Error consuming driver locations: %v", err)
+	}
+	go func() {
+		<-ctx.Done()
+		feed.Close()
+	}()
+
+	if *cfg.DriverIndex.Bootstrap {
+		snapshotter := repository.NewDriverSnapshotter(ddb, cfg.DynamoDB.TableName)
+		if err := index.Bootstrap(ctx, snapshotter); err != nil {
+			log.Printf("Error bootstrapping driver index, relying on live updates: %v", err)
+		}
+	}
+
+	go index.RunEviction(ctx)
+
+	log.Printf("Driver index enabled for topics %v with TTL %v", topics, ttl)
+	return index
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"matching-service/internal/model"
+	"matching-service/internal/repository"
+)
+
+// virtualClock is the replay's notion of the current time. It is advanced by
+// the replay loop, which is the only goroutine that matches.
+type virtualClock struct {
+	now time.Time
+}
+
+func (c *virtualClock) Now() time.Time {
+	return c.now
+}
+
+type lease struct {
+	kind    string
+	holder  string
+	expires time.Time
+}
+
+// memoryReservations mirrors the Redis lease semantics of the reservation
+// repository, with leases expiring in virtual time
+type memoryReservations struct {
+	clock   *virtualClock
+	leases  map[string]lease
+	holders map[string]map[string]struct{}
+}
+
+func newMemoryReservations(clock *virtualClock) *memoryReservations {
+	return &memoryReservations{
+		clock:   clock,
+		leases:  make(map[string]lease),
+		holders: make(map[string]map[string]struct{}),
+	}
+}
+
+func (r *memoryReservations) current(driverID string) (lease, bool) {
+	l, ok := r.leases[driverID]
+	if ok && !r.clock.Now().Before(l.expires) {
+		delete(r.leases, driverID)
+		return lease{}, false
+	}
+	return l, ok
+}
+
+func (r *memoryReservations) SoftReserve(ctx context.Context, driverID, holder string, ttl time.Duration) (bool, error) {
+	if l, ok := r.current(driverID); ok && (l.kind != repository.ReservationSoft || l.holder != holder) {
+		return false, nil
+	}
+
+	r.leases[driverID] = lease{kind: repository.ReservationSoft, holder: holder, expires: r.clock.Now().Add(ttl)}
+	if r.holders[holder] == nil {
+		r.holders[holder] = make(map[string]struct{})
+	}
+	r.holders[holder][driverID] = struct{}{}
+	return true, nil
+}
+
+func (r *memoryReservations) HardReserve(ctx context.Context, driverID, holder string, ttl time.Duration) error {
+	if l, ok := r.current(driverID); !ok || l.holder != holder {
+		return repository.ErrOfferNotFound
+	}
+
+	r.leases[driverID] = lease{kind: repository.ReservationHard, holder: holder, expires: r.clock.Now().Add(ttl)}
+	delete(r.holders[holder], driverID)
+	return nil
+}
+
+func (r *memoryReservations) Release(ctx context.Context, driverID, holder string) (bool, error) {
+	l, ok := r.current(driverID)
+	held := ok && l.holder == holder
+	if held {
+		delete(r.leases, driverID)
+	}
+	delete(r.holders[holder], driverID)
+	return held, nil
+}
+
+func (r *memoryReservations) ReleaseAll(ctx context.Context, holder, keepDriverID string) ([]string, error) {
+	var released []string
+	for driverID := range r.holders[holder] {
+		if driverID == keepDriverID {
+			continue
+		}
+		if held, _ := r.Release(ctx, driverID, holder); held {
+			released = append(released, driverID)
+		}
+	}
+	return released, nil
+}
+
+func (r *memoryReservations) ReservedByOthers(ctx context.Context, driverIDs []string, holder string) (map[string]bool, error) {
+	reserved := make(map[string]bool)
+	for _, driverID := range driverIDs {
+		if l, ok := r.current(driverID); ok && l.holder != holder {
+			reserved[driverID] = true
+		}
+	}
+	return reserved, nil
+}
+
+// memoryMatchStream keeps the latest update per user so that the replay can
+// read the result of each request
+type memoryMatchStream struct {
+	seq    map[string]int64
+	latest map[string]*model.MatchUpdate
+}
+
+func newMemoryMatchStream() *memoryMatchStream {
+	return &memoryMatchStream{
+		seq:    make(map[string]int64),
+		latest: make(map[string]*model.MatchUpdate),
+	}
+}
+
+func (m *memoryMatchStream) Publish(ctx context.Context, userID string, payload []byte) (int64, error) {
+	m.seq[userID]++
+	m.latest[userID] = &model.MatchUpdate{Seq: m.seq[userID], Data: payload}
+	return m.seq[userID], nil
+}
+
+func (m *memoryMatchStream) Since(ctx context.Context, userID string, seq int64) ([]model.MatchUpdate, bool, error) {
+	if latest := m.latest[userID]; latest != nil && latest.Seq > seq {
+		return []model.MatchUpdate{*latest}, latest.Seq == seq+1, nil
+	}
+	return nil, seq == m.seq[userID], nil
+}
+
+func (m *memoryMatchStream) Latest(ctx context.Context, userID string) (*model.MatchUpdate, error) {
+	return m.latest[userID], nil
+}
+
+// take returns and clears the user's latest update
+func (m *memoryMatchStream) take(userID string) *model.MatchUpdate {
+	update := m.latest[userID]
+	delete(m.latest, userID)
+	return update
+}
@@ -0,0 +1,102 @@
+// Command replay runs a recorded stream of rider requests and driver location
+// updates through the matching service in virtual time, against in-memory
+// repositories, and prints aggregate metrics so that matching strategies can
+// be compared on the same dataset.
+//
+// The recording is JSON Lines of {"type":"driver","driver":{...}} location
+// updates and {"type":"rider","request":{...}} ride requests.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"matching-service/internal/config"
+	"matching-service/internal/model"
+	"matching-service/internal/repository"
+	"matching-service/internal/service"
+)
+
+func main() {
+	configFile := flag.String("config", "config.json", "Path to configuration file")
+	inputFile := flag.String("input", "", "Path to the JSON Lines recording to replay")
+	strategy := flag.String("strategy", "", "Ranking strategy to use in every city (default: as configured)")
+	tripMinutes := flag.Float64("trip-minutes", 15, "Ride time of requests recorded without a drop-off")
+	verbose := flag.Bool("verbose", false, "Log every matching decision")
+	flag.Parse()
+
+	if *inputFile == "" {
+		log.Fatalf("An input recording is required")
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Batches are collected on wall-clock timers, which a replay does not have
+	if cfg.Matching.Mode != service.MatchingModeGreedy {
+		log.Fatalf("Replay supports greedy matching only, config uses %s", cfg.Matching.Mode)
+	}
+
+	file, err := os.Open(*inputFile)
+	if err != nil {
+		log.Fatalf("Failed to open recording: %v", err)
+	}
+	events, err := readEvents(file)
+	file.Close()
+	if err != nil {
+		log.Fatalf("Failed to read recording: %v", err)
+	}
+
+	if *strategy != "" {
+		cfg.Ranking.DefaultStrategy = *strategy
+		cfg.Ranking.CityStrategies = nil
+	}
+
+	clock := &virtualClock{}
+	index := repository.NewDriverIndex(time.Duration(cfg.DriverIndex.TTLSeconds) * time.Second)
+	index.SetClock(clock.Now)
+	reservations := newMemoryReservations(clock)
+	matchStream := newMemoryMatchStream()
+
+	// Background re-searches run on wall-clock timers, so they stay off
+	matchingConfig := service.NewMatchingConfig(cfg)
+	matchingConfig.Research = service.ResearchConfig{}
+	matchingConfig.Clock = clock.Now
+
+	// Searches, traces, pooled trips, experiment stats, events, blocks and
+	// Redis notifications are not needed: requests are replayed without search
+	// IDs, pooled requests are skipped and recordings carry no blocks
+	matchingService := service.NewMatchingService(service.MatchingDependencies{
+		Drivers:      index,
+		MatchStream:  matchStream,
+		Reservations: reservations,
+	}, matchingConfig)
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	sim := &simulator{
+		clock:        clock,
+		matcher:      matchingService,
+		index:        index,
+		reservations: reservations,
+		matchStream:  matchStream,
+		defaultTrip:  time.Duration(*tripMinutes * float64(time.Minute)),
+		drivers:      make(map[string]model.DriverLocation),
+		onTrip:       make(map[string]bool),
+	}
+	sim.metrics.Strategy = cfg.Ranking.DefaultStrategy
+	metrics := sim.run(context.Background(), events)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(metrics)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	"matching-service/internal/model"
+	"matching-service/internal/repository"
+	"matching-service/internal/service"
+	"matching-service/internal/util"
+)
+
+// Replay event types
+const (
+	eventDriver = "driver"
+	eventRider  = "rider"
+)
+
+// event is one line of a recording: a driver location update as published on
+// the location topics, or a rider request as published on the user topics
+type event struct {
+	Type    string                      `json:"type"`
+	Driver  *model.DriverLocationUpdate `json:"driver,omitempty"`
+	Request *model.UserLocation         `json:"request,omitempty"`
+}
+
+func (e event) timestamp() int64 {
+	if e.Type == eventDriver {
+		return e.Driver.Timestamp
+	}
+	return e.Request.Timestamp
+}
+
+// readEvents parses a JSON Lines recording and orders it by time. Drivers
+// come before riders recorded in the same second.
+func readEvents(r io.Reader) ([]event, error) {
+	var events []event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if (e.Type == eventDriver && e.Driver == nil) || (e.Type == eventRider && e.Request == nil) ||
+			(e.Type != eventDriver && e.Type != eventRider) {
+			return nil, fmt.Errorf("line %d: invalid %q event", line, e.Type)
+		}
+		events = append(events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		ti, tj := events[i].timestamp(), events[j].timestamp()
+		if ti != tj {
+			return ti < tj
+		}
+		return events[i].Type == eventDriver && events[j].Type == eventRider
+	})
+	return events, nil
+}
+
+// trip is a simulated ride that keeps a driver busy until it ends
+type trip struct {
+	driverID  string
+	riderID   string
+	startedAt int64
+	endsAt    int64
+	dropLat   float64
+	dropLng   float64
+}
+
+type tripQueue []*trip
+
+func (q tripQueue) Len() int            { return len(q) }
+func (q tripQueue) Less(i, j int) bool  { return q[i].endsAt < q[j].endsAt }
+func (q tripQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *tripQueue) Push(x interface{}) { *q = append(*q, x.(*trip)) }
+func (q *tripQueue) Pop() interface{} {
+	old := *q
+	t := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return t
+}
+
+// Metrics are the aggregate results of a replay
+type Metrics struct {
+	Strategy              string  `json:"strategy"`
+	Requests              int     `json:"requests"`
+	SkippedRequests       int     `json:"skipped_requests"`
+	Matched               int     `json:"matched"`
+	MatchRate             float64 `json:"match_rate"`
+	MeanPickupETAMinutes  float64 `json:"mean_pickup_eta_minutes"`
+	Drivers               int     `json:"drivers"`
+	DriverUtilisation     float64 `json:"driver_utilisation"`
+	SimulatedMinutes      float64 `json:"simulated_minutes"`
+	DefaultTripMinutes    float64 `json:"default_trip_minutes"`
+	CompletedTrips        int     `json:"completed_trips"`
+	TripsInProgressAtEnd  int     `json:"trips_in_progress_at_end"`
+	totalPickupETAMinutes float64
+	busySeconds           int64
+}
+
+// simulator feeds a recording through the matching service. Riders accept
+// the best offered driver, who is then busy for the pickup and the ride.
+type simulator struct {
+	clock        *virtualClock
+	matcher      service.MatchingService
+	index        *repository.DriverIndex
+	reservations *memoryReservations
+	matchStream  *memoryMatchStream
+
+	// defaultTrip is the ride time of requests recorded without a drop-off
+	defaultTrip time.Duration
+
+	drivers map[string]model.DriverLocation
+	onTrip  map[string]bool
+	trips   tripQueue
+	metrics Metrics
+}
+
+// run replays the events and returns the metrics
+func (s *simulator) run(ctx context.Context, events []event) Metrics {
+	if len(events) == 0 {
+		return s.metrics
+	}
+
+	start, end := events[0].timestamp(), events[len(events)-1].timestamp()
+	for _, e := range events {
+		s.completeTrips(e.timestamp())
+		s.clock.now = time.Unix(e.timestamp(), 0)
+
+		switch e.Type {
+		case eventDriver:
+			s.applyDriver(*e.Driver)
+		case eventRider:
+			s.handleRequest(ctx, *e.Request)
+		}
+	}
+	s.completeTrips(end)
+
+	// Trips still running count as busy until the end of the recording
+	for _, t := range s.trips {
+		s.metrics.busySeconds += end - t.startedAt
+	}
+	s.metrics.TripsInProgressAtEnd = len(s.trips)
+
+	m := s.metrics
+	m.Drivers = len(s.drivers)
+	m.SimulatedMinutes = float64(end-start) / 60
+	m.DefaultTripMinutes = s.defaultTrip.Minutes()
+	if m.Requests > 0 {
+		m.MatchRate = float64(m.Matched) / float64(m.Requests)
+	}
+	if m.Matched > 0 {
+		m.MeanPickupETAMinutes = m.totalPickupETAMinutes / float64(m.Matched)
+	}
+	if m.Drivers > 0 && end > start {
+		m.DriverUtilisation = float64(m.busySeconds) / float64(int64(m.Drivers)*(end-start))
+	}
+	return m
+}
+
+// applyDriver indexes a location update. Updates of drivers the simulation
+// has on a trip are ignored, since the recording knows nothing of that trip.
+func (s *simulator) applyDriver(update model.DriverLocationUpdate) {
+	if s.onTrip[update.DriverID] {
+		return
+	}
+
+	s.drivers[update.DriverID] = model.DriverLocation{
+		DriverID:    update.DriverID,
+		City:        update.City,
+		Latitude:    update.Latitude,
+		Longitude:   update.Longitude,
+		VehicleType: update.VehicleType,
+		Status:      update.Status,
+		UpdatedAt:   update.Timestamp,
+	}
+	s.index.ApplyUpdate(update)
+}
+
+// handleRequest matches one rider request and starts the rider's trip with
+// the best driver offered
+func (s *simulator) handleRequest(ctx context.Context, loc model.UserLocation) {
+	// Pooled trips only end when drivers complete their stops, which a
+	// recording does not contain
+	if loc.Product == model.ProductPool {
+		s.metrics.SkippedRequests++
+		return
+	}
+	if err := loc.Validate(); err != nil {
+		log.Printf("Skipping invalid request of user %s: %v", loc.UserID, err)
+		s.metrics.SkippedRequests++
+		return
+	}
+
+	// Requests are replayed without searches
+	loc.SearchID = ""
+	s.metrics.Requests++
+
+	// A batched request is matched after this returns, so wait for its result
+	matched := make(chan struct{})
+	err := s.matcher.ProcessUserLocation(ctx, loc, func() { close(matched) })
+	<-matched
+	if err != nil {
+		log.Printf("Error matching user %s: %v", loc.UserID, err)
+		return
+	}
+
+	update := s.matchStream.take(loc.UserID)
+	if update == nil {
+		return
+	}
+	var response model.DriverResponse
+	if err := json.Unmarshal(update.Data, &response); err != nil || len(response.Drivers) == 0 {
+		return
+	}
+
+	accepted := response.Drivers[0]
+	driver, ok := s.drivers[accepted.DriverID]
+	if !ok {
+		return
+	}
+
+	rideMinutes := s.defaultTrip.Minutes()
+	dropLat, dropLng := loc.Latitude, loc.Longitude
+	if loc.DropLatitude != 0 || loc.DropLongitude != 0 {
+		dropLat, dropLng = loc.DropLatitude, loc.DropLongitude
+		rideMinutes = util.EstimateETAMinutes(util.HaversineKm(loc.Latitude, loc.Longitude, dropLat, dropLng))
+	}
+	duration := time.Duration((float64(accepted.ETA) + rideMinutes) * float64(time.Minute))
+
+	if err := s.reservations.HardReserve(ctx, driver.DriverID, loc.UserID, duration); err != nil {
+		log.Printf("Error assigning driver %s to user %s: %v", driver.DriverID, loc.UserID, err)
+		return
+	}
+	s.reservations.ReleaseAll(ctx, loc.UserID, driver.DriverID)
+	s.index.Remove(driver.DriverID)
+	s.onTrip[driver.DriverID] = true
+
+	now := s.clock.Now().Unix()
+	heap.Push(&s.trips, &trip{
+		driverID:  driver.DriverID,
+		riderID:   loc.UserID,
+		startedAt: now,
+		endsAt:    now + int64(duration.Seconds()),
+		dropLat:   dropLat,
+		dropLng:   dropLng,
+	})
+
+	s.metrics.Matched++
+	s.metrics.totalPickupETAMinutes += float64(accepted.ETA)
+}
+
+// completeTrips ends the trips finishing by the given time and makes their
+// drivers available again at the drop-off
+func (s *simulator) completeTrips(until int64) {
+	for len(s.trips) > 0 && s.trips[0].endsAt <= until {
+		t := heap.Pop(&s.trips).(*trip)
+		s.clock.now = time.Unix(t.endsAt, 0)
+
+		s.reservations.Release(context.Background(), t.driverID, t.riderID)
+		delete(s.onTrip, t.driverID)
+
+		driver := s.drivers[t.driverID]
+		driver.Latitude, driver.Longitude = t.dropLat, t.dropLng
+		driver.UpdatedAt = t.endsAt
+		driver.LastTripAt = t.endsAt
+		s.drivers[t.driverID] = driver
+		s.index.Upsert(driver)
+
+		s.metrics.busySeconds += t.endsAt - t.startedAt
+		s.metrics.CompletedTrips++
+	}
+}
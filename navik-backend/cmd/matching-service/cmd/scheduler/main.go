@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"matching-service/internal/config"
+	"matching-service/internal/repository"
+	"matching-service/internal/service"
+	"matching-service/pkg/kafka"
+	"navik-backend/pkg/redisclient"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func main() {
+	configFile := flag.String("config", "config.json", "Path to configuration file")
+	flag.Parse()
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	producer, err := kafka.NewProducer(cfg.Kafka.Brokers, cfg.Kafka.TopicFormat)
+	if err != nil {
+		log.Fatalf("Failed to create Kafka producer: %v", err)
+	}
+	defer producer.Close()
+
+	var events service.EventPublisher
+	if cfg.Events.Enabled {
+		eventProducer, err := kafka.NewProducer(cfg.Kafka.Brokers, cfg.Events.TopicFormat)
+		if err != nil {
+			log.Fatalf("Failed to create match event producer: %v", err)
+		}
+		events = service.NewEventPublisher(eventProducer, cfg.Events.QueueSize)
+		defer events.Close()
+	}
+
+	redisClient, err := redisclient.New(context.Background(), cfg.Redis)
+	if err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
+	}
+	defer redisClient.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Endpoint: aws.String(cfg.DynamoDB.Endpoint),
+		Region:   aws.String(cfg.DynamoDB.Region),
+		Credentials: credentials.NewStaticCredentials(
+			cfg.DynamoDB.AccessKey,
+			cfg.DynamoDB.SecretKey,
+			""),
+		DisableSSL: aws.Bool(true),
+	}))
+	driverRepo := repository.NewDriverRepository(dynamodb.New(sess), cfg.DynamoDB.TableName)
+
+	matchStream := repository.NewMatchStreamRepository(redisClient, cfg.Matching.StreamMaxLen,
+		time.Duration(cfg.Matching.StreamTTLSeconds)*time.Second)
+	searchRepo := repository.NewSearchRepository(redisClient,
+		time.Duration(cfg.Matching.SearchTTLSeconds)*time.Second)
+	reservationRepo := repository.NewReservationRepository(redisClient)
+	rideRepo := repository.NewScheduledRideRepository(redisClient,
+		time.Duration(cfg.Scheduling.RetentionHours)*time.Hour)
+
+	locationService := service.NewLocationService(searchRepo, producer, events)
+	traceRepo := repository.NewSearchTraceRepository(redisClient,
+		time.Duration(cfg.Matching.SearchTTLSeconds)*time.Second)
+	searchService := service.NewSearchService(searchRepo, traceRepo, reservationRepo,
+		repository.NewDriverStatsRepository(redisClient), matchStream, events)
+	scheduler := service.NewRideScheduler(rideRepo, locationService, searchService, matchStream,
+		service.NewCurrentSupplyForecaster(driverRepo), service.NewScheduledRideConfig(cfg))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go scheduler.Run(ctx)
+	log.Printf("Ride scheduler started, polling every %ds", cfg.Scheduling.PollIntervalSeconds)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	<-signals
+	log.Println("Received termination signal. Shutting down...")
+	cancel()
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// OriginChecker returns a CheckOrigin function for the WebSocket upgrader that
+// only accepts origins on the allow-list. Requests without an Origin header
+// come from native clients and are allowed; "*" allows every origin.
+func OriginChecker(allowedOrigins []string) func(r *http.Request) bool {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	allowAll := false
+	for _, origin := range allowedOrigins {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin == "*" {
+			allowAll = true
+		}
+		allowed[strings.ToLower(origin)] = true
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || allowAll {
+			return true
+		}
+		return allowed[strings.ToLower(strings.TrimRight(origin, "/"))]
+	}
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// BearerSubprotocol is the WebSocket subprotocol used to carry an access
+// token: clients send "bearer, <token>" and the server selects "bearer".
+const BearerSubprotocol = "bearer"
+
+// Authenticator resolves the caller of an HTTP request, WebSocket upgrade or
+// event stream
+type Authenticator struct {
+	validator *TokenValidator
+	tickets   *TicketStore
+}
+
+// NewAuthenticator creates an authenticator from a token validator and ticket store
+func NewAuthenticator(validator *TokenValidator, tickets *TicketStore) *Authenticator {
+	return &Authenticator{
+		validator: validator,
+		tickets:   tickets,
+	}
+}
+
+// Tickets returns the ticket store used for WebSocket tickets
+func (a *Authenticator) Tickets() *TicketStore {
+	return a.tickets
+}
+
+// AuthenticateRequest validates the bearer token in the Authorization header
+func (a *Authenticator) AuthenticateRequest(r *http.Request) (*Claims, error) {
+	return a.validator.Validate(r.Context(), bearerToken(r))
+}
+
+// AuthenticateUpgrade resolves the caller of a WebSocket upgrade. The token is
+// taken from the Authorization header, the bearer subprotocol or a ticket
+// query parameter, in that order. The returned response header selects the
+// bearer subprotocol when it was used.
+func (a *Authenticator) AuthenticateUpgrade(r *http.Request) (*Claims, http.Header, error) {
+	if token := bearerToken(r); token != "" {
+		claims, err := a.validator.Validate(r.Context(), token)
+		return claims, nil, err
+	}
+
+	if token := subprotocolToken(r); token != "" {
+		claims, err := a.validator.Validate(r.Context(), token)
+		if err != nil {
+			return nil, nil, err
+		}
+		header := http.Header{}
+		header.Set("Sec-WebSocket-Protocol", BearerSubprotocol)
+		return claims, header, nil
+	}
+
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" && a.tickets != nil {
+		claims, err := a.tickets.Redeem(r.Context(), ticket)
+		return claims, nil, err
+	}
+
+	return nil, nil, ErrMissingToken
+}
+
+// AuthenticateStream resolves the caller of a Server-Sent Events stream. The
+// token is taken from the Authorization header or, for EventSource clients
+// that cannot set headers, a ticket query parameter.
+func (a *Authenticator) AuthenticateStream(r *http.Request) (*Claims, error) {
+	if token := bearerToken(r); token != "" {
+		return a.validator.Validate(r.Context(), token)
+	}
+
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" && a.tickets != nil {
+		return a.tickets.Redeem(r.Context(), ticket)
+	}
+
+	return nil, ErrMissingToken
+}
+
+func bearerToken(r *http.Request) string {
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+}
+
+func subprotocolToken(r *http.Request) string {
+	protocols := websocket.Subprotocols(r)
+	for i, protocol := range protocols {
+		if protocol == BearerSubprotocol && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// TicketStore issues short-lived, single-use tickets that let clients which
+// cannot set headers on the upgrade request (browsers) open a WebSocket
+type TicketStore struct {
+	redisClient redis.UniversalClient
+	ttl         time.Duration
+}
+
+// NewTicketStore creates a ticket store backed by Redis
+func NewTicketStore(redisClient redis.UniversalClient, ttl time.Duration) *TicketStore {
+	return &TicketStore{
+		redisClient: redisClient,
+		ttl:         ttl,
+	}
+}
+
+// TTL returns how long an issued ticket remains valid
+func (s *TicketStore) TTL() time.Duration {
+	return s.ttl
+}
+
+// Issue stores the claims under a new random ticket
+func (s *TicketStore) Issue(ctx context.Context, claims *Claims) (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate ticket: %w", err)
+	}
+	ticket := hex.EncodeToString(buf)
+
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal claims: %w", err)
+	}
+
+	if err := s.redisClient.Set(ctx, ticketKey(ticket), data, s.ttl).Err(); err != nil {
+		return "", fmt.Errorf("failed to store ticket: %w", err)
+	}
+
+	return ticket, nil
+}
+
+// Redeem consumes a ticket and returns the claims it was issued for
+func (s *TicketStore) Redeem(ctx context.Context, ticket string) (*Claims, error) {
+	if ticket == "" {
+		return nil, ErrMissingToken
+	}
+
+	data, err := s.redisClient.GetDel(ctx, ticketKey(ticket)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to redeem ticket: %w", err)
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return &claims, nil
+}
+
+func ticketKey(ticket string) string {
+	return fmt.Sprintf("ws_ticket:%s", ticket)
+}
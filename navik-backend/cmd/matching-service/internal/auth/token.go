@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"navik-backend/pkg/redisclient"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrMissingToken = errors.New("authentication token is required")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// Claims holds the identity extracted from an access token issued by the
+// authentication service
+type Claims struct {
+	UserID   string
+	UserType string
+	TokenID  string
+}
+
+// TokenValidator verifies access tokens signed by the authentication service
+type TokenValidator struct {
+	secret      []byte
+	issuer      string
+	redisClient redis.UniversalClient
+}
+
+// NewTokenValidator creates a validator for HS256 access tokens. When a Redis
+// client is given, tokens revoked by the authentication service are rejected.
+func NewTokenValidator(secret, issuer string, redisClient redis.UniversalClient) *TokenValidator {
+	return &TokenValidator{
+		secret:      []byte(secret),
+		issuer:      issuer,
+		redisClient: redisClient,
+	}
+}
+
+// Validate parses and verifies an access token and returns its claims
+func (v *TokenValidator) Validate(ctx context.Context, tokenString string) (*Claims, error) {
+	if tokenString == "" {
+		return nil, ErrMissingToken
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return v.secret, nil
+	})
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	if v.issuer != "" && !claims.VerifyIssuer(v.issuer, true) {
+		return nil, ErrInvalidToken
+	}
+
+	userID, _ := claims["user_id"].(string)
+	if userID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	userType, _ := claims["user_type"].(string)
+	tokenID, _ := claims["token_id"].(string)
+
+	// Check if token is blacklisted
+	if v.redisClient != nil && tokenID != "" {
+		err := v.redisClient.Get(ctx, redisclient.BlacklistKey(tokenID)).Err()
+		if err == nil {
+			return nil, ErrInvalidToken
+		} else if err != redis.Nil {
+			log.Printf("Warning: Failed to check token blacklist: %v", err)
+		}
+	}
+
+	return &Claims{
+		UserID:   userID,
+		UserType: userType,
+		TokenID:  tokenID,
+	}, nil
+}
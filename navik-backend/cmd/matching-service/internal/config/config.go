@@ -5,6 +5,10 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"navik-backend/pkg/redisclient"
 )
 
 type Config struct {
@@ -13,10 +17,21 @@ type Config struct {
 		TopicFormat string   `json:"topic_format"`
 		GroupID     string   `json:"group_id"`
 		Topics      []string `json:"topics"`
+		Cities      []string `json:"cities"`
+		Workers     int      `json:"workers"`
+		QueueSize   int      `json:"queue_size"`
 	} `json:"kafka"`
+	// Events publishes match events to a topic per city
+	Events struct {
+		Enabled     bool   `json:"enabled"`
+		TopicFormat string `json:"topic_format"`
+		QueueSize   int    `json:"queue_size"`
+	} `json:"events"`
 	Server struct {
 		Port int `json:"port"`
 	} `json:"server"`
+	// Redis holds the connection settings shared by the API, consumer and scheduler
+	Redis    redisclient.Config `json:"redis"`
 	DynamoDB struct {
 		Endpoint  string `json:"endpoint"`
 		Region    string `json:"region"`
@@ -27,7 +42,149 @@ type Config struct {
 	Matching struct {
 		MinDriversToReturn int     `json:"min_drivers_to_return"`
 		MaxDistanceKm      float64 `json:"max_distance_km"`
+		StreamMaxLen       int64   `json:"stream_max_len"`
+		StreamTTLSeconds   int     `json:"stream_ttl_seconds"`
+		Mode               string  `json:"mode"`
+		BatchWindowMs      int     `json:"batch_window_ms"`
+		SearchTTLSeconds   int     `json:"search_ttl_seconds"`
 	} `json:"matching"`
+	DriverIndex struct {
+		Enabled     bool   `json:"enabled"`
+		TopicFormat string `json:"topic_format"`
+		TTLSeconds  int    `json:"ttl_seconds"`
+		Bootstrap   *bool  `json:"bootstrap"`
+	} `json:"driver_index"`
+	Ranking struct {
+		DefaultStrategy string                    `json:"default_strategy"`
+		CityStrategies  map[string]string         `json:"city_strategies"`
+		Strategies      map[string]RankingWeights `json:"strategies"`
+	} `json:"ranking"`
+	Search struct {
+		Timezone    string                        `json:"timezone"`
+		DefaultPlan string                        `json:"default_plan"`
+		Plans       map[string][]SearchStep       `json:"plans"`
+		CityPlans   map[string][]SearchPlanWindow `json:"city_plans"`
+		// Location is Timezone as loaded and validated by Load
+		Location *time.Location `json:"-"`
+	} `json:"search"`
+	Research struct {
+		Enabled                bool    `json:"enabled"`
+		WindowSeconds          int     `json:"window_seconds"`
+		InitialIntervalSeconds int     `json:"initial_interval_seconds"`
+		MinIntervalSeconds     int     `json:"min_interval_seconds"`
+		IntervalFactor         float64 `json:"interval_factor"`
+		MaxKRing               int     `json:"max_k_ring"`
+	} `json:"research"`
+	Pool struct {
+		Capacity         int     `json:"capacity"`
+		MaxWaitMinutes   float64 `json:"max_wait_minutes"`
+		MaxDetourMinutes float64 `json:"max_detour_minutes"`
+		MaxDetourRatio   float64 `json:"max_detour_ratio"`
+		BaseFare         float64 `json:"base_fare"`
+		PerKmFare        float64 `json:"per_km_fare"`
+		TripTTLHours     int     `json:"trip_ttl_hours"`
+	} `json:"pool"`
+	// Constraints sets the night hours, in the search timezone, during which
+	// riders' night-only constraints apply
+	Constraints struct {
+		NightStartHour int `json:"night_start_hour"`
+		NightEndHour   int `json:"night_end_hour"`
+	} `json:"constraints"`
+	// Nearby controls the live view of available cars on the rider home screen
+	Nearby struct {
+		IntervalSeconds int     `json:"interval_seconds"`
+		MaxRadiusKm     float64 `json:"max_radius_km"`
+		MaxCars         int     `json:"max_cars"`
+		SnapResolution  int     `json:"snap_resolution"`
+	} `json:"nearby"`
+	// Boundaries lists neighbouring cities that share drivers near their border
+	Boundaries []CityBoundary `json:"boundaries"`
+	// Experiments override matching config for a share of riders
+	Experiments []Experiment `json:"experiments"`
+	Scheduling  struct {
+		MinAdvanceMinutes   int `json:"min_advance_minutes"`
+		MaxAdvanceDays      int `json:"max_advance_days"`
+		MinLeadMinutes      int `json:"min_lead_minutes"`
+		MaxLeadMinutes      int `json:"max_lead_minutes"`
+		LowSupply           int `json:"low_supply"`
+		HighSupply          int `json:"high_supply"`
+		ReminderMinutes     int `json:"reminder_minutes"`
+		FreeCancelMinutes   int `json:"free_cancel_minutes"`
+		PollIntervalSeconds int `json:"poll_interval_seconds"`
+		RetentionHours      int `json:"retention_hours"`
+	} `json:"scheduling"`
+	Reservation struct {
+		OfferTTLSeconds      int `json:"offer_ttl_seconds"`
+		AssignmentTTLSeconds int `json:"assignment_ttl_seconds"`
+	} `json:"reservation"`
+	WebSocket struct {
+		SendQueueSize       int   `json:"send_queue_size"`
+		PingIntervalSeconds int   `json:"ping_interval_seconds"`
+		PongTimeoutSeconds  int   `json:"pong_timeout_seconds"`
+		WriteTimeoutSeconds int   `json:"write_timeout_seconds"`
+		MaxMessageBytes     int64 `json:"max_message_bytes"`
+	} `json:"websocket"`
+	Auth struct {
+		JWTAccessSecret  string   `json:"jwt_access_secret"`
+		JWTIssuer        string   `json:"jwt_issuer"`
+		AllowedOrigins   []string `json:"allowed_origins"`
+		TicketTTLSeconds int      `json:"ticket_ttl_seconds"`
+	} `json:"auth"`
+}
+
+// RankingWeights are the weights of a ranking strategy's signals
+type RankingWeights struct {
+	ETA        float64 `json:"eta"`
+	Rating     float64 `json:"rating"`
+	Acceptance float64 `json:"acceptance"`
+	Idle       float64 `json:"idle"`
+	Vehicle    float64 `json:"vehicle"`
+	Preference float64 `json:"preference"`
+}
+
+// SearchStep is one step of a driver search plan
+type SearchStep struct {
+	Resolution   int `json:"resolution"`
+	KRing        int `json:"k_ring"`
+	MinResults   int `json:"min_results"`
+	TimeBudgetMs int `json:"time_budget_ms"`
+}
+
+// SearchPlanWindow applies a search plan during an hour range of the day
+type SearchPlanWindow struct {
+	Plan      string `json:"plan"`
+	StartHour int    `json:"start_hour"`
+	EndHour   int    `json:"end_hour"`
+}
+
+// CityBoundary lets riders inside its zones be matched with drivers from any
+// of its cities
+type CityBoundary struct {
+	Cities []string       `json:"cities"`
+	Zones  []BoundaryZone `json:"zones"`
+}
+
+// BoundaryZone is a circular area around a city border
+type BoundaryZone struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	RadiusKm  float64 `json:"radius_km"`
+}
+
+// Experiment assigns a percentage of the riders of its cities, or of every
+// city if none are listed, to each of its arms
+type Experiment struct {
+	Name   string          `json:"name"`
+	Cities []string        `json:"cities"`
+	Arms   []ExperimentArm `json:"arms"`
+}
+
+// ExperimentArm overrides the ranking strategy or search plan for its riders
+type ExperimentArm struct {
+	Name            string `json:"name"`
+	Percent         int    `json:"percent"`
+	RankingStrategy string `json:"ranking_strategy"`
+	SearchPlan      string `json:"search_plan"`
 }
 
 // Load loads configuration from environment variables or a file
@@ -49,6 +206,30 @@ func Load(filename string) (*Config, error) {
 		config.Kafka.Brokers = strings.Split(brokers, ",")
 	}
 
+	if enabled := os.Getenv("DRIVER_INDEX_ENABLED"); enabled != "" {
+		config.DriverIndex.Enabled = enabled == "true"
+	}
+
+	if mode := os.Getenv("MATCHING_MODE"); mode != "" {
+		config.Matching.Mode = mode
+	}
+
+	if secret := os.Getenv("JWT_ACCESS_SECRET"); secret != "" {
+		config.Auth.JWTAccessSecret = secret
+	}
+
+	if origins := os.Getenv("WS_ALLOWED_ORIGINS"); origins != "" {
+		config.Auth.AllowedOrigins = strings.Split(origins, ",")
+	}
+
+	if addrs := os.Getenv("REDIS_ADDRS"); addrs != "" {
+		config.Redis.Addrs = strings.Split(addrs, ",")
+	}
+
+	if password := os.Getenv("REDIS_PASSWORD"); password != "" {
+		config.Redis.Password = password
+	}
+
 	// Set defaults
 	if len(config.Kafka.Brokers) == 0 {
 		config.Kafka.Brokers = []string{"localhost:9092"}
@@ -66,10 +247,32 @@ func Load(filename string) (*Config, error) {
 		config.Kafka.Topics = []string{"mumbai-users", "pune-users", "delhi-users"}
 	}
 
+	if len(config.Kafka.Cities) == 0 {
+		config.Kafka.Cities = []string{"mumbai", "pune", "delhi"}
+	}
+
+	if config.Kafka.Workers == 0 {
+		config.Kafka.Workers = 64
+	}
+
+	if config.Kafka.QueueSize == 0 {
+		config.Kafka.QueueSize = 32
+	}
+
+	if config.Kafka.Workers < 0 || config.Kafka.QueueSize < 0 {
+		return nil, fmt.Errorf("invalid kafka workers %d or queue size %d: must not be negative",
+			config.Kafka.Workers, config.Kafka.QueueSize)
+	}
+
 	if config.Server.Port == 0 {
 		config.Server.Port = 8080
 	}
 
+	config.Redis.SetDefaults()
+	if err := config.Redis.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid redis config: %w", err)
+	}
+
 	if config.DynamoDB.Endpoint == "" {
 		config.DynamoDB.Endpoint = "http://localhost:8000"
 	}
@@ -90,5 +293,316 @@ func Load(filename string) (*Config, error) {
 		config.Matching.MaxDistanceKm = 10.0
 	}
 
+	if config.Matching.StreamMaxLen == 0 {
+		config.Matching.StreamMaxLen = 100
+	}
+
+	if config.Matching.StreamTTLSeconds == 0 {
+		config.Matching.StreamTTLSeconds = 900
+	}
+
+	if config.Matching.Mode == "" {
+		config.Matching.Mode = "greedy"
+	}
+
+	if config.Matching.Mode != "greedy" && config.Matching.Mode != "batched" {
+		return nil, fmt.Errorf("invalid matching mode %q: must be greedy or batched", config.Matching.Mode)
+	}
+
+	if config.Matching.BatchWindowMs == 0 {
+		config.Matching.BatchWindowMs = 2000
+	}
+
+	if config.Events.TopicFormat == "" {
+		config.Events.TopicFormat = "%s-match-events"
+	}
+
+	if config.Events.QueueSize == 0 {
+		config.Events.QueueSize = 1024
+	}
+
+	if config.DriverIndex.TopicFormat == "" {
+		config.DriverIndex.TopicFormat = "%s-locations"
+	}
+
+	if config.DriverIndex.TTLSeconds == 0 {
+		config.DriverIndex.TTLSeconds = 120
+	}
+
+	if config.DriverIndex.Bootstrap == nil {
+		bootstrap := true
+		config.DriverIndex.Bootstrap = &bootstrap
+	}
+
+	if config.Matching.SearchTTLSeconds == 0 {
+		config.Matching.SearchTTLSeconds = 3600
+	}
+
+	if config.Ranking.DefaultStrategy == "" {
+		config.Ranking.DefaultStrategy = "nearest"
+	}
+
+	if config.Search.Timezone == "" {
+		config.Search.Timezone = "Asia/Kolkata"
+	}
+
+	location, err := time.LoadLocation(config.Search.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid search timezone %q: %w", config.Search.Timezone, err)
+	}
+	config.Search.Location = location
+
+	if config.Search.DefaultPlan == "" {
+		config.Search.DefaultPlan = "default"
+	}
+
+	for name, steps := range config.Search.Plans {
+		if len(steps) == 0 {
+			return nil, fmt.Errorf("search plan %q has no steps", name)
+		}
+		for _, step := range steps {
+			// Drivers are indexed at H3 resolutions 7 to 9 only
+			if step.Resolution < 7 || step.Resolution > 9 || step.KRing < 0 {
+				return nil, fmt.Errorf("search plan %q has invalid step: resolution %d, k_ring %d",
+					name, step.Resolution, step.KRing)
+			}
+		}
+	}
+
+	// "default" is the built-in plan, which configured plans may override
+	if _, ok := config.Search.Plans[config.Search.DefaultPlan]; !ok && config.Search.DefaultPlan != "default" {
+		return nil, fmt.Errorf("default search plan %q is not a configured plan", config.Search.DefaultPlan)
+	}
+
+	for city, windows := range config.Search.CityPlans {
+		for _, window := range windows {
+			if window.StartHour < 0 || window.StartHour > 23 || window.EndHour < 0 || window.EndHour > 24 {
+				return nil, fmt.Errorf("search plan window for city %s has invalid hours %d-%d",
+					city, window.StartHour, window.EndHour)
+			}
+			if _, ok := config.Search.Plans[window.Plan]; !ok && window.Plan != "default" {
+				return nil, fmt.Errorf("search plan window for city %s uses unknown search plan %q", city, window.Plan)
+			}
+		}
+	}
+
+	if config.Research.WindowSeconds == 0 {
+		config.Research.WindowSeconds = 120
+	}
+
+	if config.Research.InitialIntervalSeconds == 0 {
+		config.Research.InitialIntervalSeconds = 10
+	}
+
+	if config.Research.MinIntervalSeconds == 0 {
+		config.Research.MinIntervalSeconds = 3
+	}
+
+	if config.Research.IntervalFactor == 0 {
+		config.Research.IntervalFactor = 0.7
+	}
+
+	if config.Research.IntervalFactor < 0 || config.Research.IntervalFactor > 1 {
+		return nil, fmt.Errorf("invalid research interval factor %v: must be between 0 and 1", config.Research.IntervalFactor)
+	}
+
+	if config.Research.MaxKRing == 0 {
+		config.Research.MaxKRing = 4
+	}
+
+	if config.Pool.Capacity == 0 {
+		config.Pool.Capacity = 3
+	}
+
+	if config.Pool.MaxWaitMinutes == 0 {
+		config.Pool.MaxWaitMinutes = 8
+	}
+
+	if config.Pool.MaxDetourMinutes == 0 {
+		config.Pool.MaxDetourMinutes = 10
+	}
+
+	if config.Pool.MaxDetourRatio == 0 {
+		config.Pool.MaxDetourRatio = 0.5
+	}
+
+	if config.Pool.BaseFare == 0 {
+		config.Pool.BaseFare = 30
+	}
+
+	if config.Pool.PerKmFare == 0 {
+		config.Pool.PerKmFare = 8
+	}
+
+	if config.Pool.TripTTLHours == 0 {
+		config.Pool.TripTTLHours = 4
+	}
+
+	// Midnight to midnight would make every hour night, so unset hours take
+	// the defaults
+	if config.Constraints.NightStartHour == 0 && config.Constraints.NightEndHour == 0 {
+		config.Constraints.NightStartHour = 22
+		config.Constraints.NightEndHour = 6
+	}
+
+	if config.Constraints.NightStartHour < 0 || config.Constraints.NightStartHour > 23 ||
+		config.Constraints.NightEndHour < 0 || config.Constraints.NightEndHour > 23 {
+		return nil, fmt.Errorf("invalid night hours %d-%d: must be between 0 and 23",
+			config.Constraints.NightStartHour, config.Constraints.NightEndHour)
+	}
+
+	if config.Nearby.IntervalSeconds == 0 {
+		config.Nearby.IntervalSeconds = 5
+	}
+
+	if config.Nearby.MaxRadiusKm == 0 {
+		config.Nearby.MaxRadiusKm = 3
+	}
+
+	if config.Nearby.MaxCars == 0 {
+		config.Nearby.MaxCars = 25
+	}
+
+	if config.Nearby.SnapResolution == 0 {
+		config.Nearby.SnapResolution = 9
+	}
+
+	// Finer cells than H10 would reveal drivers' exact positions
+	if config.Nearby.SnapResolution < 7 || config.Nearby.SnapResolution > 10 {
+		return nil, fmt.Errorf("invalid nearby snap resolution %d: must be between 7 and 10", config.Nearby.SnapResolution)
+	}
+
+	for _, boundary := range config.Boundaries {
+		if len(boundary.Cities) < 2 || len(boundary.Zones) == 0 {
+			return nil, fmt.Errorf("city boundary %v must name at least two cities and one zone", boundary.Cities)
+		}
+		for _, zone := range boundary.Zones {
+			if zone.RadiusKm <= 0 || zone.Latitude < -90 || zone.Latitude > 90 || zone.Longitude < -180 || zone.Longitude > 180 {
+				return nil, fmt.Errorf("city boundary %v has invalid zone at %v,%v with radius %v km",
+					boundary.Cities, zone.Latitude, zone.Longitude, zone.RadiusKm)
+			}
+		}
+	}
+
+	experimentNames := make(map[string]bool)
+	for _, experiment := range config.Experiments {
+		if experiment.Name == "" || experimentNames[experiment.Name] {
+			return nil, fmt.Errorf("experiment name %q is empty or not unique", experiment.Name)
+		}
+		experimentNames[experiment.Name] = true
+
+		armNames := map[string]bool{"control": true}
+		total := 0
+		for _, arm := range experiment.Arms {
+			if arm.Name == "" || armNames[arm.Name] {
+				return nil, fmt.Errorf("experiment %s has an empty, duplicate or reserved arm name %q", experiment.Name, arm.Name)
+			}
+			armNames[arm.Name] = true
+			if arm.Percent <= 0 {
+				return nil, fmt.Errorf("experiment %s arm %s must have a positive percent", experiment.Name, arm.Name)
+			}
+			total += arm.Percent
+			if arm.SearchPlan != "" && arm.SearchPlan != "default" {
+				if _, ok := config.Search.Plans[arm.SearchPlan]; !ok {
+					return nil, fmt.Errorf("experiment %s arm %s uses unknown search plan %q", experiment.Name, arm.Name, arm.SearchPlan)
+				}
+			}
+		}
+		if total > 100 {
+			return nil, fmt.Errorf("experiment %s assigns %d%% of riders to its arms", experiment.Name, total)
+		}
+	}
+
+	if config.Scheduling.MinAdvanceMinutes == 0 {
+		config.Scheduling.MinAdvanceMinutes = 30
+	}
+
+	if config.Scheduling.MaxAdvanceDays == 0 {
+		config.Scheduling.MaxAdvanceDays = 7
+	}
+
+	if config.Scheduling.MinLeadMinutes == 0 {
+		config.Scheduling.MinLeadMinutes = 5
+	}
+
+	if config.Scheduling.MaxLeadMinutes == 0 {
+		config.Scheduling.MaxLeadMinutes = 20
+	}
+
+	if config.Scheduling.MinLeadMinutes > config.Scheduling.MaxLeadMinutes ||
+		config.Scheduling.MaxLeadMinutes > config.Scheduling.MinAdvanceMinutes {
+		return nil, fmt.Errorf("invalid scheduling lead times %d-%d minutes: must be ordered and within the minimum advance of %d minutes",
+			config.Scheduling.MinLeadMinutes, config.Scheduling.MaxLeadMinutes, config.Scheduling.MinAdvanceMinutes)
+	}
+
+	if config.Scheduling.LowSupply == 0 {
+		config.Scheduling.LowSupply = 2
+	}
+
+	if config.Scheduling.HighSupply == 0 {
+		config.Scheduling.HighSupply = 10
+	}
+
+	if config.Scheduling.HighSupply <= config.Scheduling.LowSupply {
+		return nil, fmt.Errorf("invalid scheduling supply thresholds %d-%d",
+			config.Scheduling.LowSupply, config.Scheduling.HighSupply)
+	}
+
+	if config.Scheduling.ReminderMinutes == 0 {
+		config.Scheduling.ReminderMinutes = 30
+	}
+
+	if config.Scheduling.FreeCancelMinutes == 0 {
+		config.Scheduling.FreeCancelMinutes = 60
+	}
+
+	if config.Scheduling.PollIntervalSeconds == 0 {
+		config.Scheduling.PollIntervalSeconds = 5
+	}
+
+	if config.Scheduling.RetentionHours == 0 {
+		config.Scheduling.RetentionHours = 24
+	}
+
+	if config.Reservation.OfferTTLSeconds == 0 {
+		config.Reservation.OfferTTLSeconds = 30
+	}
+
+	if config.Reservation.AssignmentTTLSeconds == 0 {
+		config.Reservation.AssignmentTTLSeconds = 7200
+	}
+
+	if config.WebSocket.SendQueueSize == 0 {
+		config.WebSocket.SendQueueSize = 64
+	}
+
+	if config.WebSocket.PingIntervalSeconds == 0 {
+		config.WebSocket.PingIntervalSeconds = 25
+	}
+
+	if config.WebSocket.PongTimeoutSeconds == 0 {
+		config.WebSocket.PongTimeoutSeconds = 60
+	}
+
+	if config.WebSocket.WriteTimeoutSeconds == 0 {
+		config.WebSocket.WriteTimeoutSeconds = 10
+	}
+
+	if config.WebSocket.MaxMessageBytes == 0 {
+		config.WebSocket.MaxMessageBytes = 4096
+	}
+
+	if config.Auth.JWTAccessSecret == "" {
+		config.Auth.JWTAccessSecret = "your-access-secret-key"
+	}
+
+	if config.Auth.JWTIssuer == "" {
+		config.Auth.JWTIssuer = "auth-service"
+	}
+
+	if config.Auth.TicketTTLSeconds == 0 {
+		config.Auth.TicketTTLSeconds = 30
+	}
+
 	return &config, nil
 }
@@ -0,0 +1,306 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadJSON loads a config file with the given contents
+func loadJSON(t *testing.T, contents string) (*Config, error) {
+	t.Helper()
+	t.Setenv("MATCHING_MODE", "")
+	filename := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(filename, []byte(contents), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return Load(filename)
+}
+
+func TestLoadValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{name: "defaults", config: `{}`},
+		{name: "greedy mode", config: `{"matching": {"mode": "greedy"}}`},
+		{name: "batched mode", config: `{"matching": {"mode": "batched"}}`},
+		{name: "unknown mode", config: `{"matching": {"mode": "auction"}}`, wantErr: "invalid matching mode"},
+		{name: "unknown timezone", config: `{"search": {"timezone": "Mars/Olympus"}}`, wantErr: "invalid search timezone"},
+		{
+			name:   "search plan",
+			config: `{"search": {"plans": {"wide": [{"resolution": 9, "k_ring": 0}, {"resolution": 7, "k_ring": 2}]}}}`,
+		},
+		{name: "search plan without steps", config: `{"search": {"plans": {"wide": []}}}`, wantErr: "has no steps"},
+		{
+			name:    "search step too fine",
+			config:  `{"search": {"plans": {"wide": [{"resolution": 10, "k_ring": 0}]}}}`,
+			wantErr: "invalid step",
+		},
+		{
+			name:    "search step too coarse",
+			config:  `{"search": {"plans": {"wide": [{"resolution": 6, "k_ring": 0}]}}}`,
+			wantErr: "invalid step",
+		},
+		{
+			name:    "negative k-ring",
+			config:  `{"search": {"plans": {"wide": [{"resolution": 8, "k_ring": -1}]}}}`,
+			wantErr: "invalid step",
+		},
+		{
+			name:   "search plan window to midnight",
+			config: `{"search": {"city_plans": {"pune": [{"plan": "default", "start_hour": 20, "end_hour": 24}]}}}`,
+		},
+		{
+			name:    "search plan window start hour",
+			config:  `{"search": {"city_plans": {"pune": [{"plan": "default", "start_hour": 24, "end_hour": 6}]}}}`,
+			wantErr: "invalid hours",
+		},
+		{
+			name:    "search plan window end hour",
+			config:  `{"search": {"city_plans": {"pune": [{"plan": "default", "start_hour": 22, "end_hour": 25}]}}}`,
+			wantErr: "invalid hours",
+		},
+		{
+			name:   "experiment",
+			config: `{"experiments": [{"name": "eta", "arms": [{"name": "fair", "percent": 20, "ranking_strategy": "fairness"}]}]}`,
+		},
+		{
+			name:    "experiment without name",
+			config:  `{"experiments": [{"arms": [{"name": "a", "percent": 10}]}]}`,
+			wantErr: "experiment name",
+		},
+		{
+			name:    "duplicate experiment",
+			config:  `{"experiments": [{"name": "eta"}, {"name": "eta"}]}`,
+			wantErr: "not unique",
+		},
+		{
+			name:    "control arm",
+			config:  `{"experiments": [{"name": "eta", "arms": [{"name": "control", "percent": 10}]}]}`,
+			wantErr: "reserved arm name",
+		},
+		{
+			name:    "duplicate arm",
+			config:  `{"experiments": [{"name": "eta", "arms": [{"name": "a", "percent": 10}, {"name": "a", "percent": 10}]}]}`,
+			wantErr: "duplicate",
+		},
+		{
+			name:    "arm without riders",
+			config:  `{"experiments": [{"name": "eta", "arms": [{"name": "a", "percent": 0}]}]}`,
+			wantErr: "positive percent",
+		},
+		{
+			name:    "arms over 100 percent",
+			config:  `{"experiments": [{"name": "eta", "arms": [{"name": "a", "percent": 60}, {"name": "b", "percent": 50}]}]}`,
+			wantErr: "assigns 110%",
+		},
+		{
+			name:    "arm with unknown search plan",
+			config:  `{"experiments": [{"name": "eta", "arms": [{"name": "a", "percent": 10, "search_plan": "wide"}]}]}`,
+			wantErr: "unknown search plan",
+		},
+		{
+			name: "arm with configured search plan",
+			config: `{"search": {"plans": {"wide": [{"resolution": 7, "k_ring": 1}]}},
+				"experiments": [{"name": "eta", "arms": [{"name": "a", "percent": 10, "search_plan": "wide"}]}]}`,
+		},
+		{name: "research interval factor", config: `{"research": {"interval_factor": 0.5}}`},
+		{name: "research interval factor of one", config: `{"research": {"interval_factor": 1}}`},
+		{
+			name:    "negative research interval factor",
+			config:  `{"research": {"interval_factor": -0.5}}`,
+			wantErr: "invalid research interval factor",
+		},
+		{
+			name:    "growing research interval",
+			config:  `{"research": {"interval_factor": 1.5}}`,
+			wantErr: "invalid research interval factor",
+		},
+		{
+			name:   "scheduling lead times",
+			config: `{"scheduling": {"min_advance_minutes": 60, "min_lead_minutes": 10, "max_lead_minutes": 40}}`,
+		},
+		{
+			name:    "scheduling lead times out of order",
+			config:  `{"scheduling": {"min_lead_minutes": 15, "max_lead_minutes": 10}}`,
+			wantErr: "invalid scheduling lead times",
+		},
+		{
+			name:    "scheduling lead beyond minimum advance",
+			config:  `{"scheduling": {"min_advance_minutes": 15, "max_lead_minutes": 20}}`,
+			wantErr: "invalid scheduling lead times",
+		},
+		{
+			name:    "scheduling supply thresholds out of order",
+			config:  `{"scheduling": {"low_supply": 5, "high_supply": 5}}`,
+			wantErr: "invalid scheduling supply thresholds",
+		},
+		{
+			name: "city boundary",
+			config: `{"boundaries": [{"cities": ["mumbai", "pune"],
+				"zones": [{"latitude": 18.8, "longitude": 73.3, "radius_km": 15}]}]}`,
+		},
+		{
+			name: "city boundary with one city",
+			config: `{"boundaries": [{"cities": ["mumbai"],
+				"zones": [{"latitude": 18.8, "longitude": 73.3, "radius_km": 15}]}]}`,
+			wantErr: "at least two cities",
+		},
+		{
+			name:    "city boundary without zones",
+			config:  `{"boundaries": [{"cities": ["mumbai", "pune"]}]}`,
+			wantErr: "at least two cities and one zone",
+		},
+		{
+			name: "city boundary zone without radius",
+			config: `{"boundaries": [{"cities": ["mumbai", "pune"],
+				"zones": [{"latitude": 18.8, "longitude": 73.3}]}]}`,
+			wantErr: "invalid zone",
+		},
+		{
+			name: "city boundary zone off the map",
+			config: `{"boundaries": [{"cities": ["mumbai", "pune"],
+				"zones": [{"latitude": 98.8, "longitude": 73.3, "radius_km": 15}]}]}`,
+			wantErr: "invalid zone",
+		},
+		{name: "nearby snap resolution", config: `{"nearby": {"snap_resolution": 10}}`},
+		{
+			name:    "nearby snap too fine",
+			config:  `{"nearby": {"snap_resolution": 11}}`,
+			wantErr: "invalid nearby snap resolution",
+		},
+		{
+			name:    "nearby snap too coarse",
+			config:  `{"nearby": {"snap_resolution": 6}}`,
+			wantErr: "invalid nearby snap resolution",
+		},
+		{name: "night hours", config: `{"constraints": {"night_start_hour": 23, "night_end_hour": 5}}`},
+		{name: "night from midnight", config: `{"constraints": {"night_start_hour": 0, "night_end_hour": 5}}`},
+		{
+			name:    "night start hour",
+			config:  `{"constraints": {"night_start_hour": 24, "night_end_hour": 5}}`,
+			wantErr: "invalid night hours",
+		},
+		{
+			name:    "negative night end hour",
+			config:  `{"constraints": {"night_start_hour": 22, "night_end_hour": -1}}`,
+			wantErr: "invalid night hours",
+		},
+		{
+			name:   "configured default plan",
+			config: `{"search": {"default_plan": "wide", "plans": {"wide": [{"resolution": 7, "k_ring": 1}]}}}`,
+		},
+		{name: "unknown default plan", config: `{"search": {"default_plan": "wdie"}}`, wantErr: "default search plan"},
+		{
+			name: "search plan window with configured plan",
+			config: `{"search": {"plans": {"wide": [{"resolution": 7, "k_ring": 1}]},
+				"city_plans": {"pune": [{"plan": "wide", "start_hour": 22, "end_hour": 6}]}}}`,
+		},
+		{
+			name:    "search plan window with unknown plan",
+			config:  `{"search": {"city_plans": {"pune": [{"plan": "wide", "start_hour": 22, "end_hour": 6}]}}}`,
+			wantErr: "unknown search plan",
+		},
+		{name: "kafka workers", config: `{"kafka": {"workers": 8, "queue_size": 4}}`},
+		{name: "negative kafka workers", config: `{"kafka": {"workers": -1}}`, wantErr: "invalid kafka workers"},
+		{name: "negative kafka queue size", config: `{"kafka": {"queue_size": -4}}`, wantErr: "invalid kafka workers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadJSON(t, tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Load: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadMatchingMode(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		env    string
+		want   string
+	}{
+		{name: "default", config: `{}`, want: "greedy"},
+		{name: "from file", config: `{"matching": {"mode": "batched"}}`, want: "batched"},
+		{name: "env overrides file", config: `{"matching": {"mode": "greedy"}}`, env: "batched", want: "batched"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(filename, []byte(tt.config), 0o600); err != nil {
+				t.Fatalf("write config: %v", err)
+			}
+			t.Setenv("MATCHING_MODE", tt.env)
+
+			cfg, err := Load(filename)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Matching.Mode != tt.want {
+				t.Errorf("mode = %q, want %q", cfg.Matching.Mode, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSearchTimezone(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{name: "default", config: `{}`, want: "Asia/Kolkata"},
+		{name: "configured", config: `{"search": {"timezone": "Europe/London"}}`, want: "Europe/London"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadJSON(t, tt.config)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Search.Timezone != tt.want || cfg.Search.Location == nil || cfg.Search.Location.String() != tt.want {
+				t.Errorf("timezone = %q, location %v, want %q", cfg.Search.Timezone, cfg.Search.Location, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadNightHours(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		wantStart int
+		wantEnd   int
+	}{
+		{name: "default", config: `{}`, wantStart: 22, wantEnd: 6},
+		{name: "configured", config: `{"constraints": {"night_start_hour": 21, "night_end_hour": 5}}`, wantStart: 21, wantEnd: 5},
+		{name: "ends at midnight", config: `{"constraints": {"night_start_hour": 20, "night_end_hour": 0}}`, wantStart: 20, wantEnd: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadJSON(t, tt.config)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Constraints.NightStartHour != tt.wantStart || cfg.Constraints.NightEndHour != tt.wantEnd {
+				t.Errorf("night hours = %d-%d, want %d-%d",
+					cfg.Constraints.NightStartHour, cfg.Constraints.NightEndHour, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"matching-service/internal/auth"
+	"matching-service/internal/model"
+	"matching-service/internal/repository"
+	"matching-service/internal/service"
+)
+
+type BlockHandler struct {
+	service       service.BlockService
+	authenticator *auth.Authenticator
+}
+
+func NewBlockHandler(service service.BlockService, authenticator *auth.Authenticator) *BlockHandler {
+	return &BlockHandler{
+		service:       service,
+		authenticator: authenticator,
+	}
+}
+
+// blockRequest is a block by a rider or driver, who names the other side as
+// user_id, or by an admin, who names both
+type blockRequest struct {
+	UserID   string `json:"user_id"`
+	RiderID  string `json:"rider_id"`
+	DriverID string `json:"driver_id"`
+	Reason   string `json:"reason"`
+}
+
+// HandleBlocks lists, adds and removes the caller's blocks. Riders and drivers
+// manage the blocks they made; admins manage blocks of any pair.
+func (h *BlockHandler) HandleBlocks(w http.ResponseWriter, r *http.Request) {
+	claims, err := h.authenticator.AuthenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	blockedBy := blockSource(claims.UserType)
+	if blockedBy == "" {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.listBlocks(w, r, claims.UserID, blockedBy)
+	case http.MethodPost:
+		h.block(w, r, claims.UserID, blockedBy)
+	case http.MethodDelete:
+		h.unblock(w, r, claims.UserID, blockedBy)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// listBlocks returns the blocks the caller made. Riders and drivers never
+// learn that the other side blocked them. Admins list every block of the
+// user_id in the query.
+func (h *BlockHandler) listBlocks(w http.ResponseWriter, r *http.Request, userID, blockedBy string) {
+	if blockedBy == model.BlockedByAdmin {
+		userID = r.URL.Query().Get("user_id")
+		blockedBy = ""
+		if userID == "" {
+			http.Error(w, "Missing user_id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	blocks, err := h.service.ListBlocks(r.Context(), userID, blockedBy)
+	if err != nil {
+		log.Printf("Error listing blocks: %v", err)
+		http.Error(w, "Failed to list blocks", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(blocks)
+}
+
+func (h *BlockHandler) block(w http.ResponseWriter, r *http.Request, userID, blockedBy string) {
+	var req blockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	riderID, driverID := blockPair(userID, blockedBy, req.UserID, req.RiderID, req.DriverID)
+	block, err := h.service.Block(r.Context(), model.Block{
+		RiderID:   riderID,
+		DriverID:  driverID,
+		BlockedBy: blockedBy,
+		Reason:    req.Reason,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidBlock) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error blocking: %v", err)
+		http.Error(w, "Failed to block", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(block)
+}
+
+// unblock removes the caller's block of the pair named in the query, as
+// user_id for riders and drivers and rider_id and driver_id for admins
+func (h *BlockHandler) unblock(w http.ResponseWriter, r *http.Request, userID, blockedBy string) {
+	query := r.URL.Query()
+	riderID, driverID := blockPair(userID, blockedBy, query.Get("user_id"), query.Get("rider_id"), query.Get("driver_id"))
+
+	err := h.service.Unblock(r.Context(), riderID, driverID, blockedBy)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidBlock) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, repository.ErrBlockNotFound) {
+			http.Error(w, "Block not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error unblocking: %v", err)
+		http.Error(w, "Failed to unblock", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// blockSource returns who a user of the given type blocks as, or "" if they
+// cannot block
+func blockSource(userType string) string {
+	switch userType {
+	case "customer":
+		return model.BlockedByRider
+	case "driver":
+		return model.BlockedByDriver
+	case "admin":
+		return model.BlockedByAdmin
+	}
+	return ""
+}
+
+// blockPair returns the rider and driver of a block. Riders and drivers are
+// always one side of their blocks.
+func blockPair(userID, blockedBy, otherID, riderID, driverID string) (string, string) {
+	switch blockedBy {
+	case model.BlockedByRider:
+		return userID, otherID
+	case model.BlockedByDriver:
+		return otherID, userID
+	}
+	return riderID, driverID
+}
+
+func (h *BlockHandler) SetupRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/matching/blocks", h.HandleBlocks)
+}
@@ -12,90 +12,99 @@ import (
 	"github.com/IBM/sarama"
 )
 
+// PartitionPauser suspends and resumes fetching from partitions
+type PartitionPauser interface {
+	Pause(partitions map[string][]int32)
+	Resume(partitions map[string][]int32)
+}
+
 type ConsumerGroupHandler struct {
-	service       service.MatchingService
-	activeWorkers sync.WaitGroup
-	processingMap sync.Map // To track messages being processed
+	service   service.MatchingService
+	pauser    PartitionPauser
+	workers   int
+	queueSize int
+
+	mu   sync.Mutex
+	pool *workerPool
 }
 
-func NewConsumerGroupHandler(service service.MatchingService) *ConsumerGroupHandler {
+// NewConsumerGroupHandler creates a handler that processes messages on a
+// bounded pool of workers, serialising the messages of each user
+func NewConsumerGroupHandler(service service.MatchingService, pauser PartitionPauser, workers, queueSize int) *ConsumerGroupHandler {
 	return &ConsumerGroupHandler{
-		service: service,
+		service:   service,
+		pauser:    pauser,
+		workers:   workers,
+		queueSize: queueSize,
 	}
 }
 
 func (h *ConsumerGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
 	log.Printf("Consumer group session started: %s", session.MemberID())
+
+	h.mu.Lock()
+	h.pool = newWorkerPool(h.workers, h.queueSize, func(msg *sarama.ConsumerMessage, done func()) {
+		h.processMessage(session, msg, done)
+	})
+	h.mu.Unlock()
 	return nil
 }
 
 // Cleanup is called when the consumer group session is ending
 func (h *ConsumerGroupHandler) Cleanup(session sarama.ConsumerGroupSession) error {
 	log.Printf("Consumer group session ending: %s", session.MemberID())
-	h.activeWorkers.Wait()
+
+	h.mu.Lock()
+	pool := h.pool
+	h.pool = nil
+	h.mu.Unlock()
+
+	if pool != nil {
+		pool.stop()
+	}
 	return nil
 }
 
-// ConsumeClaim processes messages from a partition claim
+// ConsumeClaim dispatches messages from a partition claim to the worker pool.
+// Offsets are committed only once every earlier message of the partition has
+// been processed.
 func (h *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	log.Printf("Starting to consume from topic: %s, partition: %d, initial offset: %d",
 		claim.Topic(), claim.Partition(), claim.InitialOffset())
 
-	// Process messages from the claim
+	h.mu.Lock()
+	pool := h.pool
+	h.mu.Unlock()
+
+	tracker := newOffsetTracker(func(offset int64) {
+		session.MarkOffset(claim.Topic(), claim.Partition(), offset, "")
+	})
+	partition := map[string][]int32{claim.Topic(): {claim.Partition()}}
+
 	for message := range claim.Messages() {
-		// Check if context is done
+		msg := message
+		tracker.add(msg.Offset)
+		j := job{msg: msg, done: func() { tracker.complete(msg.Offset) }}
+		queue := pool.queueFor(messageKey(msg))
+
 		select {
+		case queue <- j:
+			continue
 		case <-session.Context().Done():
 			return nil
 		default:
-			// Generate a unique message ID for tracking
-			msgID := generateMessageID(message)
-
-			// Check if already processing this message (avoid duplicates in case of rebalance)
-			if _, exists := h.processingMap.LoadOrStore(msgID, true); exists {
-				log.Printf("Skipping duplicate message: %s", msgID)
-				session.MarkMessage(message, "")
-				continue
-			}
-
-			// Process the message
-			h.activeWorkers.Add(1)
-			go func(msg *sarama.ConsumerMessage) {
-				defer h.activeWorkers.Done()
-				defer h.processingMap.Delete(msgID)
-
-				startTime := time.Now()
-
-				var userLoc model.UserLocation
-				if err := json.Unmarshal(msg.Value, &userLoc); err != nil {
-					log.Printf("Error unmarshaling message: %v, content: %s",
-						err, string(msg.Value))
-					session.MarkMessage(msg, "")
-					return
-				}
-
-				log.Printf("Processing message: topic=%s, partition=%d, offset=%d, key=%s, user=%s",
-					msg.Topic, msg.Partition, msg.Offset, string(msg.Key), userLoc.UserID)
-
-				if time.Now().Unix()-userLoc.Timestamp > 300 {
-					log.Printf("Skipping stale location update for user %s (%.2f minutes old)",
-						userLoc.UserID, float64(time.Now().Unix()-userLoc.Timestamp)/60)
-					session.MarkMessage(msg, "")
-					return
-				}
-
-				if err := h.service.ProcessUserLocation(session.Context(), userLoc); err != nil {
-					log.Printf("Error processing user location: %v", err)
-				}
-
-				// Mark message as processed
-				session.MarkMessage(msg, "")
-
-				elapsed := time.Since(startTime)
-				log.Printf("Finished processing message in %v: topic=%s, partition=%d, offset=%d",
-					elapsed, msg.Topic, msg.Partition, msg.Offset)
-
-			}(message)
+		}
+
+		// The worker is saturated: stop fetching this partition until it
+		// accepts the message
+		log.Printf("Worker queue full, pausing topic: %s, partition: %d", claim.Topic(), claim.Partition())
+		h.pauser.Pause(partition)
+		select {
+		case queue <- j:
+			h.pauser.Resume(partition)
+		case <-session.Context().Done():
+			h.pauser.Resume(partition)
+			return nil
 		}
 	}
 
@@ -104,7 +113,49 @@ func (h *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession,
 	return nil
 }
 
-// generateMessageID creates a unique ID for a message based on topic, partition, and offset
-func generateMessageID(msg *sarama.ConsumerMessage) string {
-	return msg.Topic + "-" + string(msg.Key)
+// processMessage matches a single user location message and calls done once
+// it has been handled, so its offset can be committed
+func (h *ConsumerGroupHandler) processMessage(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage, done func()) {
+	startTime := time.Now()
+
+	var userLoc model.UserLocation
+	if err := json.Unmarshal(msg.Value, &userLoc); err != nil {
+		log.Printf("Error unmarshaling message: %v, content: %s",
+			err, string(msg.Value))
+		done()
+		return
+	}
+
+	log.Printf("Processing message: topic=%s, partition=%d, offset=%d, key=%s, user=%s",
+		msg.Topic, msg.Partition, msg.Offset, string(msg.Key), userLoc.UserID)
+
+	if time.Now().Unix()-userLoc.Timestamp > 300 {
+		log.Printf("Skipping stale location update for user %s (%.2f minutes old)",
+			userLoc.UserID, float64(time.Now().Unix()-userLoc.Timestamp)/60)
+		done()
+		return
+	}
+
+	if err := h.service.ProcessUserLocation(session.Context(), userLoc, done); err != nil {
+		log.Printf("Error processing user location: %v", err)
+	}
+
+	elapsed := time.Since(startTime)
+	log.Printf("Finished processing message in %v: topic=%s, partition=%d, offset=%d",
+		elapsed, msg.Topic, msg.Partition, msg.Offset)
+}
+
+// messageKey returns the key messages are serialised by. Producers key user
+// location messages by user ID; unkeyed messages fall back to the user ID in
+// the payload.
+func messageKey(msg *sarama.ConsumerMessage) string {
+	if len(msg.Key) > 0 {
+		return string(msg.Key)
+	}
+
+	var userLoc model.UserLocation
+	if err := json.Unmarshal(msg.Value, &userLoc); err == nil && userLoc.UserID != "" {
+		return userLoc.UserID
+	}
+	return msg.Topic
 }
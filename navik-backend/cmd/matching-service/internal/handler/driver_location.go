@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+
+	"matching-service/internal/model"
+	"matching-service/internal/repository"
+
+	"github.com/IBM/sarama"
+)
+
+// DriverLocationHandler applies driver location updates to the in-memory index
+type DriverLocationHandler struct {
+	index *repository.DriverIndex
+}
+
+func NewDriverLocationHandler(index *repository.DriverIndex) *DriverLocationHandler {
+	return &DriverLocationHandler{
+		index: index,
+	}
+}
+
+// HandleMessage decodes a location message and updates the index
+func (h *DriverLocationHandler) HandleMessage(msg *sarama.ConsumerMessage) {
+	var update model.DriverLocationUpdate
+	if err := json.Unmarshal(msg.Value, &update); err != nil {
+		log.Printf("Error unmarshaling driver location: %v, content: %s", err, string(msg.Value))
+		return
+	}
+
+	h.index.ApplyUpdate(update)
+}
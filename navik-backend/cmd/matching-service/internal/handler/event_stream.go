@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+)
+
+// HandleEventStream streams the caller's match updates as Server-Sent Events,
+// for clients whose network breaks WebSockets. It carries the same updates as
+// the WebSocket, with each update's sequence number as its event ID, and
+// resumes the same way from last_seq or Last-Event-ID.
+func (h *WebSocketHandler) HandleEventStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := h.authenticator.AuthenticateStream(r)
+	if err != nil {
+		log.Printf("Event stream authentication failed: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	lastSeq, resume, err := resumePoint(r)
+	if err != nil {
+		http.Error(w, "Invalid last_seq", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Stop nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	http.NewResponseController(w).Flush()
+
+	// As for WebSockets, registering before the replay means anything
+	// published meanwhile is queued and deduplicated by sequence number
+	client := h.hub.RegisterStream(claims.UserID, w)
+
+	lastSent, err := h.replay(r.Context(), client, lastSeq, resume)
+	if err != nil {
+		log.Printf("Event stream replay error for user %s: %v", claims.UserID, err)
+		client.Close()
+		return
+	}
+
+	client.Serve(r.Context(), lastSent)
+}
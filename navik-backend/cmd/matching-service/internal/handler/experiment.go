@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"matching-service/internal/auth"
+	"matching-service/internal/service"
+)
+
+type ExperimentHandler struct {
+	service       service.ExperimentService
+	authenticator *auth.Authenticator
+}
+
+func NewExperimentHandler(service service.ExperimentService, authenticator *auth.Authenticator) *ExperimentHandler {
+	return &ExperimentHandler{
+		service:       service,
+		authenticator: authenticator,
+	}
+}
+
+// HandleReport compares match rate and pickup ETA across experiment arms
+func (h *ExperimentHandler) HandleReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := h.authenticator.AuthenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if claims.UserType != "admin" {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	reports, err := h.service.Report(r.Context())
+	if err != nil {
+		log.Printf("Error building experiment report: %v", err)
+		http.Error(w, "Failed to build experiment report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(reports)
+}
+
+func (h *ExperimentHandler) SetupRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/matching/experiments/report", h.HandleReport)
+}
@@ -2,20 +2,25 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
+	"matching-service/internal/auth"
 	"matching-service/internal/model"
+	"matching-service/internal/repository"
 	"matching-service/internal/service"
 )
 
 type LocationHandler struct {
-	service service.LocationService
+	service       service.LocationService
+	authenticator *auth.Authenticator
 }
 
-func NewLocationHandler(service service.LocationService) *LocationHandler {
+func NewLocationHandler(service service.LocationService, authenticator *auth.Authenticator) *LocationHandler {
 	return &LocationHandler{
-		service: service,
+		service:       service,
+		authenticator: authenticator,
 	}
 }
 
@@ -25,14 +30,32 @@ func (h *LocationHandler) HandleLocationUpdate(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	claims, err := h.authenticator.AuthenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	var loc model.UserLocation
 	if err := json.NewDecoder(r.Body).Decode(&loc); err != nil {
 		log.Printf("Error decoding request: %v", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	// The rider is always the token subject, never a client-supplied field
+	loc.UserID = claims.UserID
+	loc.SearchID = ""
 
-	if err := h.service.UpdateLocation(r.Context(), loc); err != nil {
+	search, err := h.service.UpdateLocation(r.Context(), loc, r.Header.Get("Idempotency-Key"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidLocation) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, repository.ErrSearchPending) {
+			http.Error(w, "Search for this Idempotency-Key is not available yet", http.StatusConflict)
+			return
+		}
 		log.Printf("Error updating location: %v", err)
 		http.Error(w, "Failed to process location update", http.StatusInternalServerError)
 		return
@@ -41,11 +64,48 @@ func (h *LocationHandler) HandleLocationUpdate(w http.ResponseWriter, r *http.Re
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "success",
-		"message": "Location update processed",
+		"status":        "success",
+		"message":       "Location update processed",
+		"search_id":     search.SearchID,
+		"search_status": search.Status,
 	})
 }
 
+// HandleGetSearch returns the status and candidates of one of the caller's searches
+func (h *LocationHandler) HandleGetSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := h.authenticator.AuthenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	search, err := h.service.GetSearch(r.Context(), r.PathValue("search_id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrSearchNotFound) {
+			http.Error(w, "Search not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error reading search: %v", err)
+		http.Error(w, "Failed to read search", http.StatusInternalServerError)
+		return
+	}
+
+	// Another user's search is reported as missing rather than forbidden
+	if search.UserID != claims.UserID {
+		http.Error(w, "Search not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(search)
+}
+
 func (h *LocationHandler) HandleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -56,5 +116,6 @@ func (h *LocationHandler) HandleHealthCheck(w http.ResponseWriter, r *http.Reque
 
 func (h *LocationHandler) SetupRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/matching", h.HandleLocationUpdate)
+	mux.HandleFunc("/api/matching/{search_id}", h.HandleGetSearch)
 	mux.HandleFunc("/health", h.HandleHealthCheck)
 }
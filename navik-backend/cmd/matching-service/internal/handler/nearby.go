@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"matching-service/internal/auth"
+	"matching-service/internal/model"
+	"matching-service/internal/service"
+	"matching-service/internal/util"
+)
+
+// nearbyWriteTimeout bounds writing one refresh of the nearby cars stream
+const nearbyWriteTimeout = 10 * time.Second
+
+// NearbyHandler streams the available cars around a rider to their home screen
+type NearbyHandler struct {
+	service       service.NearbyService
+	authenticator *auth.Authenticator
+}
+
+func NewNearbyHandler(service service.NearbyService, authenticator *auth.Authenticator) *NearbyHandler {
+	return &NearbyHandler{
+		service:       service,
+		authenticator: authenticator,
+	}
+}
+
+// HandleNearby streams the approximate positions of available cars around
+// the caller as Server-Sent Events, refreshed every few seconds until the
+// caller disconnects
+func (h *NearbyHandler) HandleNearby(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := h.authenticator.AuthenticateStream(r)
+	if err != nil {
+		log.Printf("Nearby stream authentication failed: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	area, ok := nearbyArea(r)
+	if !ok {
+		http.Error(w, "Invalid area: pass lat and lng, or min_lat, min_lng, max_lat and max_lng", http.StatusBadRequest)
+		return
+	}
+
+	// Car IDs are derived from a key that lives only as long as the stream,
+	// so they cannot be linked across streams or to drivers
+	streamKey := make([]byte, 16)
+	if _, err := rand.Read(streamKey); err != nil {
+		log.Printf("Error generating nearby stream key: %v", err)
+		http.Error(w, "Failed to start stream", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Stop nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	controller := http.NewResponseController(w)
+	ticker := time.NewTicker(h.service.Interval())
+	defer ticker.Stop()
+
+	for {
+		cars, err := h.service.Nearby(r.Context(), area, streamKey)
+		if err != nil {
+			// Keep the stream open; the next refresh may succeed
+			log.Printf("Error finding nearby cars for user %s: %v", claims.UserID, err)
+		} else {
+			data, err := json.Marshal(model.NearbyUpdate{Cars: cars, UpdatedAt: time.Now().Unix()})
+			if err != nil {
+				log.Printf("Error marshaling nearby cars: %v", err)
+				return
+			}
+
+			controller.SetWriteDeadline(time.Now().Add(nearbyWriteTimeout))
+			if _, err := w.Write([]byte("data: " + string(data) + "\n\n")); err != nil {
+				return
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// nearbyArea reads the area to show from the query: either a point with an
+// optional radius_km, or the corners of the map viewport
+func nearbyArea(r *http.Request) (model.NearbyArea, bool) {
+	query := r.URL.Query()
+	area := model.NearbyArea{VehicleType: query.Get("vehicle_type")}
+
+	if query.Has("min_lat") {
+		minLat, err1 := strconv.ParseFloat(query.Get("min_lat"), 64)
+		minLng, err2 := strconv.ParseFloat(query.Get("min_lng"), 64)
+		maxLat, err3 := strconv.ParseFloat(query.Get("max_lat"), 64)
+		maxLng, err4 := strconv.ParseFloat(query.Get("max_lng"), 64)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil || minLat > maxLat || minLng > maxLng {
+			return area, false
+		}
+
+		area.Latitude = (minLat + maxLat) / 2
+		area.Longitude = (minLng + maxLng) / 2
+		// Cover the corners of the viewport
+		area.RadiusKm = util.HaversineKm(area.Latitude, area.Longitude, maxLat, maxLng)
+	} else {
+		var err1, err2 error
+		area.Latitude, err1 = strconv.ParseFloat(query.Get("lat"), 64)
+		area.Longitude, err2 = strconv.ParseFloat(query.Get("lng"), 64)
+		if err1 != nil || err2 != nil {
+			return area, false
+		}
+
+		if radius := query.Get("radius_km"); radius != "" {
+			radiusKm, err := strconv.ParseFloat(radius, 64)
+			if err != nil || radiusKm <= 0 {
+				return area, false
+			}
+			area.RadiusKm = radiusKm
+		}
+	}
+
+	if area.Latitude < -90 || area.Latitude > 90 || area.Longitude < -180 || area.Longitude > 180 {
+		return area, false
+	}
+	return area, true
+}
+
+func (h *NearbyHandler) SetupRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/matching/nearby", h.HandleNearby)
+}
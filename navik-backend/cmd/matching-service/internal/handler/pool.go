@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"matching-service/internal/auth"
+	"matching-service/internal/repository"
+	"matching-service/internal/service"
+)
+
+type PoolHandler struct {
+	service       service.PoolTripService
+	authenticator *auth.Authenticator
+}
+
+func NewPoolHandler(service service.PoolTripService, authenticator *auth.Authenticator) *PoolHandler {
+	return &PoolHandler{
+		service:       service,
+		authenticator: authenticator,
+	}
+}
+
+// HandleCompleteStop marks the next stop of the calling driver's pooled trip as served
+func (h *PoolHandler) HandleCompleteStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := h.authenticator.AuthenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if claims.UserType != "driver" {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	trip, err := h.service.CompleteStop(r.Context(), claims.UserID, r.PathValue("trip_id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrPooledTripNotFound) || errors.Is(err, service.ErrNotTripDriver) {
+			http.Error(w, "Pooled trip not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error completing pooled trip stop: %v", err)
+		http.Error(w, "Failed to complete stop", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(trip)
+}
+
+func (h *PoolHandler) SetupRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/matching/pool/trips/{trip_id}/stops/complete", h.HandleCompleteStop)
+}
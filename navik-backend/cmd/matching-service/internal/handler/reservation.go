@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"matching-service/internal/auth"
+	"matching-service/internal/repository"
+	"matching-service/internal/service"
+)
+
+type ReservationHandler struct {
+	service       service.ReservationService
+	authenticator *auth.Authenticator
+}
+
+func NewReservationHandler(service service.ReservationService, authenticator *auth.Authenticator) *ReservationHandler {
+	return &ReservationHandler{
+		service:       service,
+		authenticator: authenticator,
+	}
+}
+
+type offerResponseRequest struct {
+	SearchID string `json:"search_id"`
+}
+
+// HandleAccept assigns the calling driver to the search they were offered to
+func (h *ReservationHandler) HandleAccept(w http.ResponseWriter, r *http.Request) {
+	driverID, req, ok := h.decodeOfferResponse(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.AcceptOffer(r.Context(), driverID, req.SearchID); err != nil {
+		if errors.Is(err, repository.ErrSearchNotFound) {
+			http.Error(w, "Search not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, repository.ErrOfferNotFound) || errors.Is(err, service.ErrOfferUnavailable) ||
+			errors.Is(err, repository.ErrSearchAssigned) {
+			http.Error(w, "Offer is no longer available", http.StatusConflict)
+			return
+		}
+		log.Printf("Error accepting offer: %v", err)
+		http.Error(w, "Failed to accept offer", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"message": "Offer accepted",
+	})
+}
+
+// HandleDecline releases the calling driver from the search they were offered to
+func (h *ReservationHandler) HandleDecline(w http.ResponseWriter, r *http.Request) {
+	driverID, req, ok := h.decodeOfferResponse(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeclineOffer(r.Context(), driverID, req.SearchID); err != nil {
+		if errors.Is(err, repository.ErrSearchNotFound) {
+			http.Error(w, "Search not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, repository.ErrOfferNotFound) {
+			http.Error(w, "Offer is no longer available", http.StatusConflict)
+			return
+		}
+		log.Printf("Error declining offer: %v", err)
+		http.Error(w, "Failed to decline offer", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"message": "Offer declined",
+	})
+}
+
+func (h *ReservationHandler) decodeOfferResponse(w http.ResponseWriter, r *http.Request) (string, offerResponseRequest, bool) {
+	var req offerResponseRequest
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return "", req, false
+	}
+
+	claims, err := h.authenticator.AuthenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", req, false
+	}
+
+	if claims.UserType != "driver" {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return "", req, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SearchID == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return "", req, false
+	}
+
+	return claims.UserID, req, true
+}
+
+func (h *ReservationHandler) SetupRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/matching/offers/accept", h.HandleAccept)
+	mux.HandleFunc("/api/matching/offers/decline", h.HandleDecline)
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"matching-service/internal/auth"
+	"matching-service/internal/model"
+	"matching-service/internal/repository"
+	"matching-service/internal/service"
+)
+
+type ScheduledRideHandler struct {
+	service       service.ScheduledRideService
+	authenticator *auth.Authenticator
+}
+
+func NewScheduledRideHandler(service service.ScheduledRideService, authenticator *auth.Authenticator) *ScheduledRideHandler {
+	return &ScheduledRideHandler{
+		service:       service,
+		authenticator: authenticator,
+	}
+}
+
+type bookRideRequest struct {
+	City        string  `json:"city"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	VehicleType string  `json:"vehicle_type"`
+	PickupAt    int64   `json:"pickup_at"`
+
+	Requirements *model.RideConstraints `json:"requirements"`
+	Preferences  *model.RideConstraints `json:"preferences"`
+}
+
+// HandleRides books a ride for the caller (POST) or lists their rides (GET)
+func (h *ScheduledRideHandler) HandleRides(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := h.authenticator.AuthenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		rides, err := h.service.ListRides(r.Context(), claims.UserID)
+		if err != nil {
+			log.Printf("Error listing scheduled rides: %v", err)
+			http.Error(w, "Failed to list scheduled rides", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"rides": rides,
+		})
+		return
+	}
+
+	var req bookRideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ride, err := h.service.BookRide(r.Context(), model.ScheduledRide{
+		UserID:      claims.UserID,
+		City:        req.City,
+		Latitude:    req.Latitude,
+		Longitude:   req.Longitude,
+		VehicleType: req.VehicleType,
+		PickupAt:    req.PickupAt,
+
+		Requirements: req.Requirements,
+		Preferences:  req.Preferences,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidPickupTime) || errors.Is(err, service.ErrInvalidScheduledRide) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error booking scheduled ride: %v", err)
+		http.Error(w, "Failed to book ride", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ride)
+}
+
+// HandleCancel cancels one of the caller's scheduled rides
+func (h *ScheduledRideHandler) HandleCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := h.authenticator.AuthenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req cancelSearchRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ride, err := h.service.CancelRide(r.Context(), claims.UserID, r.PathValue("ride_id"), req.Reason)
+	if err != nil {
+		if errors.Is(err, repository.ErrScheduledRideNotFound) {
+			http.Error(w, "Scheduled ride not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error cancelling scheduled ride: %v", err)
+		http.Error(w, "Failed to cancel ride", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ride)
+}
+
+func (h *ScheduledRideHandler) SetupRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/matching/scheduled", h.HandleRides)
+	mux.HandleFunc("/api/matching/scheduled/{ride_id}/cancel", h.HandleCancel)
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"matching-service/internal/auth"
+	"matching-service/internal/repository"
+	"matching-service/internal/service"
+)
+
+type SearchHandler struct {
+	service       service.SearchService
+	authenticator *auth.Authenticator
+}
+
+func NewSearchHandler(service service.SearchService, authenticator *auth.Authenticator) *SearchHandler {
+	return &SearchHandler{
+		service:       service,
+		authenticator: authenticator,
+	}
+}
+
+type cancelSearchRequest struct {
+	Reason string `json:"reason"`
+}
+
+// HandleCancel cancels one of the caller's searches
+func (h *SearchHandler) HandleCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := h.authenticator.AuthenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// The reason is optional, so an empty body is accepted
+	var req cancelSearchRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	search, err := h.service.CancelSearch(r.Context(), claims.UserID, r.PathValue("search_id"), req.Reason)
+	if err != nil {
+		if errors.Is(err, repository.ErrSearchNotFound) {
+			http.Error(w, "Search not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error cancelling search: %v", err)
+		http.Error(w, "Failed to cancel search", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(search)
+}
+
+type rateDriverRequest struct {
+	Stars int `json:"stars"`
+}
+
+// HandleRating rates the driver of one of the caller's searches
+func (h *SearchHandler) HandleRating(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := h.authenticator.AuthenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req rateDriverRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	search, err := h.service.RateDriver(r.Context(), claims.UserID, r.PathValue("search_id"), req.Stars)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRating) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, repository.ErrSearchNotFound) {
+			http.Error(w, "Search not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, repository.ErrSearchNotAssigned) || errors.Is(err, repository.ErrSearchRated) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("Error rating driver: %v", err)
+		http.Error(w, "Failed to rate driver", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(search)
+}
+
+// HandleTrace returns the recorded matching decisions of a search, for
+// operators investigating a match
+func (h *SearchHandler) HandleTrace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := h.authenticator.AuthenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if claims.UserType != "admin" {
+		http.Error(w, "Insufficient permissions", http.StatusForbidden)
+		return
+	}
+
+	trace, err := h.service.GetTrace(r.Context(), r.PathValue("search_id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrTraceNotFound) {
+			http.Error(w, "Search trace not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting search trace: %v", err)
+		http.Error(w, "Failed to get search trace", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(trace)
+}
+
+func (h *SearchHandler) SetupRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/matching/{search_id}/cancel", h.HandleCancel)
+	mux.HandleFunc("/api/matching/{search_id}/trace", h.HandleTrace)
+	mux.HandleFunc("/api/matching/{search_id}/rating", h.HandleRating)
+}
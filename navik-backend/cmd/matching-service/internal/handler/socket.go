@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"matching-service/internal/hub"
+	"matching-service/internal/model"
+	"matching-service/internal/repository"
+	"matching-service/internal/service"
+)
+
+// socketRequestTimeout bounds the handling of a message received over a WebSocket
+const socketRequestTimeout = 5 * time.Second
+
+// Error codes of the typed WebSocket protocol
+const (
+	socketInvalidMessage = "invalid_message"
+	socketInvalidRequest = "invalid_request"
+	socketUnknownType    = "unknown_type"
+	socketNotFound       = "not_found"
+	socketConflict       = "conflict"
+	socketInternal       = "internal"
+)
+
+// SocketHandler handles the messages riders send over their WebSocket
+type SocketHandler struct {
+	locations service.LocationService
+	searches  service.SearchService
+}
+
+func NewSocketHandler(locations service.LocationService, searches service.SearchService) *SocketHandler {
+	return &SocketHandler{
+		locations: locations,
+		searches:  searches,
+	}
+}
+
+type socketMessage struct {
+	Type     string `json:"type"`
+	SearchID string `json:"search_id"`
+	Reason   string `json:"reason"`
+}
+
+type socketCancelPayload struct {
+	SearchID string `json:"search_id"`
+	Reason   string `json:"reason"`
+}
+
+// HandleMessage handles a message a client sent over its WebSocket
+func (h *SocketHandler) HandleMessage(client *hub.Client, data []byte) {
+	if client.Protocol() == 0 {
+		h.handleBareMessage(client, data)
+		return
+	}
+
+	var msg model.SocketEnvelope
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Type == "" {
+		h.replyError(client, "", socketInvalidMessage, "Message is not a valid envelope")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), socketRequestTimeout)
+	defer cancel()
+
+	switch msg.Type {
+	case model.SocketPing:
+		h.reply(client, model.SocketPong, msg.ID, nil)
+	case model.SocketStartSearch:
+		h.startSearch(ctx, client, msg)
+	case model.SocketUpdatePickup:
+		h.updatePickup(ctx, client, msg)
+	case model.SocketCancel:
+		h.cancel(ctx, client, msg)
+	default:
+		h.replyError(client, msg.ID, socketUnknownType, fmt.Sprintf("Unknown message type %q", msg.Type))
+	}
+}
+
+// startSearch starts a ride search. The message ID is the idempotency key, so
+// a client retrying a message it got no answer to gets the same search.
+func (h *SocketHandler) startSearch(ctx context.Context, client *hub.Client, msg model.SocketEnvelope) {
+	var loc model.UserLocation
+	if err := json.Unmarshal(msg.Payload, &loc); err != nil {
+		h.replyError(client, msg.ID, socketInvalidRequest, "Invalid ride request")
+		return
+	}
+	// The rider is always the socket's user, never a client-supplied field
+	loc.UserID = client.UserID()
+	loc.SearchID = ""
+
+	search, err := h.locations.UpdateLocation(ctx, loc, msg.ID)
+	if err != nil {
+		h.replySearchError(client, msg, err)
+		return
+	}
+	h.reply(client, model.SocketAck, msg.ID, search)
+}
+
+// updatePickup moves the pickup of a search that has not found a driver
+func (h *SocketHandler) updatePickup(ctx context.Context, client *hub.Client, msg model.SocketEnvelope) {
+	var loc model.UserLocation
+	if err := json.Unmarshal(msg.Payload, &loc); err != nil || loc.SearchID == "" {
+		h.replyError(client, msg.ID, socketInvalidRequest, "Invalid pickup update")
+		return
+	}
+	loc.UserID = client.UserID()
+
+	search, err := h.locations.UpdatePickup(ctx, loc)
+	if err != nil {
+		h.replySearchError(client, msg, err)
+		return
+	}
+	h.reply(client, model.SocketAck, msg.ID, search)
+}
+
+// cancel cancels one of the rider's searches
+func (h *SocketHandler) cancel(ctx context.Context, client *hub.Client, msg model.SocketEnvelope) {
+	var req socketCancelPayload
+	if err := json.Unmarshal(msg.Payload, &req); err != nil || req.SearchID == "" {
+		h.replyError(client, msg.ID, socketInvalidRequest, "Invalid cancellation")
+		return
+	}
+
+	search, err := h.searches.CancelSearch(ctx, client.UserID(), req.SearchID, req.Reason)
+	if err != nil {
+		h.replySearchError(client, msg, err)
+		return
+	}
+	h.reply(client, model.SocketAck, msg.ID, search)
+}
+
+// replySearchError answers a failed search request with the matching error code
+func (h *SocketHandler) replySearchError(client *hub.Client, msg model.SocketEnvelope, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidLocation):
+		h.replyError(client, msg.ID, socketInvalidRequest, err.Error())
+	case errors.Is(err, repository.ErrSearchNotFound):
+		h.replyError(client, msg.ID, socketNotFound, "Search not found")
+	case errors.Is(err, repository.ErrSearchCancelled):
+		h.replyError(client, msg.ID, socketConflict, "Search was cancelled")
+	case errors.Is(err, repository.ErrSearchMatched):
+		h.replyError(client, msg.ID, socketConflict, "Search already found a driver")
+	default:
+		log.Printf("Error handling %s message from user %s: %v", msg.Type, client.UserID(), err)
+		h.replyError(client, msg.ID, socketInternal, fmt.Sprintf("Failed to handle %s", msg.Type))
+	}
+}
+
+func (h *SocketHandler) replyError(client *hub.Client, id, code, message string) {
+	h.reply(client, model.SocketError, id, model.SocketErrorPayload{Code: code, Message: message})
+}
+
+// reply sends a message to the client outside its stream of match updates
+func (h *SocketHandler) reply(client *hub.Client, messageType, id string, payload interface{}) {
+	msg := model.SocketEnvelope{Type: messageType, ID: id}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("Error marshaling %s reply: %v", messageType, err)
+			return
+		}
+		msg.Payload = data
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error marshaling %s reply: %v", messageType, err)
+		return
+	}
+	client.Send(data)
+}
+
+// handleBareMessage handles a message from a client that did not select the
+// typed protocol
+func (h *SocketHandler) handleBareMessage(client *hub.Client, data []byte) {
+	var msg socketMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		log.Printf("Ignoring malformed WebSocket message from user %s: %v", client.UserID(), err)
+		return
+	}
+
+	switch msg.Type {
+	case "cancel_search":
+		ctx, cancel := context.WithTimeout(context.Background(), socketRequestTimeout)
+		defer cancel()
+
+		// The rider receives the cancellation on their match stream; only
+		// failures are answered directly
+		if _, err := h.searches.CancelSearch(ctx, client.UserID(), msg.SearchID, msg.Reason); err != nil {
+			log.Printf("Error cancelling search %s over WebSocket: %v", msg.SearchID, err)
+			reply, _ := json.Marshal(map[string]string{
+				"type":      "error",
+				"search_id": msg.SearchID,
+				"error":     "Failed to cancel search",
+			})
+			client.Send(reply)
+		}
+	default:
+		log.Printf("Ignoring WebSocket message of unknown type %q from user %s", msg.Type, client.UserID())
+	}
+}
@@ -3,23 +3,38 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+
+	"matching-service/internal/auth"
+	"matching-service/internal/hub"
+	"matching-service/internal/model"
+	"matching-service/internal/repository"
+	"navik-backend/pkg/redisclient"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/websocket"
 )
 
 type WebSocketHandler struct {
-	redisClient *redis.Client
-	upgrader    websocket.Upgrader
+	redisClient   redis.UniversalClient
+	hub           *hub.Hub
+	matchStream   repository.MatchStreamRepository
+	authenticator *auth.Authenticator
+	upgrader      websocket.Upgrader
 }
 
-func NewWebSocketHandler(redisClient *redis.Client) *WebSocketHandler {
+func NewWebSocketHandler(redisClient redis.UniversalClient, hub *hub.Hub, matchStream repository.MatchStreamRepository, authenticator *auth.Authenticator, allowedOrigins []string) *WebSocketHandler {
 	return &WebSocketHandler{
-		redisClient: redisClient,
+		redisClient:   redisClient,
+		hub:           hub,
+		matchStream:   matchStream,
+		authenticator: authenticator,
 		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool { return true },
+			CheckOrigin: auth.OriginChecker(allowedOrigins),
 		},
 	}
 }
@@ -56,50 +71,193 @@ func NewWebSocketHandler(redisClient *redis.Client) *WebSocketHandler {
 //		return h.redisClient.Publish(ctx, "user:"+userID, data).Err()
 //	}
 func (h *WebSocketHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := h.upgrader.Upgrade(w, r, nil)
+	// Authenticate before upgrading so unauthenticated clients get a plain 401
+	claims, responseHeader, err := h.authenticator.AuthenticateUpgrade(r)
+	if err != nil {
+		log.Printf("WebSocket authentication failed: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	lastSeq, resume, err := resumePoint(r)
+	if err != nil {
+		http.Error(w, "Invalid last_seq", http.StatusBadRequest)
+		return
+	}
+
+	// Clients opt in to the typed protocol; without it they receive bare
+	// match updates as before
+	protocol := 0
+	if r.URL.Query().Has("protocol") {
+		protocol, err = strconv.Atoi(r.URL.Query().Get("protocol"))
+		if err != nil || protocol != model.SocketProtocolVersion {
+			http.Error(w, "Unsupported protocol", http.StatusBadRequest)
+			return
+		}
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
 		log.Printf("WebSocket upgrade failed: %v", err)
 		return
 	}
-	defer conn.Close()
 
-	// Get userID from query param or cookie
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		conn.WriteMessage(websocket.TextMessage, []byte("user_id required"))
+	// The user is always the token subject, never a client-supplied parameter.
+	// Registering before the replay means anything published meanwhile is
+	// queued on the client and deduplicated by sequence number.
+	client := h.hub.Register(claims.UserID, conn, protocol)
+
+	lastSent, err := h.replay(r.Context(), client, lastSeq, resume)
+	if err != nil {
+		log.Printf("WebSocket replay error for user %s: %v", claims.UserID, err)
+		client.Close()
 		return
 	}
 
-	// Set up Redis subscription with better logging
-	ctx := context.Background()
-	channelName := "user:" + userID
-	log.Printf("Subscribing to Redis channel: %s", channelName)
+	client.Start(lastSent)
+}
 
-	pubsub := h.redisClient.Subscribe(ctx, channelName)
-	defer pubsub.Close()
+// resumePoint returns the last sequence number a reconnecting client saw, from
+// the last_seq query parameter or, for event streams, the Last-Event-ID header
+func resumePoint(r *http.Request) (int64, bool, error) {
+	value := r.Header.Get("Last-Event-ID")
+	if r.URL.Query().Has("last_seq") {
+		value = r.URL.Query().Get("last_seq")
+	} else if value == "" {
+		return 0, false, nil
+	}
 
-	// // Send confirmation message to client
-	// conn.WriteMessage(websocket.TextMessage, []byte(`{"status":"CONNECTED","message":"Subscribed to updates"}`))
+	lastSeq, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || lastSeq < 0 {
+		return 0, false, fmt.Errorf("invalid sequence number %q", value)
+	}
+	return lastSeq, true, nil
+}
 
-	// Process incoming messages from Redis
-	ch := pubsub.Channel()
-	log.Printf("Starting Redis message loop for user: %s", userID)
+// replay sends stored updates to a newly connected client and returns the
+// highest sequence number sent. A resuming client gets every update after
+// lastSeq; a fresh client gets the latest stored match state. A resuming
+// client that missed updates no longer stored gets a resync update and the
+// latest state instead of a partial replay.
+func (h *WebSocketHandler) replay(ctx context.Context, client *hub.Client, lastSeq int64, resume bool) (int64, error) {
+	sent := lastSeq
 
-	for msg := range ch {
-		log.Printf("Received message from Redis channel %s: %s", channelName, msg.Payload)
-		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg.Payload)); err != nil {
-			log.Printf("WebSocket write error: %v", err)
-			return
+	if resume {
+		updates, complete, err := h.matchStream.Since(ctx, client.UserID(), lastSeq)
+		if err != nil {
+			return sent, err
 		}
-		log.Printf("Successfully sent message to client: %s", userID)
+
+		if !complete {
+			log.Printf("Updates after seq %d of user %s are gone, resyncing", lastSeq, client.UserID())
+			if err := h.sendResync(client, lastSeq); err != nil {
+				return sent, err
+			}
+			// The latest state may be numbered below lastSeq if the
+			// sequence restarted
+			sent = 0
+		} else if len(updates) > 0 {
+			for _, update := range updates {
+				if err := client.WriteDirect(update.Data); err != nil {
+					return sent, err
+				}
+				sent = update.Seq
+			}
+
+			log.Printf("Replayed %d updates to user %s from seq %d", len(updates), client.UserID(), lastSeq)
+			return sent, nil
+		}
+	}
+
+	// Nothing left in the stream to resume from, fall back to the latest state
+	latest, err := h.matchStream.Latest(ctx, client.UserID())
+	if err != nil {
+		return sent, err
+	}
+
+	if latest != nil && latest.Seq > sent {
+		if err := client.WriteDirect(latest.Data); err != nil {
+			return sent, err
+		}
+		sent = latest.Seq
+	}
+
+	return sent, nil
+}
+
+// sendResync tells a resuming client that updates after lastSeq are lost. It
+// has no sequence number, so it is never deduplicated.
+func (h *WebSocketHandler) sendResync(client *hub.Client, lastSeq int64) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"status":   model.MatchUpdateResync,
+		"user_id":  client.UserID(),
+		"last_seq": lastSeq,
+	})
+	if err != nil {
+		return err
+	}
+	return client.WriteDirect(data)
+}
+
+// HandleMetrics reports WebSocket connection metrics for this instance
+func (h *WebSocketHandler) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"websocket": h.hub.Stats(),
+		"redis":     redisclient.Check(r.Context(), h.redisClient),
+	})
+}
+
+// HandleHealth reports whether this instance can reach Redis, answering 503
+// when it cannot
+func (h *WebSocketHandler) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	health := redisclient.Check(r.Context(), h.redisClient)
+
+	status := http.StatusOK
+	if health.Status != redisclient.StatusUp {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"redis": health,
+	})
+}
+
+// HandleTicket issues a short-lived WebSocket ticket to an authenticated caller
+func (h *WebSocketHandler) HandleTicket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := h.authenticator.AuthenticateRequest(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tickets := h.authenticator.Tickets()
+	ticket, err := tickets.Issue(r.Context(), claims)
+	if err != nil {
+		log.Printf("Error issuing WebSocket ticket: %v", err)
+		http.Error(w, "Failed to issue ticket", http.StatusInternalServerError)
+		return
 	}
 
-	log.Printf("Redis subscription channel closed for user: %s", userID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ticket":     ticket,
+		"expires_in": int(tickets.TTL().Seconds()),
+	})
 }
 
 func (h *WebSocketHandler) SendMatchResults(userID string, data []byte) error {
 	ctx := context.Background()
-	channelName := "user:" + userID
+	channelName := redisclient.UserChannel(userID)
 	log.Printf("Publishing match results to channel %s: %s", channelName, string(data))
 
 	result := h.redisClient.Publish(ctx, channelName, data)
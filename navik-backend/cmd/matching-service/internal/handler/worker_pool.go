@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// job is a message queued for a worker, with the callback that records its
+// completion. Processing may finish after the worker has moved on, so the
+// worker hands the callback to process rather than calling it itself.
+type job struct {
+	msg  *sarama.ConsumerMessage
+	done func()
+}
+
+// workerPool runs a fixed number of workers. Jobs with the same key always go
+// to the same worker, so they are processed one at a time and in order.
+type workerPool struct {
+	queues []chan job
+	wg     sync.WaitGroup
+}
+
+func newWorkerPool(workers, queueSize int, process func(msg *sarama.ConsumerMessage, done func())) *workerPool {
+	p := &workerPool{queues: make([]chan job, workers)}
+	for i := range p.queues {
+		p.queues[i] = make(chan job, queueSize)
+		p.wg.Add(1)
+		go func(queue chan job) {
+			defer p.wg.Done()
+			for j := range queue {
+				process(j.msg, j.done)
+			}
+		}(p.queues[i])
+	}
+	return p
+}
+
+// queueFor returns the queue of the worker that owns the key
+func (p *workerPool) queueFor(key string) chan job {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return p.queues[h.Sum32()%uint32(len(p.queues))]
+}
+
+// stop waits for the queued jobs to finish; no job may be submitted afterwards
+func (p *workerPool) stop() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
+
+// offsetTracker commits a partition's offset only past messages that have
+// completed along with every message before them
+type offsetTracker struct {
+	mu      sync.Mutex
+	pending []int64
+	done    map[int64]bool
+	commit  func(offset int64)
+}
+
+func newOffsetTracker(commit func(offset int64)) *offsetTracker {
+	return &offsetTracker{
+		done:   make(map[int64]bool),
+		commit: commit,
+	}
+}
+
+// add records a dispatched message; offsets must be added in order
+func (t *offsetTracker) add(offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = append(t.pending, offset)
+}
+
+// complete records a finished message and commits the contiguous prefix
+func (t *offsetTracker) complete(offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done[offset] = true
+	last := int64(-1)
+	for len(t.pending) > 0 && t.done[t.pending[0]] {
+		last = t.pending[0]
+		delete(t.done, last)
+		t.pending = t.pending[1:]
+	}
+	if last >= 0 {
+		t.commit(last + 1)
+	}
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+func TestOffsetTrackerCommitsContiguousPrefix(t *testing.T) {
+	tests := []struct {
+		name        string
+		dispatched  []int64
+		completed   []int64
+		wantCommits []int64
+	}{
+		{name: "in order", dispatched: []int64{0, 1, 2}, completed: []int64{0, 1, 2}, wantCommits: []int64{1, 2, 3}},
+		{name: "reverse order", dispatched: []int64{0, 1, 2}, completed: []int64{2, 1, 0}, wantCommits: []int64{3}},
+		{
+			name:        "out of order",
+			dispatched:  []int64{0, 1, 2, 3, 4},
+			completed:   []int64{2, 0, 1, 4, 3},
+			wantCommits: []int64{1, 3, 5},
+		},
+		{name: "gap never completed", dispatched: []int64{0, 1, 2}, completed: []int64{0, 2}, wantCommits: []int64{1}},
+		{name: "offsets with gaps", dispatched: []int64{10, 12, 15}, completed: []int64{12, 10, 15}, wantCommits: []int64{13, 16}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var commits []int64
+			tracker := newOffsetTracker(func(offset int64) { commits = append(commits, offset) })
+
+			for _, offset := range tt.dispatched {
+				tracker.add(offset)
+			}
+			for _, offset := range tt.completed {
+				tracker.complete(offset)
+			}
+
+			if len(commits) != len(tt.wantCommits) {
+				t.Fatalf("commits = %v, want %v", commits, tt.wantCommits)
+			}
+			for i := range commits {
+				if commits[i] != tt.wantCommits[i] {
+					t.Fatalf("commits = %v, want %v", commits, tt.wantCommits)
+				}
+			}
+		})
+	}
+}
+
+// fakeSession records the offsets marked for commit
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	ctx context.Context
+
+	mu     sync.Mutex
+	marked []int64
+}
+
+func (s *fakeSession) Context() context.Context { return s.ctx }
+
+func (s *fakeSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = append(s.marked, offset)
+}
+
+func (s *fakeSession) lastMarked() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.marked) == 0 {
+		return -1
+	}
+	return s.marked[len(s.marked)-1]
+}
+
+type fakeClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Topic() string                            { return "pune-users" }
+func (c *fakeClaim) Partition() int32                         { return 0 }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return 0 }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// fakePauser reports each pause and resume on its channels
+type fakePauser struct {
+	paused  chan struct{}
+	resumed chan struct{}
+}
+
+func (p *fakePauser) Pause(partitions map[string][]int32)  { p.paused <- struct{}{} }
+func (p *fakePauser) Resume(partitions map[string][]int32) { p.resumed <- struct{}{} }
+
+func TestConsumeClaimPausesFullQueue(t *testing.T) {
+	session := &fakeSession{ctx: context.Background()}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 3)}
+	pauser := &fakePauser{paused: make(chan struct{}, 3), resumed: make(chan struct{}, 3)}
+
+	// One worker with room for one queued message, held until release
+	release := make(chan struct{})
+	h := NewConsumerGroupHandler(nil, pauser, 1, 1)
+	h.pool = newWorkerPool(1, 1, func(msg *sarama.ConsumerMessage, done func()) {
+		<-release
+		done()
+	})
+
+	// Messages of one user share a worker, so the third cannot be queued
+	for offset := int64(0); offset < 3; offset++ {
+		claim.messages <- &sarama.ConsumerMessage{Topic: "pune-users", Key: []byte("u1"), Offset: offset}
+	}
+	close(claim.messages)
+
+	consumed := make(chan error)
+	go func() { consumed <- h.ConsumeClaim(session, claim) }()
+
+	select {
+	case <-pauser.paused:
+	case <-time.After(time.Second):
+		t.Fatal("partition not paused with its worker queue full")
+	}
+	select {
+	case <-pauser.resumed:
+		t.Fatal("partition resumed before the worker accepted the message")
+	case <-consumed:
+		t.Fatal("claim finished before the worker accepted every message")
+	default:
+	}
+	if offset := session.lastMarked(); offset != -1 {
+		t.Errorf("offset %d committed before any message was processed", offset)
+	}
+
+	close(release)
+	select {
+	case <-pauser.resumed:
+	case <-time.After(time.Second):
+		t.Fatal("partition not resumed once the worker accepted the message")
+	}
+	if err := <-consumed; err != nil {
+		t.Fatalf("ConsumeClaim: %v", err)
+	}
+
+	h.pool.stop()
+	if offset := session.lastMarked(); offset != 3 {
+		t.Errorf("committed offset = %d, want 3", offset)
+	}
+}
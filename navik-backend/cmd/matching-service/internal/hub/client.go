@@ -0,0 +1,230 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"matching-service/internal/model"
+
+	"github.com/gorilla/websocket"
+)
+
+// Client is a single WebSocket connection or event stream registered with the hub
+type Client struct {
+	hub       *Hub
+	userID    string
+	conn      *websocket.Conn
+	transport transport
+	protocol  int
+	send      chan []byte
+
+	// lastSent is only touched by the goroutine that writes to the connection
+	lastSent int64
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newClient(hub *Hub, userID string, conn *websocket.Conn, transport transport, protocol int) *Client {
+	return &Client{
+		hub:       hub,
+		userID:    userID,
+		conn:      conn,
+		transport: transport,
+		protocol:  protocol,
+		send:      make(chan []byte, hub.config.SendQueueSize),
+		done:      make(chan struct{}),
+	}
+}
+
+// UserID returns the user the connection belongs to
+func (c *Client) UserID() string {
+	return c.userID
+}
+
+// Protocol returns the version of the typed protocol the client speaks, or 0
+// if it receives bare match updates
+func (c *Client) Protocol() int {
+	return c.protocol
+}
+
+// WriteDirect writes a match update synchronously. It must only be used
+// before Start, e.g. to replay stored updates.
+func (c *Client) WriteDirect(data []byte) error {
+	data = c.frame(data)
+	if err := c.write(data); err != nil {
+		return err
+	}
+	if seq := MessageSeq(data); seq > c.lastSent {
+		c.lastSent = seq
+	}
+	return nil
+}
+
+// Start launches the read and write loops of a WebSocket client. Updates with
+// a sequence number at or below lastSeq are skipped as already delivered.
+func (c *Client) Start(lastSeq int64) {
+	if lastSeq > c.lastSent {
+		c.lastSent = lastSeq
+	}
+	go c.writePump()
+	go c.readPump()
+}
+
+// Serve runs the write loop of an event stream client in the calling
+// goroutine, which must be the one serving the HTTP request, until the client
+// is closed or ctx is done. Updates with a sequence number at or below lastSeq
+// are skipped as already delivered.
+func (c *Client) Serve(ctx context.Context, lastSeq int64) {
+	if lastSeq > c.lastSent {
+		c.lastSent = lastSeq
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-c.done:
+		}
+	}()
+	c.writePump()
+}
+
+// Wait blocks until the connection is closed
+func (c *Client) Wait() {
+	<-c.done
+}
+
+// Close unregisters the client and closes the connection
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		c.hub.unregister(c)
+		close(c.done)
+		c.transport.close()
+	})
+}
+
+// Send queues a message for the client, e.g. a reply to a client message
+func (c *Client) Send(data []byte) {
+	c.enqueue(data)
+}
+
+// enqueue adds a message to the send queue. A client that cannot keep up is
+// disconnected rather than allowed to block routing for everyone else; it can
+// resume from its last sequence number when it reconnects.
+func (c *Client) enqueue(data []byte) {
+	select {
+	case <-c.done:
+	case c.send <- data:
+	default:
+		atomic.AddInt64(&c.hub.slowClientDrops, 1)
+		log.Printf("Dropping slow client for user %s: send queue full", c.userID)
+		go c.Close()
+	}
+}
+
+func (c *Client) writePump() {
+	ticker := time.NewTicker(c.hub.config.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.Close()
+	}()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case data := <-c.send:
+			seq := MessageSeq(data)
+			if seq != 0 && seq <= c.lastSent {
+				continue
+			}
+			if err := c.write(data); err != nil {
+				atomic.AddInt64(&c.hub.writeErrors, 1)
+				log.Printf("Write error for user %s: %v", c.userID, err)
+				return
+			}
+			if seq > c.lastSent {
+				c.lastSent = seq
+			}
+		case <-ticker.C:
+			if err := c.transport.writePing(c.hub.config.WriteTimeout); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) readPump() {
+	defer c.Close()
+
+	c.conn.SetReadLimit(c.hub.config.MaxMessageBytes)
+	c.conn.SetReadDeadline(time.Now().Add(c.hub.config.PongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(c.hub.config.PongTimeout))
+	})
+
+	for {
+		messageType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				atomic.AddInt64(&c.hub.idleTimeouts, 1)
+				log.Printf("WebSocket idle timeout for user %s", c.userID)
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("WebSocket read error for user %s: %v", c.userID, err)
+			}
+			return
+		}
+		// Any client message counts as activity
+		c.conn.SetReadDeadline(time.Now().Add(c.hub.config.PongTimeout))
+
+		if messageType == websocket.TextMessage && c.hub.onMessage != nil {
+			c.hub.onMessage(c, data)
+		}
+	}
+}
+
+func (c *Client) write(data []byte) error {
+	if err := c.transport.writeMessage(data, c.hub.config.WriteTimeout); err != nil {
+		return err
+	}
+	atomic.AddInt64(&c.hub.messagesSent, 1)
+	return nil
+}
+
+// frame wraps a match update in an update message for clients of the typed
+// protocol. The envelope repeats the update's sequence number, so
+// deduplication works the same on framed and bare updates.
+func (c *Client) frame(update []byte) []byte {
+	if c.protocol == 0 {
+		return update
+	}
+
+	framed, err := json.Marshal(model.SocketEnvelope{
+		Type:    model.SocketUpdate,
+		Seq:     MessageSeq(update),
+		Payload: update,
+	})
+	if err != nil {
+		log.Printf("Error framing update for user %s: %v", c.userID, err)
+		return update
+	}
+	return framed
+}
+
+// MessageSeq extracts the sequence number from a match update payload
+func MessageSeq(data []byte) int64 {
+	var header struct {
+		Seq int64 `json:"seq"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0
+	}
+	return header.Seq
+}
@@ -0,0 +1,198 @@
+package hub
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+)
+
+// userChannelPrefix is the prefix of the per-user Redis Pub/Sub channels
+const userChannelPrefix = "user:"
+
+// Config controls connection heartbeats and buffering
+type Config struct {
+	SendQueueSize   int
+	PingInterval    time.Duration
+	PongTimeout     time.Duration
+	WriteTimeout    time.Duration
+	MaxMessageBytes int64
+}
+
+// Stats is a snapshot of the hub's connection metrics
+type Stats struct {
+	ActiveConnections int64 `json:"active_connections"`
+	ActiveStreams     int64 `json:"active_streams"`
+	ConnectionsOpened int64 `json:"connections_opened"`
+	ConnectionsClosed int64 `json:"connections_closed"`
+	SlowClientDrops   int64 `json:"slow_client_drops"`
+	IdleTimeouts      int64 `json:"idle_timeouts"`
+	MessagesRouted    int64 `json:"messages_routed"`
+	MessagesSent      int64 `json:"messages_sent"`
+	WriteErrors       int64 `json:"write_errors"`
+}
+
+// MessageHandler handles a message a client sent over its connection
+type MessageHandler func(client *Client, data []byte)
+
+// Hub fans out per-user Redis Pub/Sub messages to the WebSocket connections
+// and event streams held by this instance. It holds a single pattern
+// subscription for all users instead of one subscription per connection.
+type Hub struct {
+	redisClient redis.UniversalClient
+	config      Config
+	onMessage   MessageHandler
+
+	mu      sync.RWMutex
+	clients map[string]map[*Client]struct{}
+
+	activeConnections int64
+	activeStreams     int64
+	connectionsOpened int64
+	connectionsClosed int64
+	slowClientDrops   int64
+	idleTimeouts      int64
+	messagesRouted    int64
+	messagesSent      int64
+	writeErrors       int64
+}
+
+// NewHub creates a connection hub
+func NewHub(redisClient redis.UniversalClient, config Config) *Hub {
+	return &Hub{
+		redisClient: redisClient,
+		config:      config,
+		clients:     make(map[string]map[*Client]struct{}),
+	}
+}
+
+// HandleMessages sets the handler for messages clients send. It must be
+// called before clients are registered.
+func (h *Hub) HandleMessages(handler MessageHandler) {
+	h.onMessage = handler
+}
+
+// Run subscribes to every user channel and routes messages to local clients
+// until the context is cancelled
+func (h *Hub) Run(ctx context.Context) error {
+	pubsub := h.redisClient.PSubscribe(ctx, userChannelPrefix+"*")
+	defer pubsub.Close()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+	log.Printf("WebSocket hub subscribed to pattern %s*", userChannelPrefix)
+
+	ch := pubsub.Channel(redis.WithChannelSize(1024))
+	for {
+		select {
+		case <-ctx.Done():
+			h.closeAll()
+			return ctx.Err()
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			userID := strings.TrimPrefix(msg.Channel, userChannelPrefix)
+			h.route(userID, []byte(msg.Payload))
+		}
+	}
+}
+
+// Register adds a connection for a user speaking the given version of the
+// typed protocol, or 0 for bare match updates. The client buffers messages
+// routed to it until Start is called.
+func (h *Hub) Register(userID string, conn *websocket.Conn, protocol int) *Client {
+	return h.add(newClient(h, userID, conn, &websocketTransport{conn: conn}, protocol))
+}
+
+// RegisterStream adds a Server-Sent Events stream for a user. The response
+// headers must already be written. The client buffers messages routed to it
+// until Serve is called.
+func (h *Hub) RegisterStream(userID string, w http.ResponseWriter) *Client {
+	client := h.add(newClient(h, userID, nil, &eventStreamTransport{
+		w:          w,
+		controller: http.NewResponseController(w),
+	}, 0))
+	atomic.AddInt64(&h.activeStreams, 1)
+	return client
+}
+
+func (h *Hub) add(client *Client) *Client {
+	userID := client.userID
+
+	h.mu.Lock()
+	if h.clients[userID] == nil {
+		h.clients[userID] = make(map[*Client]struct{})
+	}
+	h.clients[userID][client] = struct{}{}
+	h.mu.Unlock()
+
+	atomic.AddInt64(&h.activeConnections, 1)
+	atomic.AddInt64(&h.connectionsOpened, 1)
+	return client
+}
+
+// Stats returns the current connection metrics
+func (h *Hub) Stats() Stats {
+	return Stats{
+		ActiveConnections: atomic.LoadInt64(&h.activeConnections),
+		ActiveStreams:     atomic.LoadInt64(&h.activeStreams),
+		ConnectionsOpened: atomic.LoadInt64(&h.connectionsOpened),
+		ConnectionsClosed: atomic.LoadInt64(&h.connectionsClosed),
+		SlowClientDrops:   atomic.LoadInt64(&h.slowClientDrops),
+		IdleTimeouts:      atomic.LoadInt64(&h.idleTimeouts),
+		MessagesRouted:    atomic.LoadInt64(&h.messagesRouted),
+		MessagesSent:      atomic.LoadInt64(&h.messagesSent),
+		WriteErrors:       atomic.LoadInt64(&h.writeErrors),
+	}
+}
+
+func (h *Hub) route(userID string, data []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for client := range h.clients[userID] {
+		atomic.AddInt64(&h.messagesRouted, 1)
+		client.enqueue(client.frame(data))
+	}
+}
+
+func (h *Hub) unregister(client *Client) {
+	h.mu.Lock()
+	if clients, ok := h.clients[client.userID]; ok {
+		if _, ok := clients[client]; ok {
+			delete(clients, client)
+			atomic.AddInt64(&h.activeConnections, -1)
+			if client.conn == nil {
+				atomic.AddInt64(&h.activeStreams, -1)
+			}
+			atomic.AddInt64(&h.connectionsClosed, 1)
+		}
+		if len(clients) == 0 {
+			delete(h.clients, client.userID)
+		}
+	}
+	h.mu.Unlock()
+}
+
+func (h *Hub) closeAll() {
+	h.mu.RLock()
+	var clients []*Client
+	for _, userClients := range h.clients {
+		for client := range userClients {
+			clients = append(clients, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		client.Close()
+	}
+}
@@ -0,0 +1,79 @@
+package hub
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// transport writes a client's messages to its connection. Writes only happen
+// from one goroutine at a time.
+type transport interface {
+	writeMessage(data []byte, timeout time.Duration) error
+	writePing(timeout time.Duration) error
+	close() error
+}
+
+// websocketTransport sends messages as WebSocket text frames
+type websocketTransport struct {
+	conn *websocket.Conn
+}
+
+func (t *websocketTransport) writeMessage(data []byte, timeout time.Duration) error {
+	t.conn.SetWriteDeadline(time.Now().Add(timeout))
+	return t.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (t *websocketTransport) writePing(timeout time.Duration) error {
+	t.conn.SetWriteDeadline(time.Now().Add(timeout))
+	return t.conn.WriteMessage(websocket.PingMessage, nil)
+}
+
+func (t *websocketTransport) close() error {
+	return t.conn.Close()
+}
+
+// eventStreamTransport sends messages as Server-Sent Events. The sequence
+// number of an update is its event ID, so browsers resume from it with
+// Last-Event-ID when they reconnect.
+type eventStreamTransport struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+}
+
+func (t *eventStreamTransport) writeMessage(data []byte, timeout time.Duration) error {
+	var event bytes.Buffer
+	if seq := MessageSeq(data); seq > 0 {
+		event.WriteString("id: " + strconv.FormatInt(seq, 10) + "\n")
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		event.WriteString("data: ")
+		event.Write(line)
+		event.WriteString("\n")
+	}
+	event.WriteString("\n")
+
+	return t.write(event.Bytes(), timeout)
+}
+
+// writePing sends a comment, which clients ignore but which keeps proxies
+// from closing an idle stream
+func (t *eventStreamTransport) writePing(timeout time.Duration) error {
+	return t.write([]byte(": ping\n\n"), timeout)
+}
+
+func (t *eventStreamTransport) write(data []byte, timeout time.Duration) error {
+	t.controller.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err := t.w.Write(data); err != nil {
+		return err
+	}
+	return t.controller.Flush()
+}
+
+// close does nothing: the stream ends when the request handler returns
+func (t *eventStreamTransport) close() error {
+	return nil
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 )
@@ -12,8 +13,52 @@ type UserLocation struct {
 	Longitude   float64 `json:"longitude"`
 	Timestamp   int64   `json:"timestamp"`
 	RequestType string  `json:"request_type"`
+	VehicleType string  `json:"vehicle_type,omitempty"`
+	SearchID    string  `json:"search_id,omitempty"`
+
+	// Product selects the ride product; pooled rides also need the drop-off
+	Product       string  `json:"product,omitempty"`
+	DropLatitude  float64 `json:"drop_latitude,omitempty"`
+	DropLongitude float64 `json:"drop_longitude,omitempty"`
+
+	// Requirements are hard constraints: drivers not meeting all of them are
+	// never matched. Preferences are soft constraints: drivers meeting more of
+	// them rank higher.
+	Requirements *RideConstraints `json:"requirements,omitempty"`
+	Preferences  *RideConstraints `json:"preferences,omitempty"`
+}
+
+// RideConstraints are what a rider asks of a driver and vehicle beyond the
+// vehicle type
+type RideConstraints struct {
+	WheelchairAccessible bool `json:"wheelchair_accessible,omitempty"`
+	ChildSeat            bool `json:"child_seat,omitempty"`
+	PetFriendly          bool `json:"pet_friendly,omitempty"`
+	Electric             bool `json:"electric,omitempty"`
+	// MinLuggage is the number of bags the vehicle must take
+	MinLuggage   int  `json:"min_luggage,omitempty"`
+	FemaleDriver bool `json:"female_driver,omitempty"`
+	// FemaleDriverAtNight asks for a female driver during the configured
+	// night hours only
+	FemaleDriverAtNight bool `json:"female_driver_at_night,omitempty"`
 }
 
+// VehicleCapabilities are what a driver's vehicle offers beyond its type.
+// Drivers set them on their profile and send them with their location.
+type VehicleCapabilities struct {
+	WheelchairAccessible bool `json:"wheelchair_accessible,omitempty" dynamodbav:"wheelchair_accessible"`
+	ChildSeat            bool `json:"child_seat,omitempty" dynamodbav:"child_seat"`
+	PetFriendly          bool `json:"pet_friendly,omitempty" dynamodbav:"pet_friendly"`
+	Electric             bool `json:"electric,omitempty" dynamodbav:"electric"`
+	// LuggageCapacity is the number of bags the vehicle takes
+	LuggageCapacity int `json:"luggage_capacity,omitempty" dynamodbav:"luggage_capacity"`
+}
+
+// DriverGenderFemale is the driver gender matched by female driver constraints
+const DriverGenderFemale = "female"
+
+// ProductPool is the shared ride product
+const ProductPool = "pool"
 
 func (l *UserLocation) Validate() error {
 	if l.UserID == "" {
@@ -28,6 +73,20 @@ func (l *UserLocation) Validate() error {
 	if l.Longitude < -180 || l.Longitude > 180 {
 		return fmt.Errorf("longitude must be between -180 and 180")
 	}
+	if l.Product == ProductPool {
+		if l.DropLatitude == 0 && l.DropLongitude == 0 {
+			return fmt.Errorf("drop-off location is required for pooled rides")
+		}
+		if l.DropLatitude < -90 || l.DropLatitude > 90 || l.DropLongitude < -180 || l.DropLongitude > 180 {
+			return fmt.Errorf("drop-off location is out of range")
+		}
+	}
+
+	for _, constraints := range []*RideConstraints{l.Requirements, l.Preferences} {
+		if constraints != nil && constraints.MinLuggage < 0 {
+			return fmt.Errorf("min_luggage must not be negative")
+		}
+	}
 
 	if l.Timestamp == 0 {
 		l.Timestamp = time.Now().Unix()
@@ -46,35 +105,428 @@ type EnrichedUserLocation struct {
 // DriverLocation represents a driver's location from the database
 type DriverLocation struct {
 	// Base driver information
-	DriverID    string    `json:"driver_id" dynamodbav:"DriverID"`
+	DriverID    string    `json:"driver_id" dynamodbav:"driver_id"`
+	City        string    `json:"city,omitempty" dynamodbav:"city"`
 	Latitude    float64   `json:"latitude"`
 	Longitude   float64   `json:"longitude"`
-	Location    string    `json:"location" dynamodbav:"Location"`
-	VehicleType string    `json:"vehicle_type" dynamodbav:"Vehicle"`
-	Status      string    `json:"status" dynamodbav:"Status"`
+	Location    string    `json:"location" dynamodbav:"location"`
+	VehicleType string    `json:"vehicle_type" dynamodbav:"vehicle_type"`
+	Status      string    `json:"status" dynamodbav:"status"`
+	Heading     float64   `json:"heading,omitempty" dynamodbav:"heading"`
 	LastUpdated time.Time `json:"last_updated"`
-	
+	UpdatedAt   int64     `json:"updated_at,omitempty" dynamodbav:"updated_at"`
+
+	// Capabilities and DriverGender come from the driver's profile
+	Capabilities VehicleCapabilities `json:"capabilities,omitempty" dynamodbav:"capabilities"`
+	DriverGender string              `json:"driver_gender,omitempty" dynamodbav:"driver_gender"`
+
 	// H3 indices at different resolutions
-	H3Res9      string    `json:"h3_res9" dynamodbav:"H3Res9"`
-	H3Res8      string    `json:"h3_res8" dynamodbav:"H3Res8"`
-	H3Res7      string    `json:"h3_res7" dynamodbav:"H3Res7"`
-	
+	H3Res9 string `json:"h3_res9" dynamodbav:"h3_res9"`
+	H3Res8 string `json:"h3_res8" dynamodbav:"h3_res8"`
+	H3Res7 string `json:"h3_res7" dynamodbav:"h3_res7"`
+
+	// Driver quality signals used for ranking, filled in from the driver's
+	// stats before candidates are ranked
+	Rating         float64 `json:"rating,omitempty" dynamodbav:"rating"`
+	AcceptanceRate float64 `json:"acceptance_rate,omitempty" dynamodbav:"acceptance_rate"`
+	LastTripAt     int64   `json:"last_trip_at,omitempty" dynamodbav:"last_trip_at"`
+
 	// Matching-related fields (not stored in DB)
-	Distance    float64   `json:"distance,omitempty"`
-	ETA         int       `json:"eta_minutes,omitempty"`
+	Distance float64         `json:"distance,omitempty"`
+	ETA      int             `json:"eta_minutes,omitempty"`
+	Score    *ScoreBreakdown `json:"score,omitempty"`
+}
+
+// ScoreBreakdown is the per-signal contribution to a driver's ranking score
+type ScoreBreakdown struct {
+	Strategy   string  `json:"strategy"`
+	ETA        float64 `json:"eta"`
+	Rating     float64 `json:"rating"`
+	Acceptance float64 `json:"acceptance"`
+	Idle       float64 `json:"idle"`
+	Vehicle    float64 `json:"vehicle"`
+	Preference float64 `json:"preference"`
+	Total      float64 `json:"total"`
+}
+
+// DriverStats are a driver's quality signals, from how they answered offers
+// and how riders rated them
+type DriverStats struct {
+	// Rating is the mean of the riders' 1-5 star ratings, 0 if unrated
+	Rating float64 `json:"rating,omitempty"`
+	// AcceptanceRate is the share of offers accepted, 0 if none answered
+	AcceptanceRate float64 `json:"acceptance_rate,omitempty"`
+	// LastTripAt is when the driver last accepted an offer
+	LastTripAt int64 `json:"last_trip_at,omitempty"`
+}
+
+// DriverLocationUpdate is a driver location message published by the
+// location service on the city location topics
+type DriverLocationUpdate struct {
+	DriverID    string  `json:"driver_id"`
+	City        string  `json:"city"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	Timestamp   int64   `json:"timestamp"`
+	VehicleType string  `json:"vehicle_type"`
+	Status      string  `json:"status"`
+	Heading     float64 `json:"heading,omitempty"`
+
+	Capabilities VehicleCapabilities `json:"capabilities,omitempty"`
+	DriverGender string              `json:"driver_gender,omitempty"`
 }
 
 // DriverResponse represents the formatted response to send back to the user
 type DriverResponse struct {
+	SearchID    string       `json:"search_id,omitempty"`
 	UserID      string       `json:"user_id"`
 	RequestTime int64        `json:"request_time"`
 	Drivers     []DriverInfo `json:"drivers"`
 	Status      string       `json:"status"`
+	Pool        *PoolMatch   `json:"pool,omitempty"`
+
+	// The experiment arm the rider was matched under, if any
+	Experiment string `json:"experiment,omitempty"`
+	Arm        string `json:"arm,omitempty"`
 }
 
 type DriverInfo struct {
-	DriverID    string  `json:"driver_id"`
+	DriverID    string          `json:"driver_id"`
+	VehicleType string          `json:"vehicle_type"`
+	Distance    float64         `json:"distance_km"`
+	ETA         int             `json:"eta_minutes"`
+	Score       *ScoreBreakdown `json:"score,omitempty"`
+}
+
+// Pooled trip stop types
+const (
+	StopPickup = "PICKUP"
+	StopDrop   = "DROP"
+)
+
+// TripStop is a pickup or drop-off on a pooled trip's route
+type TripStop struct {
+	Type      string  `json:"type"`
+	UserID    string  `json:"user_id"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// ETA is the estimated minutes from the driver's position to the stop
+	ETA float64 `json:"eta_minutes"`
+}
+
+// PoolRider is a rider sharing a pooled trip
+type PoolRider struct {
+	UserID           string  `json:"user_id"`
+	DirectDistanceKm float64 `json:"direct_distance_km"`
+	Fare             float64 `json:"fare"`
+	PickedUp         bool    `json:"picked_up"`
+}
+
+// PooledTrip is a shared trip and its remaining route. Latitude and Longitude
+// are the driver's position as of the last completed stop.
+type PooledTrip struct {
+	TripID      string      `json:"trip_id"`
+	DriverID    string      `json:"driver_id"`
+	City        string      `json:"city"`
+	VehicleType string      `json:"vehicle_type"`
+	Capacity    int         `json:"capacity"`
+	Latitude    float64     `json:"latitude"`
+	Longitude   float64     `json:"longitude"`
+	Stops       []TripStop  `json:"stops"`
+	Riders      []PoolRider `json:"riders"`
+	Fare        float64     `json:"fare"`
+	UpdatedAt   int64       `json:"updated_at"`
+	// ReservationHolder holds the driver's reservation for the trip
+	ReservationHolder string `json:"reservation_holder,omitempty"`
+}
+
+// PoolMatch is the pooled trip a rider was matched into
+type PoolMatch struct {
+	TripID        string     `json:"trip_id"`
+	DriverID      string     `json:"driver_id"`
+	Route         []TripStop `json:"route"`
+	Riders        int        `json:"riders"`
+	Fare          float64    `json:"fare"`
+	DetourMinutes float64    `json:"detour_minutes"`
+}
+
+// Search statuses
+const (
+	SearchStatusSearching = "SEARCHING"
+	SearchStatusMatched   = "SUCCESS"
+	SearchStatusNoDrivers = "NO_DRIVERS_AVAILABLE"
+	SearchStatusCancelled = "CANCELLED"
+)
+
+// Search is a rider's ride search, tracked from the API request to its result
+type Search struct {
+	SearchID    string       `json:"search_id"`
+	UserID      string       `json:"user_id"`
+	City        string       `json:"city"`
+	Status      string       `json:"status"`
+	Candidates  []DriverInfo `json:"candidates"`
+	CreatedAt   int64        `json:"created_at"`
+	UpdatedAt   int64        `json:"updated_at"`
+	CompletedAt int64        `json:"completed_at,omitempty"`
+
+	// Set when the rider cancels the search
+	CancelReason string `json:"cancel_reason,omitempty"`
+	CancelledAt  int64  `json:"cancelled_at,omitempty"`
+
+	// DriverID is the driver who accepted the search's offer, whom the rider
+	// can rate once as DriverRating
+	DriverID     string `json:"driver_id,omitempty"`
+	DriverRating int    `json:"driver_rating,omitempty"`
+}
+
+// Reasons a candidate driver was filtered out of a search
+const (
+	FilterDuplicate    = "duplicate"
+	FilterBusy         = "busy"
+	FilterTooFar       = "too_far"
+	FilterWrongVehicle = "wrong_vehicle"
+	FilterOtherCity    = "other_city"
+	FilterBlocked      = "blocked"
+	// FilterUnmetRequirement drivers lack something the rider requires
+	FilterUnmetRequirement = "unmet_requirement"
+)
+
+// SearchTrace records how a search was matched, for debugging why a rider got
+// the drivers they did. A search has one attempt per run of its search plan.
+type SearchTrace struct {
+	SearchID    string         `json:"search_id"`
+	UserID      string         `json:"user_id"`
+	City        string         `json:"city"`
+	Latitude    float64        `json:"latitude"`
+	Longitude   float64        `json:"longitude"`
+	VehicleType string         `json:"vehicle_type,omitempty"`
+	Experiment  string         `json:"experiment,omitempty"`
+	Arm         string         `json:"arm,omitempty"`
+	Attempts    []TraceAttempt `json:"attempts"`
+	// Unreserved are selected drivers another request reserved first
+	Unreserved []FilteredDriver `json:"unreserved,omitempty"`
+	Outcome    string           `json:"outcome,omitempty"`
+	UpdatedAt  int64            `json:"updated_at"`
+}
+
+// TraceAttempt is one run of a search plan
+type TraceAttempt struct {
+	Plan       string           `json:"plan"`
+	StartedAt  int64            `json:"started_at"`
+	DurationMs float64          `json:"duration_ms"`
+	Steps      []TraceStep      `json:"steps"`
+	Ranked     []TraceCandidate `json:"ranked"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// TraceStep is one step of a search plan
+type TraceStep struct {
+	Resolution int              `json:"resolution"`
+	KRing      int              `json:"k_ring"`
+	Cells      []string         `json:"cells"`
+	Found      int              `json:"found"`
+	Kept       int              `json:"kept"`
+	Filtered   []FilteredDriver `json:"filtered,omitempty"`
+	DurationMs float64          `json:"duration_ms"`
+	TimedOut   bool             `json:"timed_out,omitempty"`
+}
+
+// FilteredDriver is a candidate driver a search discarded
+type FilteredDriver struct {
+	DriverID string  `json:"driver_id"`
+	Reason   string  `json:"reason"`
+	Distance float64 `json:"distance_km,omitempty"`
+}
+
+// TraceCandidate is a ranked candidate driver and whether it was selected
+type TraceCandidate struct {
+	DriverID    string          `json:"driver_id"`
+	VehicleType string          `json:"vehicle_type"`
+	Distance    float64         `json:"distance_km"`
+	ETA         int             `json:"eta_minutes"`
+	Score       *ScoreBreakdown `json:"score,omitempty"`
+	Selected    bool            `json:"selected"`
+}
+
+// ExperimentReport compares the outcomes of an experiment's arms
+type ExperimentReport struct {
+	Experiment string      `json:"experiment"`
+	Cities     []string    `json:"cities,omitempty"`
+	Arms       []ArmReport `json:"arms"`
+}
+
+// ArmReport is the outcome of the searches matched under one experiment arm
+type ArmReport struct {
+	Arm                  string  `json:"arm"`
+	Requests             int64   `json:"requests"`
+	Matched              int64   `json:"matched"`
+	MatchRate            float64 `json:"match_rate"`
+	MeanPickupETAMinutes float64 `json:"mean_pickup_eta_minutes"`
+}
+
+// Scheduled ride statuses
+const (
+	ScheduledRideBooked     = "SCHEDULED"
+	ScheduledRideDispatched = "DISPATCHED"
+	ScheduledRideCancelled  = "CANCELLED"
+)
+
+// ScheduledRide is a pickup booked in advance. Its search is started by the
+// scheduler a lead time before PickupAt.
+type ScheduledRide struct {
+	RideID      string  `json:"ride_id"`
+	UserID      string  `json:"user_id"`
+	City        string  `json:"city"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	VehicleType string  `json:"vehicle_type,omitempty"`
+	PickupAt    int64   `json:"pickup_at"`
+	Status      string  `json:"status"`
+	CreatedAt   int64   `json:"created_at"`
+
+	// Requirements and Preferences are passed on to the search at dispatch
+	Requirements *RideConstraints `json:"requirements,omitempty"`
+	Preferences  *RideConstraints `json:"preferences,omitempty"`
+
+	// Set once the scheduler has chosen when to dispatch and has dispatched
+	DispatchAt   int64  `json:"dispatch_at,omitempty"`
+	DispatchedAt int64  `json:"dispatched_at,omitempty"`
+	SearchID     string `json:"search_id,omitempty"`
+
+	// Set when the rider cancels the booking
+	CancelReason     string `json:"cancel_reason,omitempty"`
+	CancelledAt      int64  `json:"cancelled_at,omitempty"`
+	LateCancellation bool   `json:"late_cancellation,omitempty"`
+}
+
+// Who imposed a block between a rider and a driver
+const (
+	BlockedByRider  = "rider"
+	BlockedByDriver = "driver"
+	BlockedByAdmin  = "admin"
+)
+
+// Block keeps a rider and a driver from being matched with each other. A pair
+// can have one block from each of the rider, the driver and an admin, and
+// stays blocked until all of them are removed.
+type Block struct {
+	RiderID   string `json:"rider_id"`
+	DriverID  string `json:"driver_id"`
+	BlockedBy string `json:"blocked_by"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// NearbyArea is the part of the map shown on a rider's home screen
+type NearbyArea struct {
+	Latitude  float64
+	Longitude float64
+	// RadiusKm is capped by the service, which also uses its cap when unset
+	RadiusKm float64
+	// VehicleType limits the cars shown, if set
+	VehicleType string
+}
+
+// NearbyCar is the approximate position of an available driver shown on a
+// rider's home screen. The ID is only stable within one stream, so that
+// clients can animate a car without learning who drives it.
+type NearbyCar struct {
+	ID          string  `json:"id"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	Heading     float64 `json:"heading"`
 	VehicleType string  `json:"vehicle_type"`
-	Distance    float64 `json:"distance_km"`
-	ETA         int     `json:"eta_minutes"`
+}
+
+// NearbyUpdate is one refresh of the nearby cars stream
+type NearbyUpdate struct {
+	Cars      []NearbyCar `json:"cars"`
+	UpdatedAt int64       `json:"updated_at"`
+}
+
+// MatchEventVersion is the schema version of match events. Fields may be
+// added within a version; renaming, removing or retyping a field bumps it.
+const MatchEventVersion = 1
+
+// Match event types
+const (
+	EventSearchCreated    = "search.created"
+	EventSearchUpdated    = "search.updated"
+	EventSearchCandidates = "search.candidates"
+	EventOfferCreated     = "offer.created"
+	EventOfferAccepted    = "offer.accepted"
+	EventOfferDeclined    = "offer.declined"
+	EventSearchCompleted  = "search.completed"
+	EventSearchCancelled  = "search.cancelled"
+)
+
+// MatchEvent is a durable record of a step in matching a rider, published to
+// the city's match event topic keyed by user ID. The schema is documented in
+// docs/match-events.md.
+type MatchEvent struct {
+	Version    int    `json:"version"`
+	EventID    string `json:"event_id"`
+	Type       string `json:"type"`
+	OccurredAt int64  `json:"occurred_at"`
+	City       string `json:"city"`
+	SearchID   string `json:"search_id,omitempty"`
+	UserID     string `json:"user_id"`
+	DriverID   string `json:"driver_id,omitempty"`
+	Experiment string `json:"experiment,omitempty"`
+	Arm        string `json:"arm,omitempty"`
+
+	// Set depending on the event type
+	Request    *UserLocation `json:"request,omitempty"`
+	Status     string        `json:"status,omitempty"`
+	Candidates []DriverInfo  `json:"candidates,omitempty"`
+	Pool       *PoolMatch    `json:"pool,omitempty"`
+	Reason     string        `json:"reason,omitempty"`
+}
+
+// MatchUpdate is a message on a user's match stream. Data is the JSON payload
+// as delivered to clients, including its "seq" field.
+type MatchUpdate struct {
+	Seq  int64
+	Data []byte
+}
+
+// MatchUpdateResync is the status of the update a resuming client gets when
+// some updates after its last_seq are lost. The client drops what it knows of
+// its searches and takes the latest state, which follows, as the truth.
+const MatchUpdateResync = "RESYNC"
+
+// SocketProtocolVersion is the version of the typed WebSocket protocol that
+// clients select with the protocol query parameter. The protocol is
+// documented in docs/match-updates.md.
+const SocketProtocolVersion = 1
+
+// Message types of the typed WebSocket protocol
+const (
+	// Sent by clients
+	SocketStartSearch  = "start_search"
+	SocketUpdatePickup = "update_pickup"
+	SocketCancel       = "cancel"
+	SocketPing         = "ping"
+
+	// Sent by the server
+	SocketUpdate = "update"
+	SocketAck    = "ack"
+	SocketError  = "error"
+	SocketPong   = "pong"
+)
+
+// SocketEnvelope frames every message of the typed WebSocket protocol. Client
+// messages carry an ID that the server's ack, error or pong echoes; updates
+// carry the sequence number of the match update in their payload.
+type SocketEnvelope struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Seq     int64           `json:"seq,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// SocketErrorPayload is the payload of an error message
+type SocketErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"matching-service/internal/model"
+	"navik-backend/pkg/redisclient"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrBlockNotFound is returned when removing a block that does not exist
+var ErrBlockNotFound = errors.New("block not found")
+
+// blockSources are everyone who can block a pair, in the order they are checked
+var blockSources = []string{model.BlockedByRider, model.BlockedByDriver, model.BlockedByAdmin}
+
+// BlockRepository stores the blocks between riders and drivers. Blocks do not
+// expire.
+type BlockRepository interface {
+	// Block adds or replaces the block of a pair by the block's source
+	Block(ctx context.Context, block model.Block) error
+	// Unblock removes the block of a pair by one source
+	Unblock(ctx context.Context, riderID, driverID, blockedBy string) error
+	// ListBlocks returns every block the user is part of, as rider or driver
+	ListBlocks(ctx context.Context, userID string) ([]model.Block, error)
+	// BlockedDrivers returns the drivers blocked from being matched with the
+	// rider by anyone
+	BlockedDrivers(ctx context.Context, riderID string, driverIDs []string) (map[string]bool, error)
+}
+
+type redisBlockRepository struct {
+	redisClient redis.UniversalClient
+}
+
+// NewBlockRepository creates a block repository. Each user has a hash of the
+// blocks they are part of, with a field per counterparty and source, so the
+// blocks of a rider's candidates are read with one HMGET.
+func NewBlockRepository(redisClient redis.UniversalClient) BlockRepository {
+	return &redisBlockRepository{
+		redisClient: redisClient,
+	}
+}
+
+func blocksKey(userID string) string {
+	return redisclient.UserKey(userID, "blocks")
+}
+
+func blockField(counterpartyID, blockedBy string) string {
+	return counterpartyID + ":" + blockedBy
+}
+
+// Block writes the block to both users' hashes
+func (r *redisBlockRepository) Block(ctx context.Context, block model.Block) error {
+	data, err := json.Marshal(block)
+	if err != nil {
+		return fmt.Errorf("failed to marshal block: %w", err)
+	}
+
+	_, err = r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, blocksKey(block.RiderID), blockField(block.DriverID, block.BlockedBy), data)
+		pipe.HSet(ctx, blocksKey(block.DriverID), blockField(block.RiderID, block.BlockedBy), data)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to block driver %s for rider %s: %w", block.DriverID, block.RiderID, err)
+	}
+	return nil
+}
+
+// Unblock removes the block from both users' hashes
+func (r *redisBlockRepository) Unblock(ctx context.Context, riderID, driverID, blockedBy string) error {
+	var removed *redis.IntCmd
+	_, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		removed = pipe.HDel(ctx, blocksKey(riderID), blockField(driverID, blockedBy))
+		pipe.HDel(ctx, blocksKey(driverID), blockField(riderID, blockedBy))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to unblock driver %s for rider %s: %w", driverID, riderID, err)
+	}
+	if removed.Val() == 0 {
+		return ErrBlockNotFound
+	}
+	return nil
+}
+
+// ListBlocks reads the user's hash
+func (r *redisBlockRepository) ListBlocks(ctx context.Context, userID string) ([]model.Block, error) {
+	values, err := r.redisClient.HGetAll(ctx, blocksKey(userID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blocks of user %s: %w", userID, err)
+	}
+
+	blocks := make([]model.Block, 0, len(values))
+	for field, value := range values {
+		var block model.Block
+		if err := json.Unmarshal([]byte(value), &block); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal block %s of user %s: %w", field, userID, err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// BlockedDrivers reads the fields of every source for each driver from the
+// rider's hash
+func (r *redisBlockRepository) BlockedDrivers(ctx context.Context, riderID string, driverIDs []string) (map[string]bool, error) {
+	blocked := make(map[string]bool)
+	if len(driverIDs) == 0 {
+		return blocked, nil
+	}
+
+	fields := make([]string, 0, len(driverIDs)*len(blockSources))
+	for _, driverID := range driverIDs {
+		for _, source := range blockSources {
+			fields = append(fields, blockField(driverID, source))
+		}
+	}
+
+	values, err := r.redisClient.HMGet(ctx, blocksKey(riderID), fields...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blocks of rider %s: %w", riderID, err)
+	}
+
+	for i, value := range values {
+		if value != nil {
+			blocked[driverIDs[i/len(blockSources)]] = true
+		}
+	}
+	return blocked, nil
+}
@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"matching-service/internal/model"
+	"matching-service/internal/util"
+)
+
+// indexResolutions are the H3 resolutions the in-memory index buckets drivers by
+var indexResolutions = []int{7, 8, 9}
+
+// driverStatusActive is the status of drivers available for matching
+const driverStatusActive = "ACTIVE"
+
+type indexedDriver struct {
+	driver model.DriverLocation
+	cells  map[int]string
+}
+
+// DriverIndex is an in-memory H3-bucketed index of live drivers. It serves the
+// same lookups as the DynamoDB repository and evicts drivers whose location
+// has not been refreshed within the TTL.
+type DriverIndex struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.RWMutex
+	drivers map[string]*indexedDriver
+	cells   map[int]map[string]map[string]struct{} // resolution -> cell -> driver IDs
+}
+
+// NewDriverIndex creates an empty driver index
+func NewDriverIndex(ttl time.Duration) *DriverIndex {
+	cells := make(map[int]map[string]map[string]struct{})
+	for _, res := range indexResolutions {
+		cells[res] = make(map[string]map[string]struct{})
+	}
+
+	return &DriverIndex{
+		ttl:     ttl,
+		now:     time.Now,
+		drivers: make(map[string]*indexedDriver),
+		cells:   cells,
+	}
+}
+
+// SetClock replaces the clock that location freshness is judged against, so
+// that recorded locations can be replayed in virtual time
+func (i *DriverIndex) SetClock(now func() time.Time) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.now = now
+}
+
+func (i *DriverIndex) currentTime() time.Time {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.now()
+}
+
+// ApplyUpdate applies a location update from the location topics. Drivers
+// that are no longer active are removed from the index.
+func (i *DriverIndex) ApplyUpdate(update model.DriverLocationUpdate) {
+	if update.Status != driverStatusActive {
+		i.Remove(update.DriverID)
+		return
+	}
+
+	i.Upsert(model.DriverLocation{
+		DriverID:    update.DriverID,
+		City:        update.City,
+		Latitude:    update.Latitude,
+		Longitude:   update.Longitude,
+		VehicleType: update.VehicleType,
+		Status:      update.Status,
+		Heading:     update.Heading,
+		UpdatedAt:   update.Timestamp,
+
+		Capabilities: update.Capabilities,
+		DriverGender: update.DriverGender,
+	})
+}
+
+// Upsert adds or moves a driver, ignoring updates older than the indexed one
+func (i *DriverIndex) Upsert(driver model.DriverLocation) {
+	if driver.DriverID == "" {
+		return
+	}
+	if driver.UpdatedAt == 0 {
+		driver.UpdatedAt = i.currentTime().Unix()
+	}
+
+	cells := make(map[int]string, len(indexResolutions))
+	for _, res := range indexResolutions {
+		cells[res] = util.GeoToH3Index(driver.Latitude, driver.Longitude, res)
+	}
+	driver.H3Res9, driver.H3Res8, driver.H3Res7 = cells[9], cells[8], cells[7]
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if existing, ok := i.drivers[driver.DriverID]; ok {
+		if existing.driver.UpdatedAt > driver.UpdatedAt {
+			return
+		}
+		// Location updates do not carry the driver's quality signals
+		if driver.Rating == 0 {
+			driver.Rating = existing.driver.Rating
+		}
+		if driver.AcceptanceRate == 0 {
+			driver.AcceptanceRate = existing.driver.AcceptanceRate
+		}
+		if driver.LastTripAt == 0 {
+			driver.LastTripAt = existing.driver.LastTripAt
+		}
+		i.unlink(driver.DriverID, existing)
+	}
+
+	entry := &indexedDriver{driver: driver, cells: cells}
+	i.drivers[driver.DriverID] = entry
+	for res, cell := range cells {
+		bucket, ok := i.cells[res][cell]
+		if !ok {
+			bucket = make(map[string]struct{})
+			i.cells[res][cell] = bucket
+		}
+		bucket[driver.DriverID] = struct{}{}
+	}
+}
+
+// Remove drops a driver from the index
+func (i *DriverIndex) Remove(driverID string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if existing, ok := i.drivers[driverID]; ok {
+		i.unlink(driverID, existing)
+		delete(i.drivers, driverID)
+	}
+}
+
+// FindDriversInCells returns the live drivers in the given cells of one resolution
+func (i *DriverIndex) FindDriversInCells(ctx context.Context, resolution int, h3Indices []string) ([]model.DriverLocation, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	cutoff := i.now().Add(-i.ttl).Unix()
+
+	buckets := i.cells[resolution]
+	drivers := []model.DriverLocation{}
+	for _, cell := range h3Indices {
+		for driverID := range buckets[cell] {
+			entry := i.drivers[driverID]
+			if entry.driver.UpdatedAt < cutoff {
+				continue
+			}
+			drivers = append(drivers, entry.driver)
+		}
+	}
+
+	return drivers, nil
+}
+
+// Len returns the number of indexed drivers
+func (i *DriverIndex) Len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return len(i.drivers)
+}
+
+// Bootstrap loads the active drivers from a snapshot source. Updates already
+// received from Kafka win over older snapshot entries.
+func (i *DriverIndex) Bootstrap(ctx context.Context, source DriverSnapshotter) error {
+	drivers, err := source.ActiveDrivers(ctx, i.currentTime().Add(-i.ttl).Unix())
+	if err != nil {
+		return err
+	}
+
+	for _, driver := range drivers {
+		i.Upsert(driver)
+	}
+
+	log.Printf("Bootstrapped driver index with %d drivers", len(drivers))
+	return nil
+}
+
+// RunEviction periodically removes drivers whose TTL has expired until the
+// context is cancelled
+func (i *DriverIndex) RunEviction(ctx context.Context) {
+	ticker := time.NewTicker(i.ttl / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if evicted := i.evict(i.currentTime().Add(-i.ttl).Unix()); evicted > 0 {
+				log.Printf("Evicted %d stale drivers from index, %d remaining", evicted, i.Len())
+			}
+		}
+	}
+}
+
+func (i *DriverIndex) evict(cutoff int64) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	evicted := 0
+	for driverID, entry := range i.drivers {
+		if entry.driver.UpdatedAt < cutoff {
+			i.unlink(driverID, entry)
+			delete(i.drivers, driverID)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// unlink removes a driver from its cell buckets; the caller holds the lock
+func (i *DriverIndex) unlink(driverID string, entry *indexedDriver) {
+	for res, cell := range entry.cells {
+		bucket := i.cells[res][cell]
+		delete(bucket, driverID)
+		if len(bucket) == 0 {
+			delete(i.cells[res], cell)
+		}
+	}
+}
@@ -18,14 +18,34 @@ import (
 
 // DriverRepository defines the interface for driver data access
 type DriverRepository interface {
-	FindDriversInH9Cell(ctx context.Context, h3Index string) ([]model.DriverLocation, error)
-	FindDriversInH9Cells(ctx context.Context, h3Indices []string) ([]model.DriverLocation, error)
-	FindDriversInH8Cell(ctx context.Context, h3Index string) ([]model.DriverLocation, error)
-	FindDriversInH8Cells(ctx context.Context, h3Indices []string) ([]model.DriverLocation, error)
-	FindDriversInH7Cell(ctx context.Context, h3Index string) ([]model.DriverLocation, error)
-	FindDriversInH7Cells(ctx context.Context, h3Indices []string) ([]model.DriverLocation, error)
+	// FindDriversInCells returns the active drivers in the given H3 cells of one resolution
+	FindDriversInCells(ctx context.Context, resolution int, h3Indices []string) ([]model.DriverLocation, error)
 }
 
+// DriverSnapshotter lists every active driver, used to bootstrap in-memory indexes
+type DriverSnapshotter interface {
+	ActiveDrivers(ctx context.Context, updatedSince int64) ([]model.DriverLocation, error)
+}
+
+// cellIndex is the GSI that holds active drivers keyed by H3 cell at one
+// resolution. Its partitions group the cells sharing a key prefix, so the
+// driver's own cell is read from cellAttribute.
+type cellIndex struct {
+	indexName     string
+	keyAttribute  string
+	cellAttribute string
+}
+
+var cellIndexes = map[int]cellIndex{
+	9: {indexName: "StatusH3Index", keyAttribute: "GSI1PK", cellAttribute: "h3_res9"},
+	8: {indexName: "StatusH3Res8Index", keyAttribute: "GSI2PK", cellAttribute: "h3_res8"},
+	7: {indexName: "StatusH3Res7Index", keyAttribute: "GSI3PK", cellAttribute: "h3_res7"},
+}
+
+// maxCellsPerQuery keeps a query's cell filter within DynamoDB's limit of
+// 100 values in an IN condition
+const maxCellsPerQuery = 100
+
 type driverRepository struct {
 	ddb       *dynamodb.DynamoDB
 	tableName string
@@ -39,96 +59,71 @@ func NewDriverRepository(ddb *dynamodb.DynamoDB, tableName string) DriverReposit
 	}
 }
 
-// FindDriversInH9Cell queries the database for drivers in a specific H9 cell
-func (r *driverRepository) FindDriversInH9Cell(ctx context.Context, h3Index string) ([]model.DriverLocation, error) {
-	h3Prefix := util.SafePrefix(h3Index, 5)
-	gsi1pk := fmt.Sprintf("ACTIVE#H3#9#%s", h3Prefix)
-
-	input := &dynamodb.QueryInput{
-		TableName:              aws.String(r.tableName),
-		IndexName:              aws.String("StatusH3Index"),
-		KeyConditionExpression: aws.String("GSI1PK = :gsi1pk"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":gsi1pk": {
-				S: aws.String(gsi1pk),
-			},
-		},
-	}
-
-	result, err := r.ddb.QueryWithContext(ctx, input)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query DynamoDB: %w", err)
+// NewDriverSnapshotter creates a snapshot source that scans the driver table
+func NewDriverSnapshotter(ddb *dynamodb.DynamoDB, tableName string) DriverSnapshotter {
+	return &driverRepository{
+		ddb:       ddb,
+		tableName: tableName,
 	}
-
-	return r.parseDriverItems(result.Items)
 }
 
-// FindDriversInH9Cells queries DynamoDB for drivers in multiple H9 cells
-func (r *driverRepository) FindDriversInH9Cells(ctx context.Context, h3Indices []string) ([]model.DriverLocation, error) {
-	if len(h3Indices) == 0 {
-		return []model.DriverLocation{}, nil
+// ActiveDrivers scans DynamoDB for active drivers updated since the given time
+func (r *driverRepository) ActiveDrivers(ctx context.Context, updatedSince int64) ([]model.DriverLocation, error) {
+	input := &dynamodb.ScanInput{
+		TableName:        aws.String(r.tableName),
+		FilterExpression: aws.String("#status = :active AND updated_at >= :since"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":active": {S: aws.String("ACTIVE")},
+			":since":  {N: aws.String(strconv.FormatInt(updatedSince, 10))},
+		},
 	}
 
-	var wg sync.WaitGroup
-	var mu sync.Mutex
 	var allDrivers []model.DriverLocation
-	var queryErrors []error
-
-	for _, h3Index := range h3Indices {
-		wg.Add(1)
-		go func(index string) {
-			defer wg.Done()
-
-			drivers, err := r.FindDriversInH9Cell(ctx, index)
-			if err != nil {
-				mu.Lock()
-				queryErrors = append(queryErrors, fmt.Errorf("failed to query H9 cell %s: %w", index, err))
-				mu.Unlock()
-				return
-			}
-
-			mu.Lock()
-			allDrivers = append(allDrivers, drivers...)
-			mu.Unlock()
-		}(h3Index)
+	var parseErr error
+	err := r.ddb.ScanPagesWithContext(ctx, input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		drivers, err := r.parseDriverItems(page.Items)
+		if err != nil {
+			parseErr = err
+			return false
+		}
+		allDrivers = append(allDrivers, drivers...)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan DynamoDB: %w", err)
 	}
-
-	wg.Wait()
-
-	if len(queryErrors) > 0 {
-		return allDrivers, fmt.Errorf("errors occurred during queries: %v", queryErrors)
+	if parseErr != nil {
+		return nil, parseErr
 	}
 
 	return allDrivers, nil
 }
 
-// FindDriversInH8Cell queries DynamoDB for drivers in a specific H8 cell
-func (r *driverRepository) FindDriversInH8Cell(ctx context.Context, h8Index string) ([]model.DriverLocation, error) {
-	h8Prefix := util.SafePrefix(h8Index, 5)
-
-	input := &dynamodb.QueryInput{
-		TableName:              aws.String(r.tableName),
-		IndexName:              aws.String("StatusH3Res8Index"),
-		KeyConditionExpression: aws.String("GSI2PK = :gsi2pk"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":gsi2pk": {
-				S: aws.String(fmt.Sprintf("ACTIVE#H3#8#%s", h8Prefix)),
-			},
-		},
+// FindDriversInCells queries DynamoDB for drivers in multiple cells of one resolution
+func (r *driverRepository) FindDriversInCells(ctx context.Context, resolution int, h3Indices []string) ([]model.DriverLocation, error) {
+	index, ok := cellIndexes[resolution]
+	if !ok {
+		return nil, fmt.Errorf("unsupported H3 resolution %d", resolution)
 	}
 
-	result, err := r.ddb.QueryWithContext(ctx, input)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query DynamoDB for H8 cell: %w", err)
+	if len(h3Indices) == 0 {
+		return []model.DriverLocation{}, nil
 	}
 
-	return r.parseDriverItems(result.Items)
-}
-
-// FindDriversInH8Cells queries DynamoDB for drivers in multiple H8 cells
-func (r *driverRepository) FindDriversInH8Cells(ctx context.Context, h8Indices []string) ([]model.DriverLocation, error) {
-	if len(h8Indices) == 0 {
-		return []model.DriverLocation{}, nil
+	// Cells sharing a key prefix share a GSI partition, so query each
+	// partition once for all of its requested cells
+	partitionCells := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, h3Index := range h3Indices {
+		if seen[h3Index] {
+			continue
+		}
+		seen[h3Index] = true
+		partitionKey := fmt.Sprintf("ACTIVE#H3#%d#%s", resolution, util.SafePrefix(h3Index, 5))
+		partitionCells[partitionKey] = append(partitionCells[partitionKey], h3Index)
 	}
 
 	var wg sync.WaitGroup
@@ -136,23 +131,30 @@ func (r *driverRepository) FindDriversInH8Cells(ctx context.Context, h8Indices [
 	var allDrivers []model.DriverLocation
 	var queryErrors []error
 
-	for _, h8Index := range h8Indices {
-		wg.Add(1)
-		go func(index string) {
-			defer wg.Done()
+	for partitionKey, cells := range partitionCells {
+		for start := 0; start < len(cells); start += maxCellsPerQuery {
+			end := start + maxCellsPerQuery
+			if end > len(cells) {
+				end = len(cells)
+			}
+
+			wg.Add(1)
+			go func(key string, cells []string) {
+				defer wg.Done()
+
+				drivers, err := r.queryCellIndex(ctx, index, key, cells)
+				if err != nil {
+					mu.Lock()
+					queryErrors = append(queryErrors, fmt.Errorf("failed to query H%d partition %s: %w", resolution, key, err))
+					mu.Unlock()
+					return
+				}
 
-			drivers, err := r.FindDriversInH8Cell(ctx, index)
-			if err != nil {
 				mu.Lock()
-				queryErrors = append(queryErrors, fmt.Errorf("failed to query H8 cell %s: %w", index, err))
+				allDrivers = append(allDrivers, drivers...)
 				mu.Unlock()
-				return
-			}
-
-			mu.Lock()
-			allDrivers = append(allDrivers, drivers...)
-			mu.Unlock()
-		}(h8Index)
+			}(partitionKey, cells[start:end])
+		}
 	}
 
 	wg.Wait()
@@ -164,66 +166,51 @@ func (r *driverRepository) FindDriversInH8Cells(ctx context.Context, h8Indices [
 	return allDrivers, nil
 }
 
-// FindDriversInH7Cell queries DynamoDB for drivers in a specific H7 cell
-func (r *driverRepository) FindDriversInH7Cell(ctx context.Context, h7Index string) ([]model.DriverLocation, error) {
-	h7Prefix := util.SafePrefix(h7Index, 5)
+// queryCellIndex queries one partition of a cell GSI for the drivers in the
+// given cells, reading every page of the result
+func (r *driverRepository) queryCellIndex(ctx context.Context, index cellIndex, partitionKey string, cells []string) ([]model.DriverLocation, error) {
+	values := map[string]*dynamodb.AttributeValue{
+		":pk": {
+			S: aws.String(partitionKey),
+		},
+	}
+	placeholders := make([]string, len(cells))
+	for i, cell := range cells {
+		placeholder := fmt.Sprintf(":c%d", i)
+		placeholders[i] = placeholder
+		values[placeholder] = &dynamodb.AttributeValue{S: aws.String(cell)}
+	}
 
 	input := &dynamodb.QueryInput{
 		TableName:              aws.String(r.tableName),
-		IndexName:              aws.String("StatusH3Res7Index"),
-		KeyConditionExpression: aws.String("GSI3PK = :gsi3pk"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":gsi3pk": {
-				S: aws.String(fmt.Sprintf("ACTIVE#H3#7#%s", h7Prefix)),
-			},
+		IndexName:              aws.String(index.indexName),
+		KeyConditionExpression: aws.String(index.keyAttribute + " = :pk"),
+		FilterExpression:       aws.String("#cell IN (" + strings.Join(placeholders, ", ") + ")"),
+		ExpressionAttributeNames: map[string]*string{
+			"#cell": aws.String(index.cellAttribute),
 		},
+		ExpressionAttributeValues: values,
 	}
 
-	result, err := r.ddb.QueryWithContext(ctx, input)
+	var drivers []model.DriverLocation
+	var parseErr error
+	err := r.ddb.QueryPagesWithContext(ctx, input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		pageDrivers, err := r.parseDriverItems(page.Items)
+		if err != nil {
+			parseErr = err
+			return false
+		}
+		drivers = append(drivers, pageDrivers...)
+		return true
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to query DynamoDB for H7 cell: %w", err)
-	}
-
-	return r.parseDriverItems(result.Items)
-}
-
-// FindDriversInH7Cells queries DynamoDB for drivers in multiple H7 cells
-func (r *driverRepository) FindDriversInH7Cells(ctx context.Context, h7Indices []string) ([]model.DriverLocation, error) {
-	if len(h7Indices) == 0 {
-		return []model.DriverLocation{}, nil
-	}
-
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var allDrivers []model.DriverLocation
-	var queryErrors []error
-
-	for _, h7Index := range h7Indices {
-		wg.Add(1)
-		go func(index string) {
-			defer wg.Done()
-
-			drivers, err := r.FindDriversInH7Cell(ctx, index)
-			if err != nil {
-				mu.Lock()
-				queryErrors = append(queryErrors, fmt.Errorf("failed to query H7 cell %s: %w", index, err))
-				mu.Unlock()
-				return
-			}
-
-			mu.Lock()
-			allDrivers = append(allDrivers, drivers...)
-			mu.Unlock()
-		}(h7Index)
+		return nil, fmt.Errorf("failed to query DynamoDB: %w", err)
 	}
-
-	wg.Wait()
-
-	if len(queryErrors) > 0 {
-		return allDrivers, fmt.Errorf("errors occurred during queries: %v", queryErrors)
+	if parseErr != nil {
+		return nil, parseErr
 	}
 
-	return allDrivers, nil
+	return drivers, nil
 }
 
 // Helper function to parse DynamoDB items into driver locations
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"matching-service/internal/model"
+	"navik-backend/pkg/redisclient"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Fields of a driver's stats hash
+const (
+	statsResponses  = "responses"
+	statsAccepts    = "accepts"
+	statsLastTripAt = "last_trip_at"
+	statsRatingSum  = "rating_sum"
+	statsRatings    = "ratings"
+)
+
+// DriverStatsRepository keeps the quality signals drivers are ranked on, from
+// how they answer offers and how riders rate them. Stats do not expire.
+type DriverStatsRepository interface {
+	// RecordResponse counts a driver's answer to an offer. An accepted offer
+	// is the driver's latest trip.
+	RecordResponse(ctx context.Context, driverID string, accepted bool, at time.Time) error
+	// RecordRating adds a rider's rating of 1 to 5 stars
+	RecordRating(ctx context.Context, driverID string, stars int) error
+	// Get returns the stats of the drivers that have any
+	Get(ctx context.Context, driverIDs []string) (map[string]model.DriverStats, error)
+}
+
+type redisDriverStatsRepository struct {
+	redisClient redis.UniversalClient
+}
+
+// NewDriverStatsRepository creates a driver stats repository. Each driver has
+// a hash of counters, so a response or rating is one atomic increment.
+func NewDriverStatsRepository(redisClient redis.UniversalClient) DriverStatsRepository {
+	return &redisDriverStatsRepository{
+		redisClient: redisClient,
+	}
+}
+
+func driverStatsKey(driverID string) string {
+	return redisclient.UserKey(driverID, "stats")
+}
+
+// RecordResponse increments the driver's response counters
+func (r *redisDriverStatsRepository) RecordResponse(ctx context.Context, driverID string, accepted bool, at time.Time) error {
+	key := driverStatsKey(driverID)
+	_, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, key, statsResponses, 1)
+		if accepted {
+			pipe.HIncrBy(ctx, key, statsAccepts, 1)
+			pipe.HSet(ctx, key, statsLastTripAt, at.Unix())
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record response of driver %s: %w", driverID, err)
+	}
+	return nil
+}
+
+// RecordRating adds the rating to the driver's rating total
+func (r *redisDriverStatsRepository) RecordRating(ctx context.Context, driverID string, stars int) error {
+	key := driverStatsKey(driverID)
+	_, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, key, statsRatingSum, int64(stars))
+		pipe.HIncrBy(ctx, key, statsRatings, 1)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record rating of driver %s: %w", driverID, err)
+	}
+	return nil
+}
+
+// Get reads every driver's hash in one pipeline. The acceptance rate is
+// smoothed as if each driver had accepted one offer and declined one, so it
+// starts at one half and a single answer does not decide it.
+func (r *redisDriverStatsRepository) Get(ctx context.Context, driverIDs []string) (map[string]model.DriverStats, error) {
+	stats := make(map[string]model.DriverStats)
+	if len(driverIDs) == 0 {
+		return stats, nil
+	}
+
+	cmds := make([]*redis.SliceCmd, len(driverIDs))
+	_, err := r.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, driverID := range driverIDs {
+			cmds[i] = pipe.HMGet(ctx, driverStatsKey(driverID),
+				statsResponses, statsAccepts, statsLastTripAt, statsRatingSum, statsRatings)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read driver stats: %w", err)
+	}
+
+	for i, cmd := range cmds {
+		values := cmd.Val()
+		if len(values) != 5 {
+			continue
+		}
+		responses, accepts := statsInt(values[0]), statsInt(values[1])
+		lastTripAt := statsInt(values[2])
+		ratingSum, ratings := statsInt(values[3]), statsInt(values[4])
+		if responses == 0 && ratings == 0 {
+			continue
+		}
+
+		driverStats := model.DriverStats{LastTripAt: lastTripAt}
+		if responses > 0 {
+			driverStats.AcceptanceRate = float64(accepts+1) / float64(responses+2)
+		}
+		if ratings > 0 {
+			driverStats.Rating = float64(ratingSum) / float64(ratings)
+		}
+		stats[driverIDs[i]] = driverStats
+	}
+	return stats, nil
+}
+
+// statsInt parses a counter of a stats hash, treating a missing field as zero
+func statsInt(value interface{}) int64 {
+	s, ok := value.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
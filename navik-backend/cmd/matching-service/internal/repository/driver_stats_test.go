@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDriverStats(t *testing.T) {
+	at := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name           string
+		responses      []bool
+		ratings        []int
+		wantStats      bool
+		wantRating     float64
+		wantAcceptance float64
+		wantLastTripAt int64
+	}{
+		{name: "no stats"},
+		{name: "one accept", responses: []bool{true}, wantStats: true, wantAcceptance: 2.0 / 3, wantLastTripAt: at.Unix()},
+		{name: "one decline", responses: []bool{false}, wantStats: true, wantAcceptance: 1.0 / 3},
+		{
+			name:           "mixed responses",
+			responses:      []bool{true, true, true, false},
+			wantStats:      true,
+			wantAcceptance: 4.0 / 6,
+			wantLastTripAt: at.Unix(),
+		},
+		{name: "ratings only", ratings: []int{5, 4, 3}, wantStats: true, wantRating: 4},
+		{
+			name:           "responses and ratings",
+			responses:      []bool{true},
+			ratings:        []int{5},
+			wantStats:      true,
+			wantRating:     5,
+			wantAcceptance: 2.0 / 3,
+			wantLastTripAt: at.Unix(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			_, client := newTestRedis(t)
+			driverStats := NewDriverStatsRepository(client)
+
+			for _, accepted := range tt.responses {
+				if err := driverStats.RecordResponse(ctx, "d1", accepted, at); err != nil {
+					t.Fatalf("RecordResponse: %v", err)
+				}
+			}
+			for _, stars := range tt.ratings {
+				if err := driverStats.RecordRating(ctx, "d1", stars); err != nil {
+					t.Fatalf("RecordRating: %v", err)
+				}
+			}
+
+			stats, err := driverStats.Get(ctx, []string{"d1", "d2"})
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if _, ok := stats["d2"]; ok {
+				t.Errorf("stats for driver without any")
+			}
+			got, ok := stats["d1"]
+			if ok != tt.wantStats {
+				t.Fatalf("stats found = %t, want %t", ok, tt.wantStats)
+			}
+			if math.Abs(got.Rating-tt.wantRating) > 1e-9 {
+				t.Errorf("rating = %v, want %v", got.Rating, tt.wantRating)
+			}
+			if math.Abs(got.AcceptanceRate-tt.wantAcceptance) > 1e-9 {
+				t.Errorf("acceptance rate = %v, want %v", got.AcceptanceRate, tt.wantAcceptance)
+			}
+			if got.LastTripAt != tt.wantLastTripAt {
+				t.Errorf("last trip = %d, want %d", got.LastTripAt, tt.wantLastTripAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ArmStats are the accumulated search outcomes of one experiment arm
+type ArmStats struct {
+	Requests         int64
+	Matched          int64
+	PickupETAMinutes int64
+}
+
+// ExperimentRepository accumulates search outcomes per experiment arm
+type ExperimentRepository interface {
+	// RecordOutcome counts a finished search. The pickup ETA is only counted
+	// for matched searches.
+	RecordOutcome(ctx context.Context, experiment, arm string, matched bool, pickupETAMinutes int) error
+	// Stats returns the accumulated outcomes of the given arms
+	Stats(ctx context.Context, experiment string, arms []string) (map[string]ArmStats, error)
+}
+
+type redisExperimentRepository struct {
+	redisClient redis.UniversalClient
+}
+
+// NewExperimentRepository creates an experiment repository backed by Redis hashes
+func NewExperimentRepository(redisClient redis.UniversalClient) ExperimentRepository {
+	return &redisExperimentRepository{
+		redisClient: redisClient,
+	}
+}
+
+// RecordOutcome increments the arm's counters
+func (r *redisExperimentRepository) RecordOutcome(ctx context.Context, experiment, arm string, matched bool, pickupETAMinutes int) error {
+	key := experimentArmKey(experiment, arm)
+
+	_, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, key, "requests", 1)
+		if matched {
+			pipe.HIncrBy(ctx, key, "matched", 1)
+			pipe.HIncrBy(ctx, key, "pickup_eta_minutes", int64(pickupETAMinutes))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record outcome of %s/%s: %w", experiment, arm, err)
+	}
+	return nil
+}
+
+// Stats reads the counters of each arm
+func (r *redisExperimentRepository) Stats(ctx context.Context, experiment string, arms []string) (map[string]ArmStats, error) {
+	pipe := r.redisClient.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(arms))
+	for i, arm := range arms {
+		cmds[i] = pipe.HGetAll(ctx, experimentArmKey(experiment, arm))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to read stats of experiment %s: %w", experiment, err)
+	}
+
+	stats := make(map[string]ArmStats, len(arms))
+	for i, arm := range arms {
+		counters := cmds[i].Val()
+		stats[arm] = ArmStats{
+			Requests:         parseCounter(counters["requests"]),
+			Matched:          parseCounter(counters["matched"]),
+			PickupETAMinutes: parseCounter(counters["pickup_eta_minutes"]),
+		}
+	}
+	return stats, nil
+}
+
+func parseCounter(value string) int64 {
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n
+}
+
+func experimentArmKey(experiment, arm string) string {
+	return fmt.Sprintf("experiment:%s:%s", experiment, arm)
+}
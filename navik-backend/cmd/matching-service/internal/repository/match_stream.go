@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"matching-service/internal/model"
+	"navik-backend/pkg/redisclient"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// MatchStreamRepository stores the sequenced stream of match updates for a user
+type MatchStreamRepository interface {
+	// Publish assigns the next sequence number to a JSON object payload, appends
+	// it to the user's stream, stores it as the latest state and publishes it
+	Publish(ctx context.Context, userID string, payload []byte) (int64, error)
+	// Since returns the updates with a sequence number greater than seq. It
+	// reports false if any of them are gone, because the stream was trimmed
+	// or expired, or if seq is ahead of the user's sequence.
+	Since(ctx context.Context, userID string, seq int64) (updates []model.MatchUpdate, complete bool, err error)
+	// Latest returns the most recent update, or nil if there is none
+	Latest(ctx context.Context, userID string) (*model.MatchUpdate, error)
+}
+
+// publishScript assigns the sequence number and performs every write in one
+// step, so the stream, the latest state and pub/sub subscribers all observe
+// updates in the same order. The sequence number is spliced into the payload
+// as its first field. The channel is not a key, so it is passed as ARGV[4].
+// The sequence never expires, so it does not restart while a client may
+// still resume from an earlier number.
+var publishScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[1])
+local payload = ARGV[1]
+local data
+if string.len(payload) <= 2 then
+	data = '{"seq":' .. seq .. '}'
+else
+	data = '{"seq":' .. seq .. ',' .. string.sub(payload, 2)
+end
+redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[2], seq .. '-0', 'data', data)
+redis.call('SET', KEYS[3], data, 'EX', ARGV[3])
+redis.call('EXPIRE', KEYS[2], ARGV[3])
+redis.call('PUBLISH', ARGV[4], data)
+return seq
+`)
+
+type redisMatchStreamRepository struct {
+	redisClient redis.UniversalClient
+	maxLen      int64
+	ttl         time.Duration
+}
+
+// NewMatchStreamRepository creates a match stream repository backed by Redis Streams
+func NewMatchStreamRepository(redisClient redis.UniversalClient, maxLen int64, ttl time.Duration) MatchStreamRepository {
+	return &redisMatchStreamRepository{
+		redisClient: redisClient,
+		maxLen:      maxLen,
+		ttl:         ttl,
+	}
+}
+
+// Publish appends a payload to the user's match stream and returns its sequence number
+func (r *redisMatchStreamRepository) Publish(ctx context.Context, userID string, payload []byte) (int64, error) {
+	keys := []string{
+		redisclient.UserKey(userID, "seq"),
+		redisclient.UserKey(userID, "stream"),
+		redisclient.UserKey(userID, "matches"),
+	}
+
+	seq, err := publishScript.Run(ctx, r.redisClient, keys, string(payload), r.maxLen, int64(r.ttl.Seconds()), redisclient.UserChannel(userID)).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to publish match update: %w", err)
+	}
+
+	return seq, nil
+}
+
+// Since reads the updates after seq from the user's match stream
+func (r *redisMatchStreamRepository) Since(ctx context.Context, userID string, seq int64) ([]model.MatchUpdate, bool, error) {
+	// Entry IDs are "<seq>-0", so "<seq>-1" is the first ID after seq
+	start := fmt.Sprintf("%d-1", seq)
+
+	var current *redis.StringCmd
+	var messages *redis.XMessageSliceCmd
+	_, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		current = pipe.Get(ctx, redisclient.UserKey(userID, "seq"))
+		messages = pipe.XRange(ctx, redisclient.UserKey(userID, "stream"), start, "+")
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, false, fmt.Errorf("failed to read match stream: %w", err)
+	}
+
+	latestSeq, err := current.Int64()
+	if err != nil && err != redis.Nil {
+		return nil, false, fmt.Errorf("failed to read match sequence: %w", err)
+	}
+	if seq > latestSeq {
+		return nil, false, nil
+	}
+
+	updates := make([]model.MatchUpdate, 0, len(messages.Val()))
+	for _, msg := range messages.Val() {
+		update, ok := parseStreamMessage(msg)
+		if !ok {
+			continue
+		}
+		updates = append(updates, update)
+	}
+
+	complete := seq == latestSeq || (len(updates) > 0 && updates[0].Seq == seq+1)
+	return updates, complete, nil
+}
+
+// Latest reads the user's most recent match update from the latest-state key
+func (r *redisMatchStreamRepository) Latest(ctx context.Context, userID string) (*model.MatchUpdate, error) {
+	data, err := r.redisClient.Get(ctx, redisclient.UserKey(userID, "matches")).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read latest match state: %w", err)
+	}
+
+	var header struct {
+		Seq int64 `json:"seq"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("failed to parse latest match state: %w", err)
+	}
+
+	return &model.MatchUpdate{Seq: header.Seq, Data: data}, nil
+}
+
+func parseStreamMessage(msg redis.XMessage) (model.MatchUpdate, bool) {
+	data, ok := msg.Values["data"].(string)
+	if !ok {
+		return model.MatchUpdate{}, false
+	}
+
+	seq, err := strconv.ParseInt(strings.SplitN(msg.ID, "-", 2)[0], 10, 64)
+	if err != nil {
+		return model.MatchUpdate{}, false
+	}
+
+	return model.MatchUpdate{Seq: seq, Data: []byte(data)}, true
+}
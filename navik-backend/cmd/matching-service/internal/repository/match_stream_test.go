@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+
+	"navik-backend/pkg/redisclient"
+)
+
+const testStreamTTL = 15 * time.Minute
+
+func TestMatchStreamPublish(t *testing.T) {
+	ctx := context.Background()
+	_, client := newTestRedis(t)
+	stream := NewMatchStreamRepository(client, 100, testStreamTTL)
+
+	subscription := client.Subscribe(ctx, redisclient.UserChannel("u1"))
+	defer subscription.Close()
+	if _, err := subscription.Receive(ctx); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	tests := []struct {
+		payload  string
+		wantSeq  int64
+		wantData string
+	}{
+		{payload: `{"status":"SEARCHING"}`, wantSeq: 1, wantData: `{"seq":1,"status":"SEARCHING"}`},
+		{payload: `{}`, wantSeq: 2, wantData: `{"seq":2}`},
+		{payload: `{"status":"SUCCESS","drivers":[]}`, wantSeq: 3, wantData: `{"seq":3,"status":"SUCCESS","drivers":[]}`},
+	}
+
+	for _, tt := range tests {
+		seq, err := stream.Publish(ctx, "u1", []byte(tt.payload))
+		if err != nil {
+			t.Fatalf("Publish(%s): %v", tt.payload, err)
+		}
+		if seq != tt.wantSeq {
+			t.Errorf("Publish(%s) seq = %d, want %d", tt.payload, seq, tt.wantSeq)
+		}
+
+		msg, err := subscription.ReceiveMessage(ctx)
+		if err != nil {
+			t.Fatalf("receive: %v", err)
+		}
+		if msg.Payload != tt.wantData {
+			t.Errorf("published %s, want %s", msg.Payload, tt.wantData)
+		}
+
+		latest, err := stream.Latest(ctx, "u1")
+		if err != nil {
+			t.Fatalf("Latest: %v", err)
+		}
+		if latest.Seq != tt.wantSeq || string(latest.Data) != tt.wantData {
+			t.Errorf("Latest = %d %s, want %d %s", latest.Seq, latest.Data, tt.wantSeq, tt.wantData)
+		}
+	}
+}
+
+func TestMatchStreamLatestEmpty(t *testing.T) {
+	_, client := newTestRedis(t)
+	stream := NewMatchStreamRepository(client, 100, testStreamTTL)
+
+	latest, err := stream.Latest(context.Background(), "nobody")
+	if err != nil || latest != nil {
+		t.Errorf("Latest = %v, %v, want nil, nil", latest, err)
+	}
+}
+
+func TestMatchStreamSince(t *testing.T) {
+	tests := []struct {
+		name         string
+		published    int
+		after        func(t *testing.T, server *miniredis.Miniredis, client redis.UniversalClient)
+		seq          int64
+		wantSeqs     []int64
+		wantComplete bool
+	}{
+		{name: "from start", published: 3, seq: 0, wantSeqs: []int64{1, 2, 3}, wantComplete: true},
+		{name: "from middle", published: 3, seq: 2, wantSeqs: []int64{3}, wantComplete: true},
+		{name: "up to date", published: 3, seq: 3, wantSeqs: []int64{}, wantComplete: true},
+		{name: "no updates yet", published: 0, seq: 0, wantSeqs: []int64{}, wantComplete: true},
+		{name: "ahead of sequence", published: 3, seq: 5, wantSeqs: nil, wantComplete: false},
+		{
+			name:      "trimmed",
+			published: 3,
+			after: func(t *testing.T, server *miniredis.Miniredis, client redis.UniversalClient) {
+				if err := client.XDel(context.Background(), redisclient.UserKey("u1", "stream"), "1-0").Err(); err != nil {
+					t.Fatalf("trim: %v", err)
+				}
+			},
+			seq:          0,
+			wantSeqs:     []int64{2, 3},
+			wantComplete: false,
+		},
+		{
+			name:      "trimmed before seq",
+			published: 3,
+			after: func(t *testing.T, server *miniredis.Miniredis, client redis.UniversalClient) {
+				if err := client.XDel(context.Background(), redisclient.UserKey("u1", "stream"), "1-0").Err(); err != nil {
+					t.Fatalf("trim: %v", err)
+				}
+			},
+			seq:          1,
+			wantSeqs:     []int64{2, 3},
+			wantComplete: true,
+		},
+		{
+			name:      "expired",
+			published: 3,
+			after: func(t *testing.T, server *miniredis.Miniredis, client redis.UniversalClient) {
+				server.FastForward(testStreamTTL + time.Second)
+			},
+			seq:          1,
+			wantSeqs:     []int64{},
+			wantComplete: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			server, client := newTestRedis(t)
+			stream := NewMatchStreamRepository(client, 100, testStreamTTL)
+
+			for i := 0; i < tt.published; i++ {
+				if _, err := stream.Publish(ctx, "u1", []byte(fmt.Sprintf(`{"n":%d}`, i+1))); err != nil {
+					t.Fatalf("Publish: %v", err)
+				}
+			}
+			if tt.after != nil {
+				tt.after(t, server, client)
+			}
+
+			updates, complete, err := stream.Since(ctx, "u1", tt.seq)
+			if err != nil {
+				t.Fatalf("Since(%d): %v", tt.seq, err)
+			}
+			if complete != tt.wantComplete {
+				t.Errorf("Since(%d) complete = %t, want %t", tt.seq, complete, tt.wantComplete)
+			}
+			if tt.wantSeqs == nil {
+				if updates != nil {
+					t.Errorf("Since(%d) = %d updates, want none", tt.seq, len(updates))
+				}
+				return
+			}
+			if len(updates) != len(tt.wantSeqs) {
+				t.Fatalf("Since(%d) = %d updates, want %d", tt.seq, len(updates), len(tt.wantSeqs))
+			}
+			for i, update := range updates {
+				if update.Seq != tt.wantSeqs[i] {
+					t.Errorf("update %d seq = %d, want %d", i, update.Seq, tt.wantSeqs[i])
+				}
+				var data struct {
+					Seq int64 `json:"seq"`
+					N   int64 `json:"n"`
+				}
+				if err := json.Unmarshal(update.Data, &data); err != nil {
+					t.Fatalf("update %d: %v", i, err)
+				}
+				if data.Seq != update.Seq || data.N != update.Seq {
+					t.Errorf("update %d data = %s, want seq and n %d", i, update.Data, update.Seq)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchStreamSequenceOutlivesStream(t *testing.T) {
+	ctx := context.Background()
+	server, client := newTestRedis(t)
+	stream := NewMatchStreamRepository(client, 100, testStreamTTL)
+
+	if _, err := stream.Publish(ctx, "u1", []byte(`{}`)); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	server.FastForward(testStreamTTL + time.Second)
+
+	seq, err := stream.Publish(ctx, "u1", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if seq != 2 {
+		t.Errorf("seq after stream expired = %d, want 2", seq)
+	}
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"matching-service/internal/model"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrPooledTripNotFound is returned when a pooled trip does not exist
+var ErrPooledTripNotFound = errors.New("pooled trip not found")
+
+// PooledTripRepository stores the active pooled trips of each city
+type PooledTripRepository interface {
+	// Create stores a new trip and assigns its ID
+	Create(ctx context.Context, trip *model.PooledTrip) error
+	Get(ctx context.Context, tripID string) (*model.PooledTrip, error)
+	// ActiveTrips returns the city's trips that still have stops to serve
+	ActiveTrips(ctx context.Context, city string) ([]model.PooledTrip, error)
+	// Update applies a change to a trip, retrying on concurrent modification.
+	// A trip left without stops is removed.
+	Update(ctx context.Context, tripID string, change func(trip *model.PooledTrip) error) (*model.PooledTrip, error)
+}
+
+type redisPooledTripRepository struct {
+	redisClient redis.UniversalClient
+	ttl         time.Duration
+}
+
+// NewPooledTripRepository creates a pooled trip repository backed by Redis
+func NewPooledTripRepository(redisClient redis.UniversalClient, ttl time.Duration) PooledTripRepository {
+	return &redisPooledTripRepository{
+		redisClient: redisClient,
+		ttl:         ttl,
+	}
+}
+
+// Create stores a new trip and adds it to its city's active trips
+func (r *redisPooledTripRepository) Create(ctx context.Context, trip *model.PooledTrip) error {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("failed to generate trip ID: %w", err)
+	}
+	trip.TripID = hex.EncodeToString(buf)
+	trip.UpdatedAt = time.Now().Unix()
+
+	data, err := json.Marshal(trip)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pooled trip: %w", err)
+	}
+
+	pipe := r.redisClient.TxPipeline()
+	pipe.Set(ctx, pooledTripKey(trip.TripID), data, r.ttl)
+	pipe.SAdd(ctx, cityPooledTripsKey(trip.City), trip.TripID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store pooled trip: %w", err)
+	}
+	return nil
+}
+
+// Get returns a trip by ID
+func (r *redisPooledTripRepository) Get(ctx context.Context, tripID string) (*model.PooledTrip, error) {
+	data, err := r.redisClient.Get(ctx, pooledTripKey(tripID)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrPooledTripNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read pooled trip: %w", err)
+	}
+
+	var trip model.PooledTrip
+	if err := json.Unmarshal(data, &trip); err != nil {
+		return nil, fmt.Errorf("failed to parse pooled trip: %w", err)
+	}
+	return &trip, nil
+}
+
+// ActiveTrips returns the city's active trips, pruning expired ones
+func (r *redisPooledTripRepository) ActiveTrips(ctx context.Context, city string) ([]model.PooledTrip, error) {
+	cityKey := cityPooledTripsKey(city)
+	tripIDs, err := r.redisClient.SMembers(ctx, cityKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pooled trips: %w", err)
+	}
+
+	trips := make([]model.PooledTrip, 0, len(tripIDs))
+	for _, tripID := range tripIDs {
+		trip, err := r.Get(ctx, tripID)
+		if errors.Is(err, ErrPooledTripNotFound) {
+			r.redisClient.SRem(ctx, cityKey, tripID)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		trips = append(trips, *trip)
+	}
+	return trips, nil
+}
+
+// Update applies a change to a trip under optimistic locking
+func (r *redisPooledTripRepository) Update(ctx context.Context, tripID string, change func(trip *model.PooledTrip) error) (*model.PooledTrip, error) {
+	key := pooledTripKey(tripID)
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		var updated *model.PooledTrip
+		err := r.redisClient.Watch(ctx, func(tx *redis.Tx) error {
+			data, err := tx.Get(ctx, key).Bytes()
+			if err == redis.Nil {
+				return ErrPooledTripNotFound
+			} else if err != nil {
+				return fmt.Errorf("failed to read pooled trip: %w", err)
+			}
+
+			var trip model.PooledTrip
+			if err := json.Unmarshal(data, &trip); err != nil {
+				return fmt.Errorf("failed to parse pooled trip: %w", err)
+			}
+			if err := change(&trip); err != nil {
+				return err
+			}
+			trip.UpdatedAt = time.Now().Unix()
+
+			data, err = json.Marshal(&trip)
+			if err != nil {
+				return fmt.Errorf("failed to marshal pooled trip: %w", err)
+			}
+
+			// The city's set is in another cluster slot, so a finished trip
+			// leaves it below, or on the next ActiveTrips
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				if len(trip.Stops) == 0 {
+					pipe.Del(ctx, key)
+				} else {
+					pipe.Set(ctx, key, data, r.ttl)
+				}
+				return nil
+			})
+			updated = &trip
+			return err
+		}, key)
+
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(updated.Stops) == 0 {
+			r.redisClient.SRem(ctx, cityPooledTripsKey(updated.City), updated.TripID)
+		}
+		return updated, nil
+	}
+
+	return nil, fmt.Errorf("failed to update pooled trip %s: too many concurrent updates", tripID)
+}
+
+func pooledTripKey(tripID string) string {
+	return fmt.Sprintf("pool_trip:%s", tripID)
+}
+
+func cityPooledTripsKey(city string) string {
+	return fmt.Sprintf("pool_trips:%s", city)
+}
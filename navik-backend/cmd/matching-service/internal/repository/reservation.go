@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// ReservationSoft is held on a driver while an offer is outstanding
+	ReservationSoft = "soft"
+	// ReservationHard is held on a driver once assigned to a rider
+	ReservationHard = "hard"
+)
+
+// ErrOfferNotFound is returned when assigning a driver the holder has no lease
+// on, because the driver was never offered to it or the offer expired
+var ErrOfferNotFound = errors.New("driver was not offered to this request or the offer expired")
+
+// ReservationRepository leases drivers to a holder (the search they are
+// offered to) so that concurrent matchers never offer the same driver twice
+type ReservationRepository interface {
+	// SoftReserve leases a free driver for an outstanding offer, or extends the
+	// lease if the holder already has it. It reports whether the lease is held.
+	SoftReserve(ctx context.Context, driverID, holder string, ttl time.Duration) (bool, error)
+	// HardReserve assigns a driver soft-reserved by the holder, or extends the
+	// holder's assignment. It fails with ErrOfferNotFound otherwise.
+	HardReserve(ctx context.Context, driverID, holder string, ttl time.Duration) error
+	// Release drops the holder's lease on a driver. It reports whether the
+	// holder had one.
+	Release(ctx context.Context, driverID, holder string) (bool, error)
+	// ReleaseAll drops every soft lease of the holder except keepDriverID and
+	// returns the released drivers
+	ReleaseAll(ctx context.Context, holder, keepDriverID string) ([]string, error)
+	// ReservedByOthers returns the drivers leased to anyone other than holder
+	ReservedByOthers(ctx context.Context, driverIDs []string, holder string) (map[string]bool, error)
+}
+
+// The scripts only touch the driver's lease. The holder's set of leases lives
+// in another cluster slot, so it is updated after each script; a lease
+// missing from the set still expires with its TTL.
+
+var softReserveScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if current and current ~= 'soft|' .. ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], 'soft|' .. ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+var hardReserveScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if current ~= 'soft|' .. ARGV[1] and current ~= 'hard|' .. ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], 'hard|' .. ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+var releaseScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if current == 'soft|' .. ARGV[1] or current == 'hard|' .. ARGV[1] then
+	redis.call('DEL', KEYS[1])
+	return 1
+end
+return 0
+`)
+
+type redisReservationRepository struct {
+	redisClient redis.UniversalClient
+}
+
+// NewReservationRepository creates a reservation repository backed by Redis leases
+func NewReservationRepository(redisClient redis.UniversalClient) ReservationRepository {
+	return &redisReservationRepository{
+		redisClient: redisClient,
+	}
+}
+
+// SoftReserve leases a driver for an outstanding offer
+func (r *redisReservationRepository) SoftReserve(ctx context.Context, driverID, holder string, ttl time.Duration) (bool, error) {
+	keys := []string{reservationKey(driverID)}
+	held, err := softReserveScript.Run(ctx, r.redisClient, keys, holder, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve driver %s: %w", driverID, err)
+	}
+	if held == 0 {
+		return false, nil
+	}
+
+	_, err = r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, holderKey(holder), driverID)
+		pipe.PExpire(ctx, holderKey(holder), ttl)
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to record reservation of driver %s: %w", driverID, err)
+	}
+	return true, nil
+}
+
+// HardReserve assigns a driver to the holder
+func (r *redisReservationRepository) HardReserve(ctx context.Context, driverID, holder string, ttl time.Duration) error {
+	keys := []string{reservationKey(driverID)}
+	held, err := hardReserveScript.Run(ctx, r.redisClient, keys, holder, ttl.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("failed to assign driver %s: %w", driverID, err)
+	}
+	if held == 0 {
+		return ErrOfferNotFound
+	}
+
+	// Assignments are not offers, so they are not released with the others
+	if err := r.redisClient.SRem(ctx, holderKey(holder), driverID).Err(); err != nil {
+		return fmt.Errorf("failed to record assignment of driver %s: %w", driverID, err)
+	}
+	return nil
+}
+
+// Release drops the holder's lease on a driver
+func (r *redisReservationRepository) Release(ctx context.Context, driverID, holder string) (bool, error) {
+	keys := []string{reservationKey(driverID)}
+	released, err := releaseScript.Run(ctx, r.redisClient, keys, holder).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to release driver %s: %w", driverID, err)
+	}
+	if err := r.redisClient.SRem(ctx, holderKey(holder), driverID).Err(); err != nil {
+		return false, fmt.Errorf("failed to release driver %s: %w", driverID, err)
+	}
+	return released == 1, nil
+}
+
+// ReleaseAll drops every soft lease of the holder except keepDriverID
+func (r *redisReservationRepository) ReleaseAll(ctx context.Context, holder, keepDriverID string) ([]string, error) {
+	driverIDs, err := r.redisClient.SMembers(ctx, holderKey(holder)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reservations of %s: %w", holder, err)
+	}
+
+	var released []string
+	for _, driverID := range driverIDs {
+		if driverID == keepDriverID {
+			continue
+		}
+		held, err := r.Release(ctx, driverID, holder)
+		if err != nil {
+			return released, err
+		}
+		if held {
+			released = append(released, driverID)
+		}
+	}
+	return released, nil
+}
+
+// ReservedByOthers returns the drivers leased to anyone other than holder
+func (r *redisReservationRepository) ReservedByOthers(ctx context.Context, driverIDs []string, holder string) (map[string]bool, error) {
+	reserved := make(map[string]bool)
+	if len(driverIDs) == 0 {
+		return reserved, nil
+	}
+
+	// The leases live in different hash slots, so they are read with
+	// pipelined GETs rather than one MGET
+	leases := make([]*redis.StringCmd, len(driverIDs))
+	_, err := r.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, driverID := range driverIDs {
+			leases[i] = pipe.Get(ctx, reservationKey(driverID))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to read driver reservations: %w", err)
+	}
+
+	for i, lease := range leases {
+		if lease.Err() != nil {
+			continue
+		}
+		parts := strings.SplitN(lease.Val(), "|", 2)
+		if len(parts) == 2 && parts[1] != holder {
+			reserved[driverIDs[i]] = true
+		}
+	}
+
+	return reserved, nil
+}
+
+func reservationKey(driverID string) string {
+	return fmt.Sprintf("driver:%s:reservation", driverID)
+}
+
+func holderKey(holder string) string {
+	return fmt.Sprintf("reservation:holder:%s", holder)
+}
@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+const testLeaseTTL = 30 * time.Second
+
+// lease sets up a driver's lease before the step under test
+type lease struct {
+	driverID string
+	holder   string
+	hard     bool
+}
+
+// newTestReservations starts a reservation repository with the given leases
+func newTestReservations(t *testing.T, leases []lease) (*miniredis.Miniredis, ReservationRepository) {
+	t.Helper()
+
+	server, client := newTestRedis(t)
+	reservations := NewReservationRepository(client)
+	ctx := context.Background()
+	for _, l := range leases {
+		held, err := reservations.SoftReserve(ctx, l.driverID, l.holder, testLeaseTTL)
+		if err != nil || !held {
+			t.Fatalf("SoftReserve(%s, %s) = %t, %v", l.driverID, l.holder, held, err)
+		}
+		if l.hard {
+			if err := reservations.HardReserve(ctx, l.driverID, l.holder, testLeaseTTL); err != nil {
+				t.Fatalf("HardReserve(%s, %s): %v", l.driverID, l.holder, err)
+			}
+		}
+	}
+	return server, reservations
+}
+
+// leaseOf returns the lease stored on a driver, or "" when it has none
+func leaseOf(server *miniredis.Miniredis, driverID string) string {
+	value, err := server.Get(reservationKey(driverID))
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+func TestSoftReserve(t *testing.T) {
+	tests := []struct {
+		name      string
+		leases    []lease
+		elapsed   time.Duration
+		wantHeld  bool
+		wantLease string
+	}{
+		{name: "free driver", wantHeld: true, wantLease: "soft|s1"},
+		{name: "extends own offer", leases: []lease{{"d1", "s1", false}}, wantHeld: true, wantLease: "soft|s1"},
+		{name: "offered to another", leases: []lease{{"d1", "s2", false}}, wantLease: "soft|s2"},
+		{name: "assigned to another", leases: []lease{{"d1", "s2", true}}, wantLease: "hard|s2"},
+		{name: "assigned to holder", leases: []lease{{"d1", "s1", true}}, wantLease: "hard|s1"},
+		{
+			name:      "offer to another expired",
+			leases:    []lease{{"d1", "s2", false}},
+			elapsed:   testLeaseTTL + time.Second,
+			wantHeld:  true,
+			wantLease: "soft|s1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, reservations := newTestReservations(t, tt.leases)
+			server.FastForward(tt.elapsed)
+
+			held, err := reservations.SoftReserve(context.Background(), "d1", "s1", testLeaseTTL)
+			if err != nil {
+				t.Fatalf("SoftReserve: %v", err)
+			}
+			if held != tt.wantHeld {
+				t.Errorf("SoftReserve held = %t, want %t", held, tt.wantHeld)
+			}
+			if got := leaseOf(server, "d1"); got != tt.wantLease {
+				t.Errorf("lease = %q, want %q", got, tt.wantLease)
+			}
+			if tt.wantHeld {
+				if ttl := server.TTL(reservationKey("d1")); ttl != testLeaseTTL {
+					t.Errorf("lease TTL = %v, want %v", ttl, testLeaseTTL)
+				}
+				if ok, _ := server.SIsMember(holderKey("s1"), "d1"); !ok {
+					t.Errorf("driver missing from the holder's leases")
+				}
+			}
+		})
+	}
+}
+
+func TestHardReserve(t *testing.T) {
+	tests := []struct {
+		name      string
+		leases    []lease
+		elapsed   time.Duration
+		wantErr   error
+		wantLease string
+	}{
+		{name: "offered to holder", leases: []lease{{"d1", "s1", false}}, wantLease: "hard|s1"},
+		{name: "extends own assignment", leases: []lease{{"d1", "s1", true}}, wantLease: "hard|s1"},
+		{name: "never offered", wantErr: ErrOfferNotFound},
+		{name: "offered to another", leases: []lease{{"d1", "s2", false}}, wantErr: ErrOfferNotFound, wantLease: "soft|s2"},
+		{name: "assigned to another", leases: []lease{{"d1", "s2", true}}, wantErr: ErrOfferNotFound, wantLease: "hard|s2"},
+		{
+			name:    "offer expired",
+			leases:  []lease{{"d1", "s1", false}},
+			elapsed: testLeaseTTL + time.Second,
+			wantErr: ErrOfferNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, reservations := newTestReservations(t, tt.leases)
+			server.FastForward(tt.elapsed)
+
+			err := reservations.HardReserve(context.Background(), "d1", "s1", 2*testLeaseTTL)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("HardReserve error = %v, want %v", err, tt.wantErr)
+			}
+			if got := leaseOf(server, "d1"); got != tt.wantLease {
+				t.Errorf("lease = %q, want %q", got, tt.wantLease)
+			}
+			if tt.wantErr == nil {
+				if ttl := server.TTL(reservationKey("d1")); ttl != 2*testLeaseTTL {
+					t.Errorf("lease TTL = %v, want %v", ttl, 2*testLeaseTTL)
+				}
+				if ok, _ := server.SIsMember(holderKey("s1"), "d1"); ok {
+					t.Errorf("assigned driver still listed as an offer")
+				}
+			}
+		})
+	}
+}
+
+func TestRelease(t *testing.T) {
+	tests := []struct {
+		name         string
+		leases       []lease
+		elapsed      time.Duration
+		wantReleased bool
+		wantLease    string
+	}{
+		{name: "own offer", leases: []lease{{"d1", "s1", false}}, wantReleased: true},
+		{name: "own assignment", leases: []lease{{"d1", "s1", true}}, wantReleased: true},
+		{name: "offered to another", leases: []lease{{"d1", "s2", false}}, wantLease: "soft|s2"},
+		{name: "assigned to another", leases: []lease{{"d1", "s2", true}}, wantLease: "hard|s2"},
+		{name: "own offer expired", leases: []lease{{"d1", "s1", false}}, elapsed: testLeaseTTL + time.Second},
+		{name: "free driver"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, reservations := newTestReservations(t, tt.leases)
+			server.FastForward(tt.elapsed)
+
+			released, err := reservations.Release(context.Background(), "d1", "s1")
+			if err != nil {
+				t.Fatalf("Release: %v", err)
+			}
+			if released != tt.wantReleased {
+				t.Errorf("Release released = %t, want %t", released, tt.wantReleased)
+			}
+			if got := leaseOf(server, "d1"); got != tt.wantLease {
+				t.Errorf("lease = %q, want %q", got, tt.wantLease)
+			}
+			if ok, _ := server.SIsMember(holderKey("s1"), "d1"); ok {
+				t.Errorf("released driver still listed as an offer")
+			}
+		})
+	}
+}
+
+func TestReleaseAll(t *testing.T) {
+	tests := []struct {
+		name         string
+		leases       []lease
+		keep         string
+		wantReleased []string
+		wantLeases   map[string]string
+	}{
+		{name: "no offers", wantReleased: []string{}},
+		{
+			name:         "all offers",
+			leases:       []lease{{"d1", "s1", false}, {"d2", "s1", false}},
+			wantReleased: []string{"d1", "d2"},
+			wantLeases:   map[string]string{"d1": "", "d2": ""},
+		},
+		{
+			name:         "keeps one offer",
+			leases:       []lease{{"d1", "s1", false}, {"d2", "s1", false}, {"d3", "s1", false}},
+			keep:         "d2",
+			wantReleased: []string{"d1", "d3"},
+			wantLeases:   map[string]string{"d1": "", "d2": "soft|s1", "d3": ""},
+		},
+		{
+			name:         "keeps assignment",
+			leases:       []lease{{"d1", "s1", false}, {"d2", "s1", true}},
+			wantReleased: []string{"d1"},
+			wantLeases:   map[string]string{"d1": "", "d2": "hard|s1"},
+		},
+		{
+			name:         "keeps other holders",
+			leases:       []lease{{"d1", "s1", false}, {"d2", "s2", false}},
+			wantReleased: []string{"d1"},
+			wantLeases:   map[string]string{"d1": "", "d2": "soft|s2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, reservations := newTestReservations(t, tt.leases)
+
+			released, err := reservations.ReleaseAll(context.Background(), "s1", tt.keep)
+			if err != nil {
+				t.Fatalf("ReleaseAll: %v", err)
+			}
+			sort.Strings(released)
+			if len(released) != len(tt.wantReleased) {
+				t.Fatalf("released = %v, want %v", released, tt.wantReleased)
+			}
+			for i := range released {
+				if released[i] != tt.wantReleased[i] {
+					t.Fatalf("released = %v, want %v", released, tt.wantReleased)
+				}
+			}
+			for driverID, want := range tt.wantLeases {
+				if got := leaseOf(server, driverID); got != want {
+					t.Errorf("lease of %s = %q, want %q", driverID, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReservedByOthers(t *testing.T) {
+	tests := []struct {
+		name      string
+		leases    []lease
+		elapsed   time.Duration
+		driverIDs []string
+		want      []string
+	}{
+		{name: "no drivers", want: []string{}},
+		{name: "free drivers", driverIDs: []string{"d1", "d2"}, want: []string{}},
+		{
+			name:      "own leases",
+			leases:    []lease{{"d1", "s1", false}, {"d2", "s1", true}},
+			driverIDs: []string{"d1", "d2"},
+			want:      []string{},
+		},
+		{
+			name:      "leased to others",
+			leases:    []lease{{"d1", "s1", false}, {"d2", "s2", false}, {"d3", "s3", true}},
+			driverIDs: []string{"d1", "d2", "d3", "d4"},
+			want:      []string{"d2", "d3"},
+		},
+		{
+			name:      "expired leases",
+			leases:    []lease{{"d1", "s2", false}},
+			elapsed:   testLeaseTTL + time.Second,
+			driverIDs: []string{"d1"},
+			want:      []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, reservations := newTestReservations(t, tt.leases)
+			server.FastForward(tt.elapsed)
+
+			reserved, err := reservations.ReservedByOthers(context.Background(), tt.driverIDs, "s1")
+			if err != nil {
+				t.Fatalf("ReservedByOthers: %v", err)
+			}
+			if len(reserved) != len(tt.want) {
+				t.Fatalf("reserved = %v, want %v", reserved, tt.want)
+			}
+			for _, driverID := range tt.want {
+				if !reserved[driverID] {
+					t.Errorf("reserved = %v, want %v", reserved, tt.want)
+				}
+			}
+		})
+	}
+}
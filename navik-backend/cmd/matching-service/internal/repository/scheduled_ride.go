@@ -0,0 +1,259 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"matching-service/internal/model"
+	"navik-backend/pkg/redisclient"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Scheduler queues a scheduled ride moves through
+const (
+	// ScheduleQueuePlan holds rides whose dispatch time is still to be chosen
+	ScheduleQueuePlan = "plan"
+	// ScheduleQueueDispatch holds rides waiting for their dispatch time
+	ScheduleQueueDispatch = "dispatch"
+	// ScheduleQueueRemind holds rides waiting for their reminder
+	ScheduleQueueRemind = "remind"
+)
+
+var (
+	// ErrScheduledRideNotFound is returned when a scheduled ride does not exist
+	ErrScheduledRideNotFound = errors.New("scheduled ride not found")
+	// ErrScheduledRideNotBooked is returned by changes that only apply to a
+	// ride that is still booked, once it was dispatched or cancelled
+	ErrScheduledRideNotBooked = errors.New("scheduled ride is no longer booked")
+)
+
+// ScheduledRideRepository stores scheduled rides and the time-ordered queues
+// the scheduler works through
+type ScheduledRideRepository interface {
+	// Create stores a new ride and assigns its ID
+	Create(ctx context.Context, ride *model.ScheduledRide) error
+	Get(ctx context.Context, rideID string) (*model.ScheduledRide, error)
+	// Update applies a change to a ride. The change sees the current ride and
+	// is applied only if the ride was not modified meanwhile, so a change that
+	// checks the status never overwrites a concurrent one.
+	Update(ctx context.Context, rideID string, change func(ride *model.ScheduledRide) error) (*model.ScheduledRide, error)
+	// ListForUser returns the user's rides ordered by pickup time
+	ListForUser(ctx context.Context, userID string) ([]model.ScheduledRide, error)
+	// Schedule queues a ride for the given time, replacing an earlier entry
+	Schedule(ctx context.Context, queue, rideID string, at time.Time) error
+	// Unschedule removes a ride from every queue
+	Unschedule(ctx context.Context, rideID string) error
+	// ClaimDue returns up to limit rides due by now and leases them for lease:
+	// they stay queued, due again once the lease ends, until Complete. A ride
+	// is claimed by one caller at a time, so several schedulers may run at
+	// once, and a ride whose handling failed or crashed is not lost.
+	ClaimDue(ctx context.Context, queue string, now time.Time, limit int, lease time.Duration) ([]string, error)
+	// Complete removes a claimed ride from the queue once it was handled
+	Complete(ctx context.Context, queue, rideID string) error
+}
+
+var claimDueScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call('ZADD', KEYS[1], ARGV[3], id)
+end
+return ids
+`)
+
+type redisScheduledRideRepository struct {
+	redisClient redis.UniversalClient
+	// retention is how long a ride is kept after its pickup time
+	retention time.Duration
+}
+
+// NewScheduledRideRepository creates a scheduled ride repository backed by Redis
+func NewScheduledRideRepository(redisClient redis.UniversalClient, retention time.Duration) ScheduledRideRepository {
+	return &redisScheduledRideRepository{
+		redisClient: redisClient,
+		retention:   retention,
+	}
+}
+
+// Create stores a new ride and indexes it under its user
+func (r *redisScheduledRideRepository) Create(ctx context.Context, ride *model.ScheduledRide) error {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("failed to generate ride ID: %w", err)
+	}
+	ride.RideID = hex.EncodeToString(buf)
+
+	if err := r.save(ctx, ride); err != nil {
+		return err
+	}
+
+	userKey := userScheduledRidesKey(ride.UserID)
+	if err := r.redisClient.ZAdd(ctx, userKey, &redis.Z{Score: float64(ride.PickupAt), Member: ride.RideID}).Err(); err != nil {
+		return fmt.Errorf("failed to index scheduled ride: %w", err)
+	}
+	return nil
+}
+
+// Get returns a ride by ID
+func (r *redisScheduledRideRepository) Get(ctx context.Context, rideID string) (*model.ScheduledRide, error) {
+	data, err := r.redisClient.Get(ctx, scheduledRideKey(rideID)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrScheduledRideNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read scheduled ride: %w", err)
+	}
+
+	var ride model.ScheduledRide
+	if err := json.Unmarshal(data, &ride); err != nil {
+		return nil, fmt.Errorf("failed to parse scheduled ride: %w", err)
+	}
+	return &ride, nil
+}
+
+// Update applies a change to a ride under optimistic locking
+func (r *redisScheduledRideRepository) Update(ctx context.Context, rideID string, change func(ride *model.ScheduledRide) error) (*model.ScheduledRide, error) {
+	key := scheduledRideKey(rideID)
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		var updated *model.ScheduledRide
+		err := r.redisClient.Watch(ctx, func(tx *redis.Tx) error {
+			data, err := tx.Get(ctx, key).Bytes()
+			if err == redis.Nil {
+				return ErrScheduledRideNotFound
+			} else if err != nil {
+				return fmt.Errorf("failed to read scheduled ride: %w", err)
+			}
+
+			var ride model.ScheduledRide
+			if err := json.Unmarshal(data, &ride); err != nil {
+				return fmt.Errorf("failed to parse scheduled ride: %w", err)
+			}
+			if err := change(&ride); err != nil {
+				return err
+			}
+
+			data, err = json.Marshal(&ride)
+			if err != nil {
+				return fmt.Errorf("failed to marshal scheduled ride: %w", err)
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, data, r.ttl(&ride))
+				return nil
+			})
+			updated = &ride
+			return err
+		}, key)
+
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return updated, nil
+	}
+
+	return nil, fmt.Errorf("failed to update scheduled ride %s: too many concurrent updates", rideID)
+}
+
+// save stores a ride until the retention period after its pickup time
+func (r *redisScheduledRideRepository) save(ctx context.Context, ride *model.ScheduledRide) error {
+	data, err := json.Marshal(ride)
+	if err != nil {
+		return fmt.Errorf("failed to marshal scheduled ride: %w", err)
+	}
+
+	if err := r.redisClient.Set(ctx, scheduledRideKey(ride.RideID), data, r.ttl(ride)).Err(); err != nil {
+		return fmt.Errorf("failed to store scheduled ride: %w", err)
+	}
+	return nil
+}
+
+// ttl keeps a ride until the retention period after its pickup time
+func (r *redisScheduledRideRepository) ttl(ride *model.ScheduledRide) time.Duration {
+	return time.Until(time.Unix(ride.PickupAt, 0)) + r.retention
+}
+
+// ListForUser returns the user's rides that have not expired
+func (r *redisScheduledRideRepository) ListForUser(ctx context.Context, userID string) ([]model.ScheduledRide, error) {
+	userKey := userScheduledRidesKey(userID)
+
+	// Drop index entries of rides past their retention
+	cutoff := strconv.FormatInt(time.Now().Add(-r.retention).Unix(), 10)
+	if err := r.redisClient.ZRemRangeByScore(ctx, userKey, "-inf", "("+cutoff).Err(); err != nil {
+		return nil, fmt.Errorf("failed to prune scheduled rides: %w", err)
+	}
+
+	rideIDs, err := r.redisClient.ZRange(ctx, userKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled rides: %w", err)
+	}
+
+	rides := make([]model.ScheduledRide, 0, len(rideIDs))
+	for _, rideID := range rideIDs {
+		ride, err := r.Get(ctx, rideID)
+		if errors.Is(err, ErrScheduledRideNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		rides = append(rides, *ride)
+	}
+	return rides, nil
+}
+
+// Schedule queues a ride for the given time
+func (r *redisScheduledRideRepository) Schedule(ctx context.Context, queue, rideID string, at time.Time) error {
+	if err := r.redisClient.ZAdd(ctx, scheduleQueueKey(queue), &redis.Z{Score: float64(at.Unix()), Member: rideID}).Err(); err != nil {
+		return fmt.Errorf("failed to schedule ride %s: %w", rideID, err)
+	}
+	return nil
+}
+
+// Unschedule removes a ride from every queue
+func (r *redisScheduledRideRepository) Unschedule(ctx context.Context, rideID string) error {
+	pipe := r.redisClient.TxPipeline()
+	for _, queue := range []string{ScheduleQueuePlan, ScheduleQueueDispatch, ScheduleQueueRemind} {
+		pipe.ZRem(ctx, scheduleQueueKey(queue), rideID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to unschedule ride %s: %w", rideID, err)
+	}
+	return nil
+}
+
+// ClaimDue returns the rides due in a queue and pushes them back by the lease
+func (r *redisScheduledRideRepository) ClaimDue(ctx context.Context, queue string, now time.Time, limit int, lease time.Duration) ([]string, error) {
+	rideIDs, err := claimDueScript.Run(ctx, r.redisClient, []string{scheduleQueueKey(queue)}, now.Unix(), limit, now.Add(lease).Unix()).StringSlice()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to claim due rides: %w", err)
+	}
+	return rideIDs, nil
+}
+
+// Complete removes a handled ride from a queue
+func (r *redisScheduledRideRepository) Complete(ctx context.Context, queue, rideID string) error {
+	if err := r.redisClient.ZRem(ctx, scheduleQueueKey(queue), rideID).Err(); err != nil {
+		return fmt.Errorf("failed to complete ride %s in %s queue: %w", rideID, queue, err)
+	}
+	return nil
+}
+
+func scheduledRideKey(rideID string) string {
+	return fmt.Sprintf("scheduled_ride:%s", rideID)
+}
+
+func userScheduledRidesKey(userID string) string {
+	return redisclient.UserKey(userID, "scheduled_rides")
+}
+
+func scheduleQueueKey(queue string) string {
+	return fmt.Sprintf("scheduled_rides:%s", queue)
+}
@@ -0,0 +1,336 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"matching-service/internal/model"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// ErrSearchNotFound is returned when a search does not exist or has expired
+	ErrSearchNotFound = errors.New("search not found")
+	// ErrSearchCancelled is returned when updating a search the rider cancelled
+	ErrSearchCancelled = errors.New("search was cancelled")
+	// ErrSearchMatched is returned when reopening a search that found a driver
+	ErrSearchMatched = errors.New("search was matched")
+	// ErrSearchPending is returned when an idempotency key is taken by a
+	// search that is not stored, e.g. one being deleted after a failed start
+	ErrSearchPending = errors.New("search for idempotency key is not available")
+	// ErrSearchNotAssigned is returned when rating the driver of a search no
+	// driver accepted
+	ErrSearchNotAssigned = errors.New("search has no assigned driver")
+	// ErrSearchRated is returned when rating the driver of a search again
+	ErrSearchRated = errors.New("driver of search was already rated")
+	// ErrSearchAssigned is returned when assigning a search another driver
+	// already accepted
+	ErrSearchAssigned = errors.New("search was assigned to another driver")
+)
+
+// SearchRepository stores ride searches so that clients can poll their status
+type SearchRepository interface {
+	// Create stores a new search for the user. If idempotencyKey was already
+	// used by the user, the existing search is returned with created false.
+	Create(ctx context.Context, userID, city, idempotencyKey string) (search *model.Search, created bool, err error)
+	// Get returns a search by ID
+	Get(ctx context.Context, searchID string) (*model.Search, error)
+	// Complete records the result of a search. It fails with
+	// ErrSearchCancelled if the search was cancelled.
+	Complete(ctx context.Context, searchID, status string, candidates []model.DriverInfo) error
+	// Cancel marks a search as cancelled. It fails with ErrSearchCancelled if
+	// the search was already cancelled.
+	Cancel(ctx context.Context, searchID, reason string) (*model.Search, error)
+	// Reopen puts a search back to searching, e.g. after the rider moved their
+	// pickup. It fails with ErrSearchCancelled or ErrSearchMatched if the
+	// search was cancelled or found a driver.
+	Reopen(ctx context.Context, searchID string) (*model.Search, error)
+	// Assign records the driver who accepted the search's offer. It fails with
+	// ErrSearchCancelled if the search was cancelled, or ErrSearchAssigned if
+	// another driver accepted first.
+	Assign(ctx context.Context, searchID, driverID string) error
+	// Rate records the rider's rating of the search's driver. It fails with
+	// ErrSearchNotAssigned if no driver accepted, or ErrSearchRated if the
+	// driver was already rated.
+	Rate(ctx context.Context, searchID string, stars int) (*model.Search, error)
+	// Unrate clears the rating of the search's driver, so that a rating that
+	// could not be recorded can be retried
+	Unrate(ctx context.Context, searchID string) error
+	// Delete removes a search and its idempotency key, so that a request that
+	// could not be dispatched can be retried with the same key
+	Delete(ctx context.Context, search *model.Search, idempotencyKey string) error
+}
+
+// maxUpdateAttempts bounds the optimistic retries of a read-modify-write
+const maxUpdateAttempts = 5
+
+type redisSearchRepository struct {
+	redisClient redis.UniversalClient
+	ttl         time.Duration
+}
+
+// NewSearchRepository creates a search repository backed by Redis
+func NewSearchRepository(redisClient redis.UniversalClient, ttl time.Duration) SearchRepository {
+	return &redisSearchRepository{
+		redisClient: redisClient,
+		ttl:         ttl,
+	}
+}
+
+// Create stores a new search, honouring the user's idempotency key
+func (r *redisSearchRepository) Create(ctx context.Context, userID, city, idempotencyKey string) (*model.Search, bool, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, false, fmt.Errorf("failed to generate search ID: %w", err)
+	}
+	searchID := hex.EncodeToString(buf)
+
+	now := time.Now().Unix()
+	search := &model.Search{
+		SearchID:   searchID,
+		UserID:     userID,
+		City:       city,
+		Status:     model.SearchStatusSearching,
+		Candidates: []model.DriverInfo{},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	// The search is stored before the idempotency key is claimed, so that a
+	// concurrent retry that finds the key also finds the search
+	if err := r.save(ctx, search); err != nil {
+		return nil, false, err
+	}
+
+	if idempotencyKey != "" {
+		key := idempotencyKeyKey(userID, idempotencyKey)
+		claimed, err := r.redisClient.SetNX(ctx, key, searchID, r.ttl).Result()
+		if err != nil {
+			r.redisClient.Del(ctx, searchKey(searchID))
+			return nil, false, fmt.Errorf("failed to claim idempotency key: %w", err)
+		}
+		if !claimed {
+			r.redisClient.Del(ctx, searchKey(searchID))
+
+			existingID, err := r.redisClient.Get(ctx, key).Result()
+			if err == redis.Nil {
+				return nil, false, ErrSearchPending
+			} else if err != nil {
+				return nil, false, fmt.Errorf("failed to read idempotency key: %w", err)
+			}
+			existing, err := r.Get(ctx, existingID)
+			if errors.Is(err, ErrSearchNotFound) {
+				return nil, false, ErrSearchPending
+			} else if err != nil {
+				return nil, false, err
+			}
+			return existing, false, nil
+		}
+	}
+
+	return search, true, nil
+}
+
+// Get returns a search by ID
+func (r *redisSearchRepository) Get(ctx context.Context, searchID string) (*model.Search, error) {
+	data, err := r.redisClient.Get(ctx, searchKey(searchID)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrSearchNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read search: %w", err)
+	}
+
+	var search model.Search
+	if err := json.Unmarshal(data, &search); err != nil {
+		return nil, fmt.Errorf("failed to parse search: %w", err)
+	}
+
+	return &search, nil
+}
+
+// Complete records the result of a search
+func (r *redisSearchRepository) Complete(ctx context.Context, searchID, status string, candidates []model.DriverInfo) error {
+	if candidates == nil {
+		candidates = []model.DriverInfo{}
+	}
+
+	_, err := r.update(ctx, searchID, func(search *model.Search) error {
+		if search.Status == model.SearchStatusCancelled {
+			return ErrSearchCancelled
+		}
+
+		now := time.Now().Unix()
+		search.Status = status
+		search.Candidates = candidates
+		search.UpdatedAt = now
+		search.CompletedAt = now
+		return nil
+	})
+	return err
+}
+
+// Cancel marks a search as cancelled with the rider's reason
+func (r *redisSearchRepository) Cancel(ctx context.Context, searchID, reason string) (*model.Search, error) {
+	return r.update(ctx, searchID, func(search *model.Search) error {
+		if search.Status == model.SearchStatusCancelled {
+			return ErrSearchCancelled
+		}
+
+		now := time.Now().Unix()
+		search.Status = model.SearchStatusCancelled
+		search.CancelReason = reason
+		search.UpdatedAt = now
+		search.CancelledAt = now
+		return nil
+	})
+}
+
+// Reopen puts a search that has not found a driver back to searching
+func (r *redisSearchRepository) Reopen(ctx context.Context, searchID string) (*model.Search, error) {
+	return r.update(ctx, searchID, func(search *model.Search) error {
+		switch search.Status {
+		case model.SearchStatusCancelled:
+			return ErrSearchCancelled
+		case model.SearchStatusMatched:
+			return ErrSearchMatched
+		}
+
+		search.Status = model.SearchStatusSearching
+		search.Candidates = []model.DriverInfo{}
+		search.UpdatedAt = time.Now().Unix()
+		search.CompletedAt = 0
+		return nil
+	})
+}
+
+// Assign records the search's driver, unless another driver has it
+func (r *redisSearchRepository) Assign(ctx context.Context, searchID, driverID string) error {
+	_, err := r.update(ctx, searchID, func(search *model.Search) error {
+		if search.Status == model.SearchStatusCancelled {
+			return ErrSearchCancelled
+		}
+		if search.DriverID != "" && search.DriverID != driverID {
+			return ErrSearchAssigned
+		}
+
+		search.DriverID = driverID
+		search.UpdatedAt = time.Now().Unix()
+		return nil
+	})
+	return err
+}
+
+// Rate records the rating of the search's driver, once
+func (r *redisSearchRepository) Rate(ctx context.Context, searchID string, stars int) (*model.Search, error) {
+	return r.update(ctx, searchID, func(search *model.Search) error {
+		if search.DriverID == "" {
+			return ErrSearchNotAssigned
+		}
+		if search.DriverRating != 0 {
+			return ErrSearchRated
+		}
+
+		search.DriverRating = stars
+		search.UpdatedAt = time.Now().Unix()
+		return nil
+	})
+}
+
+// Unrate clears the rating of the search's driver
+func (r *redisSearchRepository) Unrate(ctx context.Context, searchID string) error {
+	_, err := r.update(ctx, searchID, func(search *model.Search) error {
+		search.DriverRating = 0
+		search.UpdatedAt = time.Now().Unix()
+		return nil
+	})
+	return err
+}
+
+// update applies a change to a search, retrying if the search is modified
+// concurrently so that a cancellation is never overwritten by a result
+func (r *redisSearchRepository) update(ctx context.Context, searchID string, change func(search *model.Search) error) (*model.Search, error) {
+	key := searchKey(searchID)
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		var updated *model.Search
+		err := r.redisClient.Watch(ctx, func(tx *redis.Tx) error {
+			data, err := tx.Get(ctx, key).Bytes()
+			if err == redis.Nil {
+				return ErrSearchNotFound
+			} else if err != nil {
+				return fmt.Errorf("failed to read search: %w", err)
+			}
+
+			var search model.Search
+			if err := json.Unmarshal(data, &search); err != nil {
+				return fmt.Errorf("failed to parse search: %w", err)
+			}
+			if err := change(&search); err != nil {
+				return err
+			}
+
+			data, err = json.Marshal(&search)
+			if err != nil {
+				return fmt.Errorf("failed to marshal search: %w", err)
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, data, redis.KeepTTL)
+				return nil
+			})
+			updated = &search
+			return err
+		}, key)
+
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return updated, nil
+	}
+
+	return nil, fmt.Errorf("failed to update search %s: too many concurrent updates", searchID)
+}
+
+// Delete removes a search and its idempotency key
+func (r *redisSearchRepository) Delete(ctx context.Context, search *model.Search, idempotencyKey string) error {
+	// The keys are in different cluster slots, so they are deleted one at a time
+	_, err := r.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, searchKey(search.SearchID))
+		if idempotencyKey != "" {
+			pipe.Del(ctx, idempotencyKeyKey(search.UserID, idempotencyKey))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete search: %w", err)
+	}
+	return nil
+}
+
+func (r *redisSearchRepository) save(ctx context.Context, search *model.Search) error {
+	data, err := json.Marshal(search)
+	if err != nil {
+		return fmt.Errorf("failed to marshal search: %w", err)
+	}
+
+	if err := r.redisClient.Set(ctx, searchKey(search.SearchID), data, r.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store search: %w", err)
+	}
+	return nil
+}
+
+func searchKey(searchID string) string {
+	return fmt.Sprintf("search:%s", searchID)
+}
+
+func idempotencyKeyKey(userID, idempotencyKey string) string {
+	return fmt.Sprintf("search:idempotency:%s:%s", userID, idempotencyKey)
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSearchAssign(t *testing.T) {
+	tests := []struct {
+		name       string
+		assigned   string
+		cancelled  bool
+		driverID   string
+		wantErr    error
+		wantDriver string
+	}{
+		{name: "unassigned", driverID: "d1", wantDriver: "d1"},
+		{name: "same driver again", assigned: "d1", driverID: "d1", wantDriver: "d1"},
+		{name: "another driver first", assigned: "d2", driverID: "d1", wantErr: ErrSearchAssigned, wantDriver: "d2"},
+		{name: "cancelled", cancelled: true, driverID: "d1", wantErr: ErrSearchCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			_, client := newTestRedis(t)
+			searches := NewSearchRepository(client, time.Hour)
+
+			search, _, err := searches.Create(ctx, "u1", "pune", "")
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if tt.assigned != "" {
+				if err := searches.Assign(ctx, search.SearchID, tt.assigned); err != nil {
+					t.Fatalf("Assign(%s): %v", tt.assigned, err)
+				}
+			}
+			if tt.cancelled {
+				if _, err := searches.Cancel(ctx, search.SearchID, "rider"); err != nil {
+					t.Fatalf("Cancel: %v", err)
+				}
+			}
+
+			err = searches.Assign(ctx, search.SearchID, tt.driverID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Assign error = %v, want %v", err, tt.wantErr)
+			}
+			stored, err := searches.Get(ctx, search.SearchID)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if stored.DriverID != tt.wantDriver {
+				t.Errorf("driver = %q, want %q", stored.DriverID, tt.wantDriver)
+			}
+		})
+	}
+}
+
+func TestSearchRate(t *testing.T) {
+	tests := []struct {
+		name       string
+		assigned   bool
+		rated      bool
+		unrated    bool
+		wantErr    error
+		wantRating int
+	}{
+		{name: "unassigned", wantErr: ErrSearchNotAssigned},
+		{name: "assigned", assigned: true, wantRating: 4},
+		{name: "already rated", assigned: true, rated: true, wantErr: ErrSearchRated, wantRating: 5},
+		{name: "rating cleared", assigned: true, rated: true, unrated: true, wantRating: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			_, client := newTestRedis(t)
+			searches := NewSearchRepository(client, time.Hour)
+
+			search, _, err := searches.Create(ctx, "u1", "pune", "")
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if tt.assigned {
+				if err := searches.Assign(ctx, search.SearchID, "d1"); err != nil {
+					t.Fatalf("Assign: %v", err)
+				}
+			}
+			if tt.rated {
+				if _, err := searches.Rate(ctx, search.SearchID, 5); err != nil {
+					t.Fatalf("Rate: %v", err)
+				}
+			}
+			if tt.unrated {
+				if err := searches.Unrate(ctx, search.SearchID); err != nil {
+					t.Fatalf("Unrate: %v", err)
+				}
+			}
+
+			if _, err := searches.Rate(ctx, search.SearchID, 4); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Rate error = %v, want %v", err, tt.wantErr)
+			}
+			stored, err := searches.Get(ctx, search.SearchID)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if stored.DriverRating != tt.wantRating {
+				t.Errorf("rating = %d, want %d", stored.DriverRating, tt.wantRating)
+			}
+		})
+	}
+}
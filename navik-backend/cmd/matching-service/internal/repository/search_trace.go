@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"matching-service/internal/model"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrTraceNotFound is returned when a search has no trace or it has expired
+var ErrTraceNotFound = errors.New("search trace not found")
+
+// maxTraceAttempts bounds the attempts kept per trace, since a background
+// re-search adds one attempt per round
+const maxTraceAttempts = 20
+
+// SearchTraceRepository stores the matching decisions made for each search
+type SearchTraceRepository interface {
+	// Update applies a change to a search's trace, creating it if needed
+	Update(ctx context.Context, searchID string, change func(trace *model.SearchTrace)) error
+	// Get returns the trace of a search
+	Get(ctx context.Context, searchID string) (*model.SearchTrace, error)
+}
+
+type redisSearchTraceRepository struct {
+	redisClient redis.UniversalClient
+	ttl         time.Duration
+}
+
+// NewSearchTraceRepository creates a search trace repository backed by Redis.
+// Traces expire with the searches they belong to.
+func NewSearchTraceRepository(redisClient redis.UniversalClient, ttl time.Duration) SearchTraceRepository {
+	return &redisSearchTraceRepository{
+		redisClient: redisClient,
+		ttl:         ttl,
+	}
+}
+
+// Update applies a change to a trace, retrying on concurrent modification
+func (r *redisSearchTraceRepository) Update(ctx context.Context, searchID string, change func(trace *model.SearchTrace)) error {
+	key := searchTraceKey(searchID)
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		err := r.redisClient.Watch(ctx, func(tx *redis.Tx) error {
+			trace := model.SearchTrace{SearchID: searchID}
+			data, err := tx.Get(ctx, key).Bytes()
+			if err != nil && err != redis.Nil {
+				return fmt.Errorf("failed to read search trace: %w", err)
+			}
+			if err == nil {
+				if err := json.Unmarshal(data, &trace); err != nil {
+					return fmt.Errorf("failed to parse search trace: %w", err)
+				}
+			}
+
+			change(&trace)
+			if len(trace.Attempts) > maxTraceAttempts {
+				trace.Attempts = trace.Attempts[len(trace.Attempts)-maxTraceAttempts:]
+			}
+			trace.UpdatedAt = time.Now().Unix()
+
+			data, err = json.Marshal(&trace)
+			if err != nil {
+				return fmt.Errorf("failed to marshal search trace: %w", err)
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, data, r.ttl)
+				return nil
+			})
+			return err
+		}, key)
+
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return err
+	}
+
+	return fmt.Errorf("failed to update trace of search %s: too many concurrent updates", searchID)
+}
+
+// Get returns the trace of a search
+func (r *redisSearchTraceRepository) Get(ctx context.Context, searchID string) (*model.SearchTrace, error) {
+	data, err := r.redisClient.Get(ctx, searchTraceKey(searchID)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrTraceNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read search trace: %w", err)
+	}
+
+	var trace model.SearchTrace
+	if err := json.Unmarshal(data, &trace); err != nil {
+		return nil, fmt.Errorf("failed to parse search trace: %w", err)
+	}
+
+	return &trace, nil
+}
+
+func searchTraceKey(searchID string) string {
+	return fmt.Sprintf("search:%s:trace", searchID)
+}
@@ -0,0 +1,107 @@
+package service
+
+import "math"
+
+// infeasibleCost marks a rider/driver pair that must not be assigned
+const infeasibleCost = 1e9
+
+// solveAssignment finds the rider-to-driver assignment with minimum total cost
+// using the Hungarian algorithm. cost[i][j] is the cost of giving driver j to
+// rider i. It returns, for each rider, the index of the assigned driver or -1
+// when the rider gets no feasible driver.
+func solveAssignment(cost [][]float64) []int {
+	riders := len(cost)
+	if riders == 0 {
+		return nil
+	}
+	drivers := len(cost[0])
+
+	// The algorithm needs at least as many columns as rows, so pad with dummy
+	// drivers that every rider can take at an infeasible cost
+	cols := drivers
+	if cols < riders {
+		cols = riders
+	}
+
+	at := func(i, j int) float64 {
+		if j >= drivers {
+			return infeasibleCost
+		}
+		return cost[i][j]
+	}
+
+	// Potentials and matching are 1-indexed, with row/column 0 as a sentinel
+	u := make([]float64, riders+1)
+	v := make([]float64, cols+1)
+	match := make([]int, cols+1) // match[j] is the row assigned to column j
+	way := make([]int, cols+1)
+
+	for i := 1; i <= riders; i++ {
+		match[0] = i
+		j0 := 0
+		minv := make([]float64, cols+1)
+		used := make([]bool, cols+1)
+		for j := range minv {
+			minv[j] = math.Inf(1)
+		}
+
+		for {
+			used[j0] = true
+			i0 := match[j0]
+			delta := math.Inf(1)
+			j1 := 0
+
+			for j := 1; j <= cols; j++ {
+				if used[j] {
+					continue
+				}
+				cur := at(i0-1, j-1) - u[i0] - v[j]
+				if cur < minv[j] {
+					minv[j] = cur
+					way[j] = j0
+				}
+				if minv[j] < delta {
+					delta = minv[j]
+					j1 = j
+				}
+			}
+
+			for j := 0; j <= cols; j++ {
+				if used[j] {
+					u[match[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+
+			j0 = j1
+			if match[j0] == 0 {
+				break
+			}
+		}
+
+		for {
+			j1 := way[j0]
+			match[j0] = match[j1]
+			j0 = j1
+			if j0 == 0 {
+				break
+			}
+		}
+	}
+
+	assignment := make([]int, riders)
+	for i := range assignment {
+		assignment[i] = -1
+	}
+	for j := 1; j <= cols; j++ {
+		i := match[j] - 1
+		if i < 0 || j > drivers || at(i, j-1) >= infeasibleCost {
+			continue
+		}
+		assignment[i] = j - 1
+	}
+
+	return assignment
+}
@@ -0,0 +1,130 @@
+package service
+
+import "testing"
+
+func TestSolveAssignment(t *testing.T) {
+	const x = infeasibleCost
+
+	tests := []struct {
+		name string
+		cost [][]float64
+		want []int
+	}{
+		{name: "no riders", cost: nil, want: nil},
+		{name: "single pair", cost: [][]float64{{4}}, want: []int{0}},
+		{
+			name: "cheapest overall beats greedy",
+			cost: [][]float64{
+				{1, 2},
+				{1, 10},
+			},
+			want: []int{1, 0},
+		},
+		{
+			name: "square",
+			cost: [][]float64{
+				{9, 2, 7},
+				{6, 4, 3},
+				{5, 8, 1},
+			},
+			want: []int{1, 0, 2},
+		},
+		{
+			name: "more drivers than riders",
+			cost: [][]float64{
+				{5, 1, 9, 4},
+				{2, 3, 9, 8},
+			},
+			want: []int{1, 0},
+		},
+		{
+			name: "more riders than drivers",
+			cost: [][]float64{
+				{3},
+				{1},
+				{2},
+			},
+			want: []int{-1, 0, -1},
+		},
+		{
+			name: "infeasible pair left unassigned",
+			cost: [][]float64{
+				{x, x},
+				{1, 2},
+			},
+			want: []int{-1, 0},
+		},
+		{
+			name: "infeasible pair avoided",
+			cost: [][]float64{
+				{1, x},
+				{2, 3},
+			},
+			want: []int{0, 1},
+		},
+		{
+			name: "no drivers",
+			cost: [][]float64{{}, {}},
+			want: []int{-1, -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := solveAssignment(tt.cost)
+			if len(got) != len(tt.want) {
+				t.Fatalf("solveAssignment = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("solveAssignment = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSolveAssignmentMinimisesTotalCost(t *testing.T) {
+	cost := [][]float64{
+		{7, 53, 183, 439},
+		{497, 383, 563, 79},
+		{627, 343, 773, 959},
+		{447, 283, 463, 29},
+	}
+	// Brute force over every permutation
+	best := infeasibleCost
+	perm := []int{0, 1, 2, 3}
+	var permute func(k int)
+	permute = func(k int) {
+		if k == len(perm) {
+			total := 0.0
+			for i, j := range perm {
+				total += cost[i][j]
+			}
+			if total < best {
+				best = total
+			}
+			return
+		}
+		for i := k; i < len(perm); i++ {
+			perm[k], perm[i] = perm[i], perm[k]
+			permute(k + 1)
+			perm[k], perm[i] = perm[i], perm[k]
+		}
+	}
+	permute(0)
+
+	assignment := solveAssignment(cost)
+	total := 0.0
+	seen := make(map[int]bool)
+	for i, j := range assignment {
+		if j < 0 || seen[j] {
+			t.Fatalf("assignment %v is not a permutation", assignment)
+		}
+		seen[j] = true
+		total += cost[i][j]
+	}
+	if total != best {
+		t.Errorf("total cost = %v, want %v", total, best)
+	}
+}
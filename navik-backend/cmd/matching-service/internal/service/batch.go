@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"matching-service/internal/model"
+	"matching-service/internal/util"
+)
+
+const (
+	// MatchingModeGreedy matches every request on its own as it arrives
+	MatchingModeGreedy = "greedy"
+	// MatchingModeBatched collects requests per city and assigns them together
+	MatchingModeBatched = "batched"
+)
+
+// batchRequest is a rider waiting for the next batch of its city. done is
+// called once the batch has delivered the rider's result.
+type batchRequest struct {
+	user model.EnrichedUserLocation
+	done func()
+}
+
+// cityBatcher collects the requests of one city over a short window
+type cityBatcher struct {
+	service   *matchingService
+	city      string
+	window    time.Duration
+	mu        sync.Mutex
+	pending   []*batchRequest
+	scheduled bool
+}
+
+// submitToBatch queues a request for its city's next batch and returns
+// without waiting for it, so the consumer worker moves on to the next message
+// rather than sitting out the batch window. The batch reports its own errors
+// and calls done once the rider's result is delivered.
+func (s *matchingService) submitToBatch(user model.EnrichedUserLocation, done func()) {
+	s.batchersMu.Lock()
+	batcher, ok := s.batchers[user.City]
+	if !ok {
+		batcher = &cityBatcher{service: s, city: user.City, window: s.batchWindow}
+		s.batchers[user.City] = batcher
+	}
+	s.batchersMu.Unlock()
+
+	batcher.add(&batchRequest{user: user, done: done})
+}
+
+func (b *cityBatcher) add(req *batchRequest) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pending = append(b.pending, req)
+	if !b.scheduled {
+		b.scheduled = true
+		time.AfterFunc(b.window, b.flush)
+	}
+}
+
+func (b *cityBatcher) flush() {
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = nil
+	b.scheduled = false
+	b.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	startTime := time.Now()
+	b.service.matchBatch(context.Background(), batch)
+	log.Printf("Matched batch of %d requests for city %s in %v", len(batch), b.city, time.Since(startTime))
+}
+
+// matchBatch finds candidates for every rider in the batch, then solves a
+// rider x driver assignment on pickup ETA so that no driver is offered to two
+// riders of the same batch
+func (s *matchingService) matchBatch(ctx context.Context, batch []*batchRequest) {
+	candidates := make([][]model.DriverLocation, len(batch))
+	errs := make([]error, len(batch))
+
+	var wg sync.WaitGroup
+	for i, req := range batch {
+		wg.Add(1)
+		go func(i int, user model.EnrichedUserLocation) {
+			defer wg.Done()
+			drivers, err := s.findDriversForUser(ctx, user)
+			if err != nil {
+				errs[i] = fmt.Errorf("error finding drivers: %w", err)
+				return
+			}
+			candidates[i] = drivers
+		}(i, req.user)
+	}
+	wg.Wait()
+
+	// Every distinct candidate driver becomes a column of the cost matrix
+	driverIndex := make(map[string]int)
+	for _, drivers := range candidates {
+		for _, driver := range drivers {
+			if _, ok := driverIndex[driver.DriverID]; !ok {
+				driverIndex[driver.DriverID] = len(driverIndex)
+			}
+		}
+	}
+
+	cost := make([][]float64, len(batch))
+	for i := range batch {
+		cost[i] = make([]float64, len(driverIndex))
+		for j := range cost[i] {
+			cost[i][j] = infeasibleCost
+		}
+		for _, driver := range candidates[i] {
+			cost[i][driverIndex[driver.DriverID]] = util.EstimateETAMinutes(driver.Distance)
+		}
+	}
+
+	assignment := make([]int, len(batch))
+	for i := range assignment {
+		assignment[i] = -1
+	}
+	if len(driverIndex) > 0 {
+		assignment = solveAssignment(cost)
+	}
+
+	assigned := make(map[int]bool)
+	for _, j := range assignment {
+		if j >= 0 {
+			assigned[j] = true
+		}
+	}
+
+	for i, req := range batch {
+		if errs[i] != nil {
+			log.Printf("Error matching user %s in batch for city %s: %v", req.user.UserID, req.user.City, errs[i])
+			req.done()
+			continue
+		}
+
+		// The assigned driver leads the list, followed by candidates that no
+		// other rider in the batch was given
+		var drivers []model.DriverLocation
+		for _, driver := range candidates[i] {
+			if driverIndex[driver.DriverID] == assignment[i] {
+				drivers = append([]model.DriverLocation{driver}, drivers...)
+			} else if !assigned[driverIndex[driver.DriverID]] {
+				drivers = append(drivers, driver)
+			}
+		}
+
+		s.publishResults(ctx, req.user, drivers)
+		req.done()
+	}
+}
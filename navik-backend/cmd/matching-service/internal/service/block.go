@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"matching-service/internal/model"
+	"matching-service/internal/repository"
+)
+
+// ErrInvalidBlock is returned for a block missing its rider or driver
+var ErrInvalidBlock = errors.New("block needs a rider and a driver")
+
+// maxBlockReasonLength bounds the free-text reason stored with a block
+const maxBlockReasonLength = 500
+
+// BlockService lets riders and drivers block each other, and admins block
+// pairs, so that matching never pairs them again
+type BlockService interface {
+	// Block blocks a pair on behalf of the block's source
+	Block(ctx context.Context, block model.Block) (*model.Block, error)
+	// Unblock removes the block of a pair by one source. Blocks by other
+	// sources stay.
+	Unblock(ctx context.Context, riderID, driverID, blockedBy string) error
+	// ListBlocks returns the user's blocks, newest first. An empty blockedBy
+	// returns the blocks of every source.
+	ListBlocks(ctx context.Context, userID, blockedBy string) ([]model.Block, error)
+}
+
+type blockService struct {
+	blocks repository.BlockRepository
+}
+
+// NewBlockService creates a new block service
+func NewBlockService(blocks repository.BlockRepository) BlockService {
+	return &blockService{
+		blocks: blocks,
+	}
+}
+
+func (s *blockService) Block(ctx context.Context, block model.Block) (*model.Block, error) {
+	if block.RiderID == "" || block.DriverID == "" {
+		return nil, ErrInvalidBlock
+	}
+	if len(block.Reason) > maxBlockReasonLength {
+		block.Reason = block.Reason[:maxBlockReasonLength]
+	}
+	block.CreatedAt = time.Now().Unix()
+
+	if err := s.blocks.Block(ctx, block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+func (s *blockService) Unblock(ctx context.Context, riderID, driverID, blockedBy string) error {
+	if riderID == "" || driverID == "" {
+		return ErrInvalidBlock
+	}
+	return s.blocks.Unblock(ctx, riderID, driverID, blockedBy)
+}
+
+func (s *blockService) ListBlocks(ctx context.Context, userID, blockedBy string) ([]model.Block, error) {
+	blocks, err := s.blocks.ListBlocks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]model.Block, 0, len(blocks))
+	for _, block := range blocks {
+		if blockedBy == "" || block.BlockedBy == blockedBy {
+			filtered = append(filtered, block)
+		}
+	}
+
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].CreatedAt > filtered[j].CreatedAt
+	})
+	return filtered, nil
+}
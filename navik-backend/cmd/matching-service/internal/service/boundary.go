@@ -0,0 +1,64 @@
+package service
+
+import "matching-service/internal/util"
+
+// BoundaryZone is a circular area around a city border
+type BoundaryZone struct {
+	Latitude  float64
+	Longitude float64
+	RadiusKm  float64
+}
+
+// CityBoundary lets riders inside any of its zones be matched with drivers
+// registered in any of its cities
+type CityBoundary struct {
+	Cities []string
+	Zones  []BoundaryZone
+}
+
+// cityBoundaries decides which city partitions a rider's search may draw
+// drivers from
+type cityBoundaries struct {
+	byCity map[string][]CityBoundary
+}
+
+func newCityBoundaries(boundaries []CityBoundary) *cityBoundaries {
+	byCity := make(map[string][]CityBoundary)
+	for _, boundary := range boundaries {
+		for _, city := range boundary.Cities {
+			byCity[city] = append(byCity[city], boundary)
+		}
+	}
+	return &cityBoundaries{byCity: byCity}
+}
+
+// citiesFor returns the cities whose drivers may serve a rider, starting with
+// the rider's own city. Neighbouring cities are only included while the rider
+// is inside a boundary zone they share.
+func (b *cityBoundaries) citiesFor(city string, lat, lng float64) []string {
+	cities := []string{city}
+	seen := map[string]bool{city: true}
+
+	for _, boundary := range b.byCity[city] {
+		if !boundary.contains(lat, lng) {
+			continue
+		}
+		for _, neighbour := range boundary.Cities {
+			if !seen[neighbour] {
+				seen[neighbour] = true
+				cities = append(cities, neighbour)
+			}
+		}
+	}
+
+	return cities
+}
+
+func (b CityBoundary) contains(lat, lng float64) bool {
+	for _, zone := range b.Zones {
+		if util.HaversineKm(lat, lng, zone.Latitude, zone.Longitude) <= zone.RadiusKm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"time"
+
+	"matching-service/internal/config"
+)
+
+// NewMatchingConfig converts the loaded configuration to matching config
+func NewMatchingConfig(cfg *config.Config) MatchingConfig {
+	return MatchingConfig{
+		MinDriversToReturn: cfg.Matching.MinDriversToReturn,
+		MaxDistanceKm:      cfg.Matching.MaxDistanceKm,
+		Mode:               cfg.Matching.Mode,
+		BatchWindow:        time.Duration(cfg.Matching.BatchWindowMs) * time.Millisecond,
+		OfferTTL:           time.Duration(cfg.Reservation.OfferTTLSeconds) * time.Second,
+		Ranking: RankingConfig{
+			DefaultStrategy: cfg.Ranking.DefaultStrategy,
+			CityStrategies:  cfg.Ranking.CityStrategies,
+			Strategies:      rankingWeights(cfg.Ranking.Strategies),
+		},
+		Search: searchPlanConfig(cfg),
+		Research: ResearchConfig{
+			Enabled:         cfg.Research.Enabled,
+			Window:          time.Duration(cfg.Research.WindowSeconds) * time.Second,
+			InitialInterval: time.Duration(cfg.Research.InitialIntervalSeconds) * time.Second,
+			MinInterval:     time.Duration(cfg.Research.MinIntervalSeconds) * time.Second,
+			IntervalFactor:  cfg.Research.IntervalFactor,
+			MaxKRing:        cfg.Research.MaxKRing,
+		},
+		Pool: PoolConfig{
+			Capacity:         cfg.Pool.Capacity,
+			MaxWaitMinutes:   cfg.Pool.MaxWaitMinutes,
+			MaxDetourMinutes: cfg.Pool.MaxDetourMinutes,
+			MaxDetourRatio:   cfg.Pool.MaxDetourRatio,
+			BaseFare:         cfg.Pool.BaseFare,
+			PerKmFare:        cfg.Pool.PerKmFare,
+			TripTTL:          time.Duration(cfg.Pool.TripTTLHours) * time.Hour,
+		},
+		Boundaries:  boundaryConfig(cfg.Boundaries),
+		Experiments: NewExperiments(cfg),
+		Constraints: constraintConfig(cfg),
+	}
+}
+
+// NewExperiments converts the configured experiments to service experiments
+func NewExperiments(cfg *config.Config) []Experiment {
+	converted := make([]Experiment, 0, len(cfg.Experiments))
+	for _, experiment := range cfg.Experiments {
+		arms := make([]ExperimentArm, len(experiment.Arms))
+		for i, arm := range experiment.Arms {
+			arms[i] = ExperimentArm(arm)
+		}
+		converted = append(converted, Experiment{Name: experiment.Name, Cities: experiment.Cities, Arms: arms})
+	}
+	return converted
+}
+
+// NewScheduledRideConfig converts the configured scheduling rules to service config
+func NewScheduledRideConfig(cfg *config.Config) ScheduledRideConfig {
+	return ScheduledRideConfig{
+		MinAdvance:       time.Duration(cfg.Scheduling.MinAdvanceMinutes) * time.Minute,
+		MaxAdvance:       time.Duration(cfg.Scheduling.MaxAdvanceDays) * 24 * time.Hour,
+		MinLead:          time.Duration(cfg.Scheduling.MinLeadMinutes) * time.Minute,
+		MaxLead:          time.Duration(cfg.Scheduling.MaxLeadMinutes) * time.Minute,
+		LowSupply:        cfg.Scheduling.LowSupply,
+		HighSupply:       cfg.Scheduling.HighSupply,
+		ReminderBefore:   time.Duration(cfg.Scheduling.ReminderMinutes) * time.Minute,
+		FreeCancelBefore: time.Duration(cfg.Scheduling.FreeCancelMinutes) * time.Minute,
+		PollInterval:     time.Duration(cfg.Scheduling.PollIntervalSeconds) * time.Second,
+	}
+}
+
+// rankingWeights converts configured ranking strategies to service weights
+func rankingWeights(strategies map[string]config.RankingWeights) map[string]RankingWeights {
+	weights := make(map[string]RankingWeights, len(strategies))
+	for name, w := range strategies {
+		weights[name] = RankingWeights(w)
+	}
+	return weights
+}
+
+// constraintConfig converts the configured night hours to service config
+func constraintConfig(cfg *config.Config) ConstraintConfig {
+	return ConstraintConfig{
+		NightStartHour: cfg.Constraints.NightStartHour,
+		NightEndHour:   cfg.Constraints.NightEndHour,
+		Location:       cfg.Search.Location,
+	}
+}
+
+// boundaryConfig converts the configured city boundaries to service boundaries
+func boundaryConfig(boundaries []config.CityBoundary) []CityBoundary {
+	converted := make([]CityBoundary, 0, len(boundaries))
+	for _, boundary := range boundaries {
+		zones := make([]BoundaryZone, len(boundary.Zones))
+		for i, zone := range boundary.Zones {
+			zones[i] = BoundaryZone(zone)
+		}
+		converted = append(converted, CityBoundary{Cities: boundary.Cities, Zones: zones})
+	}
+	return converted
+}
+
+// searchPlanConfig converts the configured search plans to service plans
+func searchPlanConfig(cfg *config.Config) SearchPlanConfig {
+	plans := make(map[string][]SearchStep, len(cfg.Search.Plans))
+	for name, steps := range cfg.Search.Plans {
+		for _, step := range steps {
+			plans[name] = append(plans[name], SearchStep{
+				Resolution: step.Resolution,
+				KRing:      step.KRing,
+				MinResults: step.MinResults,
+				TimeBudget: time.Duration(step.TimeBudgetMs) * time.Millisecond,
+			})
+		}
+	}
+
+	cityPlans := make(map[string][]SearchPlanWindow, len(cfg.Search.CityPlans))
+	for city, windows := range cfg.Search.CityPlans {
+		for _, window := range windows {
+			cityPlans[city] = append(cityPlans[city], SearchPlanWindow(window))
+		}
+	}
+
+	return SearchPlanConfig{
+		DefaultPlan: cfg.Search.DefaultPlan,
+		Plans:       plans,
+		CityPlans:   cityPlans,
+		Location:    cfg.Search.Location,
+	}
+}
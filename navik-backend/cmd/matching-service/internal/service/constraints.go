@@ -0,0 +1,84 @@
+package service
+
+import (
+	"time"
+
+	"matching-service/internal/model"
+)
+
+// ConstraintConfig sets when riders' night-only constraints apply
+type ConstraintConfig struct {
+	// NightStartHour and NightEndHour bound the night in Location. The night
+	// wraps past midnight when it starts after it ends.
+	NightStartHour int
+	NightEndHour   int
+	Location       *time.Location
+}
+
+func (c ConstraintConfig) isNight(now time.Time) bool {
+	location := c.Location
+	if location == nil {
+		location = time.Local
+	}
+	night := SearchPlanWindow{StartHour: c.NightStartHour, EndHour: c.NightEndHour}
+	return night.covers(now.In(location).Hour())
+}
+
+// resolveConstraints turns night-only constraints into plain ones at night
+// and drops them by day, so filters and ranking need not know the time
+func resolveConstraints(constraints *model.RideConstraints, night bool) *model.RideConstraints {
+	if constraints == nil {
+		return nil
+	}
+
+	resolved := *constraints
+	if night && resolved.FemaleDriverAtNight {
+		resolved.FemaleDriver = true
+	}
+	resolved.FemaleDriverAtNight = false
+	return &resolved
+}
+
+// constraintsMet counts how many of the constraints the driver and their
+// vehicle meet, out of the constraints set
+func constraintsMet(constraints *model.RideConstraints, driver model.DriverLocation) (met, total int) {
+	if constraints == nil {
+		return 0, 0
+	}
+
+	check := func(wanted, has bool) {
+		if !wanted {
+			return
+		}
+		total++
+		if has {
+			met++
+		}
+	}
+
+	capabilities := driver.Capabilities
+	check(constraints.WheelchairAccessible, capabilities.WheelchairAccessible)
+	check(constraints.ChildSeat, capabilities.ChildSeat)
+	check(constraints.PetFriendly, capabilities.PetFriendly)
+	check(constraints.Electric, capabilities.Electric)
+	check(constraints.MinLuggage > 0, capabilities.LuggageCapacity >= constraints.MinLuggage)
+	check(constraints.FemaleDriver, driver.DriverGender == model.DriverGenderFemale)
+	return met, total
+}
+
+// meetsRequirements reports whether the driver meets all of the rider's hard
+// constraints
+func meetsRequirements(requirements *model.RideConstraints, driver model.DriverLocation) bool {
+	met, total := constraintsMet(requirements, driver)
+	return met == total
+}
+
+// preferenceSignal is the share of the rider's soft constraints the driver
+// meets. Riders without preferences rate every driver the same.
+func preferenceSignal(preferences *model.RideConstraints, driver model.DriverLocation) float64 {
+	met, total := constraintsMet(preferences, driver)
+	if total == 0 {
+		return 1
+	}
+	return float64(met) / float64(total)
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"matching-service/internal/model"
+	"matching-service/pkg/kafka"
+)
+
+// EventPublisher publishes match events for analytics and other services
+type EventPublisher interface {
+	// Publish queues an event without blocking the caller. Events are dropped
+	// if the queue is full.
+	Publish(event model.MatchEvent)
+	// Close publishes the queued events and closes the producer
+	Close()
+}
+
+type kafkaEventPublisher struct {
+	producer *kafka.Producer
+	queue    chan model.MatchEvent
+	done     chan struct{}
+}
+
+// NewEventPublisher creates a publisher that sends events to the city topics
+// of the producer from a background goroutine
+func NewEventPublisher(producer *kafka.Producer, queueSize int) EventPublisher {
+	p := &kafkaEventPublisher{
+		producer: producer,
+		queue:    make(chan model.MatchEvent, queueSize),
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *kafkaEventPublisher) Publish(event model.MatchEvent) {
+	event.Version = model.MatchEventVersion
+	if event.EventID == "" {
+		buf := make([]byte, 16)
+		rand.Read(buf)
+		event.EventID = hex.EncodeToString(buf)
+	}
+	if event.OccurredAt == 0 {
+		event.OccurredAt = time.Now().UnixMilli()
+	}
+
+	select {
+	case p.queue <- event:
+	default:
+		log.Printf("Dropping %s event of user %s: event queue full", event.Type, event.UserID)
+	}
+}
+
+func (p *kafkaEventPublisher) Close() {
+	close(p.queue)
+	<-p.done
+	p.producer.Close()
+}
+
+func (p *kafkaEventPublisher) run() {
+	defer close(p.done)
+
+	for event := range p.queue {
+		// Keyed by user so that a rider's events stay in order
+		if err := p.producer.SendToProducer(event, event.City, event.UserID); err != nil {
+			log.Printf("Error publishing %s event of user %s: %v", event.Type, event.UserID, err)
+		}
+	}
+}
+
+// publishEvent fills in the user's search details and publishes the event
+func (s *matchingService) publishEvent(user model.EnrichedUserLocation, event model.MatchEvent) {
+	if s.events == nil {
+		return
+	}
+
+	event.City = user.City
+	event.SearchID = user.SearchID
+	event.UserID = user.UserID
+	if experiment, arm, ok := s.experimentFor(user); ok {
+		event.Experiment, event.Arm = experiment, arm.Name
+	}
+	s.events.Publish(event)
+}
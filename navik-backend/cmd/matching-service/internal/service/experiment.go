@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+
+	"matching-service/internal/model"
+	"matching-service/internal/repository"
+)
+
+// ControlArm is the arm of riders in an experiment who get no overrides
+const ControlArm = "control"
+
+// ExperimentArm overrides the matching config for a share of an experiment's
+// riders. Empty overrides keep the city's configured strategy or plan.
+type ExperimentArm struct {
+	Name            string
+	Percent         int
+	RankingStrategy string
+	SearchPlan      string
+}
+
+// Experiment splits the riders of its cities, or of every city if none are
+// listed, between its arms. Riders not in any arm form the control arm.
+type Experiment struct {
+	Name   string
+	Cities []string
+	Arms   []ExperimentArm
+}
+
+// ArmNames returns the names of the experiment's arms, including the control arm
+func (e Experiment) ArmNames() []string {
+	names := []string{ControlArm}
+	for _, arm := range e.Arms {
+		names = append(names, arm.Name)
+	}
+	return names
+}
+
+func (e Experiment) coversCity(city string) bool {
+	if len(e.Cities) == 0 {
+		return true
+	}
+	for _, c := range e.Cities {
+		if c == city {
+			return true
+		}
+	}
+	return false
+}
+
+// assign deterministically places a rider in an arm of the experiment
+func (e Experiment) assign(userID string) ExperimentArm {
+	h := fnv.New32a()
+	h.Write([]byte(e.Name + ":" + userID))
+	bucket := int(h.Sum32() % 100)
+
+	for _, arm := range e.Arms {
+		if bucket < arm.Percent {
+			return arm
+		}
+		bucket -= arm.Percent
+	}
+	return ExperimentArm{Name: ControlArm}
+}
+
+// experimentFor returns the experiment covering the user's city and the
+// user's arm in it. Experiments are exclusive: a rider takes part in the first
+// listed experiment that covers their city.
+func (s *matchingService) experimentFor(user model.EnrichedUserLocation) (string, ExperimentArm, bool) {
+	for _, experiment := range s.experiments {
+		if experiment.coversCity(user.City) {
+			return experiment.Name, experiment.assign(user.UserID), true
+		}
+	}
+	return "", ExperimentArm{}, false
+}
+
+// searchPlanFor returns the search plan for the user, honouring the user's
+// experiment arm
+func (s *matchingService) searchPlanFor(user model.EnrichedUserLocation) SearchPlan {
+	if _, arm, ok := s.experimentFor(user); ok && arm.SearchPlan != "" {
+		if plan, ok := s.searchPlans.named(arm.SearchPlan); ok {
+			return plan
+		}
+	}
+	return s.searchPlans.forCity(user.City, s.now())
+}
+
+// rankingFor returns the ranking strategy for the user, honouring the user's
+// experiment arm
+func (s *matchingService) rankingFor(user model.EnrichedUserLocation) RankingStrategy {
+	if _, arm, ok := s.experimentFor(user); ok && arm.RankingStrategy != "" {
+		if strategy, ok := s.ranking.named(arm.RankingStrategy); ok {
+			return strategy
+		}
+	}
+	return s.ranking.forCity(user.City)
+}
+
+// tagExperiment adds the user's experiment arm to an update sent about them
+func (s *matchingService) tagExperiment(user model.EnrichedUserLocation, update map[string]interface{}) {
+	if experiment, arm, ok := s.experimentFor(user); ok {
+		update["experiment"] = experiment
+		update["arm"] = arm.Name
+	}
+}
+
+// recordExperimentOutcome counts a finished search towards the user's arm
+func (s *matchingService) recordExperimentOutcome(ctx context.Context, user model.EnrichedUserLocation, response model.DriverResponse) {
+	if response.Experiment == "" || s.experimentStats == nil {
+		return
+	}
+
+	matched := len(response.Drivers) > 0
+	eta := 0
+	if matched {
+		eta = response.Drivers[0].ETA
+	}
+
+	if err := s.experimentStats.RecordOutcome(ctx, response.Experiment, response.Arm, matched, eta); err != nil {
+		log.Printf("Error recording experiment outcome of user %s: %v", user.UserID, err)
+	}
+}
+
+// ExperimentService reports how the arms of the running experiments compare
+type ExperimentService interface {
+	Report(ctx context.Context) ([]model.ExperimentReport, error)
+}
+
+type experimentService struct {
+	experiments []Experiment
+	stats       repository.ExperimentRepository
+}
+
+// NewExperimentService creates a new experiment service
+func NewExperimentService(experiments []Experiment, stats repository.ExperimentRepository) ExperimentService {
+	return &experimentService{
+		experiments: experiments,
+		stats:       stats,
+	}
+}
+
+// Report returns the match rate and mean pickup ETA of every arm
+func (s *experimentService) Report(ctx context.Context) ([]model.ExperimentReport, error) {
+	reports := make([]model.ExperimentReport, 0, len(s.experiments))
+	for _, experiment := range s.experiments {
+		arms := experiment.ArmNames()
+		stats, err := s.stats.Stats(ctx, experiment.Name, arms)
+		if err != nil {
+			return nil, err
+		}
+
+		report := model.ExperimentReport{Experiment: experiment.Name, Cities: experiment.Cities}
+		for _, arm := range arms {
+			armStats := stats[arm]
+			armReport := model.ArmReport{
+				Arm:      arm,
+				Requests: armStats.Requests,
+				Matched:  armStats.Matched,
+			}
+			if armStats.Requests > 0 {
+				armReport.MatchRate = float64(armStats.Matched) / float64(armStats.Requests)
+			}
+			if armStats.Matched > 0 {
+				armReport.MeanPickupETAMinutes = float64(armStats.PickupETAMinutes) / float64(armStats.Matched)
+			}
+			report.Arms = append(report.Arms, armReport)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"matching-service/internal/model"
+)
+
+func TestExperimentAssign(t *testing.T) {
+	tests := []struct {
+		name string
+		arms []ExperimentArm
+		// want is the expected share of riders per arm, in percent
+		want map[string]int
+	}{
+		{name: "no arms", want: map[string]int{ControlArm: 100}},
+		{
+			name: "half and half",
+			arms: []ExperimentArm{{Name: "treatment", Percent: 50}},
+			want: map[string]int{"treatment": 50, ControlArm: 50},
+		},
+		{
+			name: "several arms",
+			arms: []ExperimentArm{{Name: "a", Percent: 10}, {Name: "b", Percent: 30}},
+			want: map[string]int{"a": 10, "b": 30, ControlArm: 60},
+		},
+		{
+			name: "every rider in arms",
+			arms: []ExperimentArm{{Name: "a", Percent: 25}, {Name: "b", Percent: 75}},
+			want: map[string]int{"a": 25, "b": 75},
+		},
+	}
+
+	const riders = 20000
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			experiment := Experiment{Name: "test", Arms: tt.arms}
+
+			counts := make(map[string]int)
+			for i := 0; i < riders; i++ {
+				counts[experiment.assign(fmt.Sprintf("user-%d", i)).Name]++
+			}
+
+			for arm, count := range counts {
+				if _, ok := tt.want[arm]; !ok {
+					t.Errorf("%d riders in unexpected arm %s", count, arm)
+				}
+			}
+			for arm, percent := range tt.want {
+				// Allow two percentage points either way
+				got := counts[arm] * 100 / riders
+				if got < percent-2 || got > percent+2 {
+					t.Errorf("arm %s got %d%% of riders, want about %d%%", arm, got, percent)
+				}
+			}
+		})
+	}
+}
+
+func TestExperimentAssignIsStable(t *testing.T) {
+	first := Experiment{Name: "first", Arms: []ExperimentArm{{Name: "treatment", Percent: 50}}}
+	second := Experiment{Name: "second", Arms: []ExperimentArm{{Name: "treatment", Percent: 50}}}
+
+	differs := false
+	for i := 0; i < 100; i++ {
+		userID := fmt.Sprintf("user-%d", i)
+		arm := first.assign(userID)
+		if again := first.assign(userID); again.Name != arm.Name {
+			t.Fatalf("user %s assigned to %s then %s", userID, arm.Name, again.Name)
+		}
+		if second.assign(userID).Name != arm.Name {
+			differs = true
+		}
+	}
+	// Riders are bucketed per experiment, so experiments split them independently
+	if !differs {
+		t.Errorf("experiments with different names split riders identically")
+	}
+}
+
+func TestExperimentFor(t *testing.T) {
+	s := &matchingService{experiments: []Experiment{
+		{Name: "pune-only", Cities: []string{"pune"}, Arms: []ExperimentArm{{Name: "all", Percent: 100}}},
+		{Name: "everywhere", Arms: []ExperimentArm{{Name: "all", Percent: 100}}},
+	}}
+
+	tests := []struct {
+		city           string
+		wantExperiment string
+	}{
+		{city: "pune", wantExperiment: "pune-only"},
+		{city: "mumbai", wantExperiment: "everywhere"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.city, func(t *testing.T) {
+			user := model.EnrichedUserLocation{UserLocation: model.UserLocation{UserID: "u1", City: tt.city}}
+			experiment, arm, ok := s.experimentFor(user)
+			if !ok || experiment != tt.wantExperiment || arm.Name != "all" {
+				t.Errorf("experimentFor(%s) = %s %s %t, want %s all", tt.city, experiment, arm.Name, ok, tt.wantExperiment)
+			}
+		})
+	}
+
+	s.experiments = s.experiments[:1]
+	user := model.EnrichedUserLocation{UserLocation: model.UserLocation{UserID: "u1", City: "mumbai"}}
+	if experiment, _, ok := s.experimentFor(user); ok {
+		t.Errorf("experimentFor(mumbai) = %s, want none", experiment)
+	}
+}
+
+func TestExperimentOverrides(t *testing.T) {
+	tests := []struct {
+		name         string
+		arm          ExperimentArm
+		wantStrategy string
+		wantPlan     string
+	}{
+		{name: "no overrides", arm: ExperimentArm{Name: "treatment", Percent: 100}, wantStrategy: "nearest", wantPlan: "default"},
+		{
+			name:         "ranking strategy",
+			arm:          ExperimentArm{Name: "treatment", Percent: 100, RankingStrategy: "fairness"},
+			wantStrategy: "fairness",
+			wantPlan:     "default",
+		},
+		{
+			name:         "search plan",
+			arm:          ExperimentArm{Name: "treatment", Percent: 100, SearchPlan: "wide"},
+			wantStrategy: "nearest",
+			wantPlan:     "wide",
+		},
+		{
+			name:         "unknown overrides ignored",
+			arm:          ExperimentArm{Name: "treatment", Percent: 100, RankingStrategy: "missing", SearchPlan: "missing"},
+			wantStrategy: "nearest",
+			wantPlan:     "default",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &matchingService{
+				ranking: newRankingStrategies(RankingConfig{DefaultStrategy: "nearest"}, time.Now),
+				searchPlans: newSearchPlans(SearchPlanConfig{
+					DefaultPlan: "default",
+					Plans:       map[string][]SearchStep{"wide": {{Resolution: 7, KRing: 1}}},
+					Location:    time.UTC,
+				}),
+				now:         time.Now,
+				experiments: []Experiment{{Name: "test", Arms: []ExperimentArm{tt.arm}}},
+			}
+			user := model.EnrichedUserLocation{UserLocation: model.UserLocation{UserID: "u1", City: "pune"}}
+
+			if got := s.rankingFor(user).Name(); got != tt.wantStrategy {
+				t.Errorf("rankingFor = %s, want %s", got, tt.wantStrategy)
+			}
+			if got := s.searchPlanFor(user).Name; got != tt.wantPlan {
+				t.Errorf("searchPlanFor = %s, want %s", got, tt.wantPlan)
+			}
+
+			update := make(map[string]interface{})
+			s.tagExperiment(user, update)
+			if update["experiment"] != "test" || update["arm"] != "treatment" {
+				t.Errorf("tagged update = %v, want experiment test arm treatment", update)
+			}
+		})
+	}
+}
@@ -2,38 +2,122 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 
 	"matching-service/internal/model"
+	"matching-service/internal/repository"
 	"matching-service/pkg/kafka"
 )
 
+// ErrInvalidLocation is returned for a ride request with missing or out of
+// range fields
+var ErrInvalidLocation = errors.New("invalid location data")
+
 type LocationService interface {
-	UpdateLocation(ctx context.Context, loc model.UserLocation) error
+	// UpdateLocation starts a ride search for the rider's location. A repeated
+	// idempotency key returns the search it started originally.
+	UpdateLocation(ctx context.Context, loc model.UserLocation, idempotencyKey string) (*model.Search, error)
+	// UpdatePickup moves the pickup of one of the rider's searches that has not
+	// found a driver and searches again from the new location
+	UpdatePickup(ctx context.Context, loc model.UserLocation) (*model.Search, error)
+	GetSearch(ctx context.Context, searchID string) (*model.Search, error)
 }
 
 type locationService struct {
+	searches repository.SearchRepository
 	producer *kafka.Producer
+	events   EventPublisher
 }
 
-func NewLocationService(repository interface{}, producer *kafka.Producer) LocationService {
+func NewLocationService(searches repository.SearchRepository, producer *kafka.Producer, events EventPublisher) LocationService {
 	return &locationService{
+		searches: searches,
 		producer: producer,
+		events:   events,
 	}
 }
 
-func (s *locationService) UpdateLocation(ctx context.Context, loc model.UserLocation) error {
+func (s *locationService) UpdateLocation(ctx context.Context, loc model.UserLocation, idempotencyKey string) (*model.Search, error) {
 	if err := loc.Validate(); err != nil {
-		return fmt.Errorf("invalid location data: %w", err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidLocation, err)
+	}
+
+	search, created, err := s.searches.Create(ctx, loc.UserID, loc.City, idempotencyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create search: %w", err)
+	}
+	if !created {
+		log.Printf("Returning existing search %s for idempotency key %s", search.SearchID, idempotencyKey)
+		return search, nil
 	}
+	loc.SearchID = search.SearchID
 
 	if s.producer != nil {
 		if err := s.producer.SendToProducer(loc, loc.City, loc.UserID); err != nil {
 			log.Printf("Warning: Failed to publish location to Kafka: %v", err)
-			return fmt.Errorf("failed to publish location: %w", err)
+			if err := s.searches.Delete(ctx, search, idempotencyKey); err != nil {
+				log.Printf("Error deleting undispatched search %s: %v", search.SearchID, err)
+			}
+			return nil, fmt.Errorf("failed to publish location: %w", err)
 		}
 	}
 
-	return nil
+	if s.events != nil {
+		s.events.Publish(model.MatchEvent{
+			Type:     model.EventSearchCreated,
+			City:     loc.City,
+			SearchID: search.SearchID,
+			UserID:   loc.UserID,
+			Request:  &loc,
+		})
+	}
+
+	return search, nil
+}
+
+func (s *locationService) UpdatePickup(ctx context.Context, loc model.UserLocation) (*model.Search, error) {
+	search, err := s.searches.Get(ctx, loc.SearchID)
+	if err != nil {
+		return nil, err
+	}
+	// Another user's search is reported as missing
+	if search.UserID != loc.UserID {
+		return nil, repository.ErrSearchNotFound
+	}
+
+	// The search stays in its city, whose topic its requests are sent to
+	loc.City = search.City
+	if err := loc.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidLocation, err)
+	}
+
+	search, err = s.searches.Reopen(ctx, loc.SearchID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The new request replaces the search's running attempt, if any
+	if s.producer != nil {
+		if err := s.producer.SendToProducer(loc, loc.City, loc.UserID); err != nil {
+			return nil, fmt.Errorf("failed to publish location: %w", err)
+		}
+	}
+
+	if s.events != nil {
+		s.events.Publish(model.MatchEvent{
+			Type:     model.EventSearchUpdated,
+			City:     loc.City,
+			SearchID: search.SearchID,
+			UserID:   loc.UserID,
+			Request:  &loc,
+		})
+	}
+
+	return search, nil
+}
+
+func (s *locationService) GetSearch(ctx context.Context, searchID string) (*model.Search, error) {
+	return s.searches.Get(ctx, searchID)
 }
@@ -4,10 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"math/rand"
-	"sort"
+	"sync"
 	"time"
 	"encoding/json"
+	"errors"
 
 	"matching-service/internal/model"
 	"matching-service/internal/repository"
@@ -16,53 +16,258 @@ import (
 )
 
 type MatchingService interface {
-	ProcessUserLocation(ctx context.Context, loc model.UserLocation) error
+	// ProcessUserLocation matches a user location message. done is called
+	// once the request has been handled, which in batched mode is after its
+	// batch delivered the user's result rather than when this returns.
+	ProcessUserLocation(ctx context.Context, loc model.UserLocation, done func()) error
 }
 
 type matchingService struct {
 	repository         repository.DriverRepository
+	matchStream        repository.MatchStreamRepository
+	reservations       repository.ReservationRepository
+	searches           repository.SearchRepository
+	traces             repository.SearchTraceRepository
+	pooledTrips        repository.PooledTripRepository
+	blocks             repository.BlockRepository
+	driverStats        repository.DriverStatsRepository
+	offerTTL           time.Duration
+	ranking            *rankingStrategies
+	searchPlans        *searchPlans
+	boundaries         *cityBoundaries
+	constraints        ConstraintConfig
 	minDriversToReturn int
 	maxDistanceKm      float64
-	redisClient        *redis.Client
+	redisClient        redis.UniversalClient
+	now                func() time.Time
+
+	experiments     []Experiment
+	experimentStats repository.ExperimentRepository
+	events          EventPublisher
+
+	mode        string
+	batchWindow time.Duration
+	batchersMu  sync.Mutex
+	batchers    map[string]*cityBatcher
+
+	pool       PoolConfig
+	research   ResearchConfig
+	sessionsMu sync.Mutex
+	sessions   map[string]*researchSession
 }
-// NewMatchingService creates a new matching service
-func NewMatchingService(repo repository.DriverRepository, config struct {
+// MatchingConfig controls how requests are matched
+type MatchingConfig struct {
 	MinDriversToReturn int
 	MaxDistanceKm      float64
-}, redisClient *redis.Client) MatchingService {
+	Mode               string
+	BatchWindow        time.Duration
+	OfferTTL           time.Duration
+	Ranking            RankingConfig
+	Search             SearchPlanConfig
+	Research           ResearchConfig
+	Pool               PoolConfig
+	Boundaries         []CityBoundary
+	Experiments        []Experiment
+	Constraints        ConstraintConfig
+	// Clock returns the current time; nil uses the wall clock. The replay
+	// harness sets it to run matches in virtual time.
+	Clock func() time.Time
+}
+
+// MatchingDependencies are the stores and publishers the matching service
+// works with. Drivers, MatchStream and Reservations are required; the others
+// may be nil where a caller does not need them, as in the replay harness.
+type MatchingDependencies struct {
+	Drivers         repository.DriverRepository
+	MatchStream     repository.MatchStreamRepository
+	Reservations    repository.ReservationRepository
+	Searches        repository.SearchRepository
+	Traces          repository.SearchTraceRepository
+	PooledTrips     repository.PooledTripRepository
+	ExperimentStats repository.ExperimentRepository
+	Blocks          repository.BlockRepository
+	DriverStats     repository.DriverStatsRepository
+	Events          EventPublisher
+	RedisClient     redis.UniversalClient
+}
+
+// NewMatchingService creates a new matching service
+func NewMatchingService(deps MatchingDependencies, config MatchingConfig) MatchingService {
+	now := config.Clock
+	if now == nil {
+		now = time.Now
+	}
+
+	ranking := newRankingStrategies(config.Ranking, now)
+	for _, experiment := range config.Experiments {
+		for _, arm := range experiment.Arms {
+			if _, ok := ranking.named(arm.RankingStrategy); arm.RankingStrategy != "" && !ok {
+				log.Printf("Warning: Experiment %s arm %s uses unknown ranking strategy %q, using the city's strategy",
+					experiment.Name, arm.Name, arm.RankingStrategy)
+			}
+		}
+	}
+
 	return &matchingService{
-		repository:         repo,
+		repository:         deps.Drivers,
+		matchStream:        deps.MatchStream,
+		reservations:       deps.Reservations,
+		searches:           deps.Searches,
+		traces:             deps.Traces,
+		pooledTrips:        deps.PooledTrips,
+		blocks:             deps.Blocks,
+		driverStats:        deps.DriverStats,
+		offerTTL:           config.OfferTTL,
+		ranking:            ranking,
+		searchPlans:        newSearchPlans(config.Search),
+		boundaries:         newCityBoundaries(config.Boundaries),
+		constraints:        config.Constraints,
 		minDriversToReturn: config.MinDriversToReturn,
 		maxDistanceKm:      config.MaxDistanceKm,
-		redisClient:        redisClient,
+		redisClient:        deps.RedisClient,
+		now:                now,
+		experiments:        config.Experiments,
+		experimentStats:    deps.ExperimentStats,
+		events:             deps.Events,
+		mode:               config.Mode,
+		batchWindow:        config.BatchWindow,
+		batchers:           make(map[string]*cityBatcher),
+		pool:               config.Pool,
+		research:           config.Research,
+		sessions:           make(map[string]*researchSession),
 	}
 }
 
 // ProcessUserLocation processes a user location message
-func (s *matchingService) ProcessUserLocation(ctx context.Context, loc model.UserLocation) error {
+func (s *matchingService) ProcessUserLocation(ctx context.Context, loc model.UserLocation, done func()) error {
+	// A batched request is done when its batch is, every other one on return
+	queued := false
+	defer func() {
+		if !queued {
+			done()
+		}
+	}()
+
 	// Enrich with H3 indices
 	enrichedUser := s.enrichUserLocation(loc)
 
 	log.Printf("Received user request: %s at H3-9: %s",
 		enrichedUser.UserID, enrichedUser.H3Index9)
 
+	if s.searchCancelled(ctx, enrichedUser) {
+		return nil
+	}
+
+	// A new request supersedes the user's background re-search
+	s.stopResearch(enrichedUser.UserID)
+
+	// Pooled rides are matched into shared trips rather than offered drivers
+	if enrichedUser.Product == model.ProductPool {
+		return s.matchPool(ctx, enrichedUser)
+	}
+
+	// In batched mode the request is matched together with the rest of its
+	// city's batch, once the batch window closes
+	if s.mode == MatchingModeBatched {
+		s.submitToBatch(enrichedUser, done)
+		queued = true
+		return nil
+	}
+
 	// Trigger the matching algorithm
 	drivers, err := s.findDriversForUser(ctx, enrichedUser)
 	if err != nil {
 		return fmt.Errorf("error finding drivers: %w", err)
 	}
 
-	// Process the matching results
-	s.processMatchingResults(enrichedUser, drivers)
-	// Store the user location in Redis for future reference
-	response := s.formatDriverResponse(enrichedUser, drivers)
+	s.publishResults(ctx, enrichedUser, drivers)
+	return nil
+
+}
+
+// publishResults sends the matched drivers to the user
+func (s *matchingService) publishResults(ctx context.Context, user model.EnrichedUserLocation, drivers []model.DriverLocation) {
+	// The rider may have cancelled while we were searching
+	if s.searchCancelled(ctx, user) {
+		return
+	}
+
+	// Only drivers we manage to reserve are offered to the user
+	drivers = s.reserveDrivers(ctx, user, drivers)
+
+	// Rather than give up, keep searching in the background for a while
+	if len(drivers) == 0 && s.research.Enabled {
+		s.recordOutcome(ctx, user, model.SearchStatusSearching)
+		s.startResearch(user)
+		return
+	}
+
+	s.deliverResults(ctx, user, drivers, nil)
+}
+
+// deliverResults records the final result of a search and sends it to the
+// user. It reports false if the search was cancelled in the meantime.
+func (s *matchingService) deliverResults(ctx context.Context, user model.EnrichedUserLocation, drivers []model.DriverLocation, pool *model.PoolMatch) bool {
+	response := s.formatDriverResponse(user, drivers)
+	response.Pool = pool
+
+	// Record the result on the search for clients polling it
+	if user.SearchID != "" {
+		err := s.searches.Complete(ctx, user.SearchID, response.Status, response.Drivers)
+		if errors.Is(err, repository.ErrSearchCancelled) {
+			// Cancelled after we reserved, withdraw the offers again
+			log.Printf("Search %s was cancelled during matching, withdrawing offers", user.SearchID)
+			if _, err := s.reservations.ReleaseAll(ctx, offerHolder(user), ""); err != nil {
+				log.Printf("Error releasing offers of cancelled search %s: %v", user.SearchID, err)
+			}
+			s.recordOutcome(ctx, user, model.SearchStatusCancelled)
+			return false
+		} else if err != nil {
+			log.Printf("Error recording result of search %s: %v", user.SearchID, err)
+		}
+	}
+	s.recordOutcome(ctx, user, response.Status)
+	s.recordExperimentOutcome(ctx, user, response)
+	s.publishEvent(user, model.MatchEvent{
+		Type:       model.EventSearchCompleted,
+		Status:     response.Status,
+		Candidates: response.Drivers,
+		Pool:       pool,
+	})
+
+	// Append to the user's match stream, which stores the latest state and
+	// publishes to Redis Pub/Sub for connected sockets
 	data, _ := json.Marshal(response)
-	// Publish to Redis Pub/Sub for this user
-	if err := s.redisClient.Publish(ctx, "user:"+loc.UserID, data).Err(); err != nil {
+	seq, err := s.matchStream.Publish(ctx, user.UserID, data)
+	if err != nil {
 		log.Printf("Failed to publish to Redis: %v", err)
 	}
-	return nil
 
+	// Process the matching results
+	s.processMatchingResults(user, drivers, seq)
+	return true
+}
+
+// searchCancelled reports whether the rider cancelled the search the request
+// belongs to
+func (s *matchingService) searchCancelled(ctx context.Context, user model.EnrichedUserLocation) bool {
+	if user.SearchID == "" {
+		return false
+	}
+
+	search, err := s.searches.Get(ctx, user.SearchID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrSearchNotFound) {
+			log.Printf("Error reading search %s: %v", user.SearchID, err)
+		}
+		return false
+	}
+
+	if search.Status == model.SearchStatusCancelled {
+		log.Printf("Skipping cancelled search %s of user %s", user.SearchID, user.UserID)
+		return true
+	}
+	return false
 }
 
 // enrichUserLocation adds H3 indices to a user location
@@ -71,6 +276,10 @@ func (s *matchingService) enrichUserLocation(loc model.UserLocation) model.Enric
 	h3Index8 := util.GeoToH3Index(loc.Latitude, loc.Longitude, 8)
 	h3Index7 := util.GeoToH3Index(loc.Latitude, loc.Longitude, 7)
 
+	night := s.constraints.isNight(s.now())
+	loc.Requirements = resolveConstraints(loc.Requirements, night)
+	loc.Preferences = resolveConstraints(loc.Preferences, night)
+
 	return model.EnrichedUserLocation{
 		UserLocation: loc,
 		H3Index9:     h3Index9,
@@ -80,130 +289,185 @@ func (s *matchingService) enrichUserLocation(loc model.UserLocation) model.Enric
 }
 
 
+// findDriversForUser runs the search plan for the user's city until enough
+// unreserved drivers are found, then ranks them
 func (s *matchingService) findDriversForUser(ctx context.Context, user model.EnrichedUserLocation) ([]model.DriverLocation, error) {
-	// Step 1: Try to find drivers in the exact H9 cell
-	drivers, err := s.repository.FindDriversInH9Cell(ctx, user.H3Index9)
-	if err != nil {
-		return nil, fmt.Errorf("error querying H9 cell: %w", err)
-	}
+	drivers, _, err := s.findDrivers(ctx, user, s.searchPlanFor(user))
+	return drivers, err
+}
 
-	log.Printf("Found %d drivers in exact H9 cell %s", len(drivers), user.H3Index9)
+// findDrivers runs a search plan and also reports how many drivers it found
+// that were reserved for other requests. The run is recorded on the search's
+// trace.
+func (s *matchingService) findDrivers(ctx context.Context, user model.EnrichedUserLocation, plan SearchPlan) ([]model.DriverLocation, int, error) {
+	startTime := time.Now()
+	attempt := model.TraceAttempt{Plan: plan.Name, StartedAt: startTime.Unix()}
 
-	// If we found enough drivers, rank and return them
-	if len(drivers) >= s.minDriversToReturn {
-		rankedDrivers := s.assignRandomDistances(drivers)
-		return s.getTopDrivers(rankedDrivers, s.minDriversToReturn), nil
-	}
+	drivers, busyDrivers, err := s.runSearchPlan(ctx, user, plan, &attempt)
 
-	// Step 2: Not enough drivers, try H9 neighbors
-	h9Neighbors := util.GetH3Neighbors(user.H3Index9)
-	log.Printf("Looking for drivers in %d neighboring H9 cells", len(h9Neighbors))
-
-	// Query for drivers in neighboring H9 cells
-	neighborDrivers, err := s.repository.FindDriversInH9Cells(ctx, h9Neighbors)
+	attempt.DurationMs = float64(time.Since(startTime).Microseconds()) / 1000
 	if err != nil {
-		return nil, fmt.Errorf("error querying H9 neighbor cells: %w", err)
-	}
-
-	// Combine with drivers from the exact cell
-	allDrivers := append(drivers, neighborDrivers...)
-	log.Printf("Found total of %d drivers in H9 cell and neighbors", len(allDrivers))
-
-	// If we found enough drivers, rank and return them
-	if len(allDrivers) >= s.minDriversToReturn {
-		rankedDrivers := s.assignRandomDistances(allDrivers)
-		return s.getTopDrivers(rankedDrivers, s.minDriversToReturn), nil
+		attempt.Error = err.Error()
 	}
-
-	// Step 3: Still not enough drivers, move up to H8 cell
-	log.Printf("Not enough drivers in H9 cells, moving up to H8 cell %s", user.H3Index8)
-
-	h8Drivers, err := s.repository.FindDriversInH8Cell(ctx, user.H3Index8)
-	if err != nil {
-		return nil, fmt.Errorf("error querying H8 cell: %w", err)
+	s.recordTrace(ctx, user, func(trace *model.SearchTrace) {
+		trace.Attempts = append(trace.Attempts, attempt)
+	})
+	if err == nil {
+		s.publishEvent(user, model.MatchEvent{
+			Type:       model.EventSearchCandidates,
+			Candidates: s.formatDriverResponse(user, drivers).Drivers,
+		})
 	}
 
-	log.Printf("Found %d drivers in H8 cell", len(h8Drivers))
+	return drivers, busyDrivers, err
+}
 
-	// Filter out drivers we already found in H9 cells to avoid duplicates
-	h8Drivers = s.filterOutDuplicateDrivers(h8Drivers, allDrivers)
+// runSearchPlan runs the steps of a search plan until enough unreserved
+// drivers are found, then ranks them
+func (s *matchingService) runSearchPlan(ctx context.Context, user model.EnrichedUserLocation, plan SearchPlan, attempt *model.TraceAttempt) ([]model.DriverLocation, int, error) {
+	var allDrivers []model.DriverLocation
+	busyDrivers := 0
+	queried := make(map[string]bool)
+
+	for i, step := range plan.Steps {
+		origin := util.GeoToH3Index(user.Latitude, user.Longitude, step.Resolution)
+
+		// Skip cells an earlier step already covered
+		var cells []string
+		for _, cell := range util.GetH3KRing(origin, step.KRing) {
+			if !queried[cell] {
+				queried[cell] = true
+				cells = append(cells, cell)
+			}
+		}
 
-	allDrivers = append(allDrivers, h8Drivers...)
+		stepStart := time.Now()
+		traceStep := model.TraceStep{Resolution: step.Resolution, KRing: step.KRing, Cells: cells}
+		stepDrivers, err := s.runSearchStep(ctx, step, cells)
+		traceStep.DurationMs = float64(time.Since(stepStart).Microseconds()) / 1000
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				log.Printf("Search step %d of plan %s exceeded its %v budget, moving on", i+1, plan.Name, step.TimeBudget)
+				traceStep.TimedOut = true
+				attempt.Steps = append(attempt.Steps, traceStep)
+				continue
+			}
+			attempt.Steps = append(attempt.Steps, traceStep)
+			return nil, busyDrivers, fmt.Errorf("error querying H%d cells (k=%d): %w", step.Resolution, step.KRing, err)
+		}
+		traceStep.Found = len(stepDrivers)
+
+		// Filter out drivers we already found to avoid duplicates
+		stepDrivers, duplicates := s.filterOutDuplicateDrivers(stepDrivers, allDrivers)
+		stepDrivers, ineligible := s.filterOutIneligibleDrivers(user, stepDrivers)
+		stepDrivers, blocked := s.filterOutBlockedDrivers(ctx, user, stepDrivers)
+		stepDrivers, busy := s.filterOutReservedDrivers(ctx, user, stepDrivers)
+		busyDrivers += len(busy)
+		allDrivers = append(allDrivers, stepDrivers...)
+
+		traceStep.Kept = len(stepDrivers)
+		traceStep.Filtered = append(append(append(duplicates, ineligible...), blocked...), busy...)
+		attempt.Steps = append(attempt.Steps, traceStep)
+
+		log.Printf("Step %d of plan %s: found %d drivers in %d H%d cells (k=%d), %d total",
+			i+1, plan.Name, len(stepDrivers), len(cells), step.Resolution, step.KRing, len(allDrivers))
+
+		minResults := step.MinResults
+		if minResults == 0 {
+			minResults = s.minDriversToReturn
+		}
 
-	if len(allDrivers) >= s.minDriversToReturn {
-		rankedDrivers := s.assignRandomDistances(allDrivers)
-		return s.getTopDrivers(rankedDrivers, s.minDriversToReturn), nil
+		// If we found enough drivers, rank and return them
+		if len(allDrivers) >= minResults {
+			return s.rankAndSelect(ctx, user, allDrivers, attempt), busyDrivers, nil
+		}
 	}
 
-	// Step 4: Still not enough drivers, try H8 neighbors
-	h8Neighbors := util.GetH3Neighbors(user.H3Index8)
-	log.Printf("Looking for drivers in %d neighboring H8 cells", len(h8Neighbors))
-
-	// Query for drivers in neighboring H8 cells
-	h8NeighborDrivers, err := s.repository.FindDriversInH8Cells(ctx, h8Neighbors)
-	if err != nil {
-		return nil, fmt.Errorf("error querying H8 neighbor cells: %w", err)
+	// Return whatever drivers we found, even if less than minDriversToReturn
+	if len(allDrivers) > 0 {
+		return s.rankAndSelect(ctx, user, allDrivers, attempt), busyDrivers, nil
 	}
 
-	// Filter out drivers we already found
-	h8NeighborDrivers = s.filterOutDuplicateDrivers(h8NeighborDrivers, allDrivers)
+	// No drivers found
+	return []model.DriverLocation{}, busyDrivers, nil
+}
 
-	// Combine with all previous drivers
-	allDrivers = append(allDrivers, h8NeighborDrivers...)
-	log.Printf("Found total of %d drivers after H8 neighbors", len(allDrivers))
+// rankAndSelect ranks the drivers and returns the top ones, recording every
+// ranked candidate on the attempt
+func (s *matchingService) rankAndSelect(ctx context.Context, user model.EnrichedUserLocation, drivers []model.DriverLocation, attempt *model.TraceAttempt) []model.DriverLocation {
+	s.applyDriverStats(ctx, drivers)
+	rankedDrivers := s.rankDrivers(user, drivers)
+	topDrivers := s.getTopDrivers(rankedDrivers, s.minDriversToReturn)
 
-	// If we found enough drivers, rank and return them
-	if len(allDrivers) >= s.minDriversToReturn {
-		rankedDrivers := s.assignRandomDistances(allDrivers)
-		return s.getTopDrivers(rankedDrivers, s.minDriversToReturn), nil
+	attempt.Ranked = make([]model.TraceCandidate, len(rankedDrivers))
+	for i, driver := range rankedDrivers {
+		attempt.Ranked[i] = model.TraceCandidate{
+			DriverID:    driver.DriverID,
+			VehicleType: driver.VehicleType,
+			Distance:    driver.Distance,
+			ETA:         driver.ETA,
+			Score:       driver.Score,
+			Selected:    i < len(topDrivers),
+		}
 	}
 
-	// Step 5: Still not enough drivers, move up to H7 cell
-	log.Printf("Not enough drivers in H8 cells, moving up to H7 cell %s", user.H3Index7)
+	return topDrivers
+}
 
-	h7Drivers, err := s.repository.FindDriversInH7Cell(ctx, user.H3Index7)
-	if err != nil {
-		return nil, fmt.Errorf("error querying H7 cell: %w", err)
+// applyDriverStats fills in the drivers' quality signals from their stats.
+// Drivers without stats, or all of them if the stats cannot be read, keep
+// what they have and are ranked as neutral on the rest.
+func (s *matchingService) applyDriverStats(ctx context.Context, drivers []model.DriverLocation) {
+	if s.driverStats == nil || len(drivers) == 0 {
+		return
 	}
 
-	log.Printf("Found %d drivers in H7 cell", len(h7Drivers))
-
-	h7Drivers = s.filterOutDuplicateDrivers(h7Drivers, allDrivers)
-
-	allDrivers = append(allDrivers, h7Drivers...)
-
-	if len(allDrivers) >= s.minDriversToReturn {
-		rankedDrivers := s.assignRandomDistances(allDrivers)
-		return s.getTopDrivers(rankedDrivers, s.minDriversToReturn), nil
+	driverIDs := make([]string, len(drivers))
+	for i, driver := range drivers {
+		driverIDs[i] = driver.DriverID
 	}
-
-	// Return whatever drivers we found, even if less than minDriversToReturn
-	if len(allDrivers) > 0 {
-		rankedDrivers := s.assignRandomDistances(allDrivers)
-		return rankedDrivers, nil
+	stats, err := s.driverStats.Get(ctx, driverIDs)
+	if err != nil {
+		log.Printf("Error reading driver stats, ranking without them: %v", err)
+		return
 	}
 
-	// No drivers found
-	return []model.DriverLocation{}, nil
+	for i := range drivers {
+		driverStats, ok := stats[drivers[i].DriverID]
+		if !ok {
+			continue
+		}
+		if driverStats.Rating > 0 {
+			drivers[i].Rating = driverStats.Rating
+		}
+		if driverStats.AcceptanceRate > 0 {
+			drivers[i].AcceptanceRate = driverStats.AcceptanceRate
+		}
+		if driverStats.LastTripAt > 0 {
+			drivers[i].LastTripAt = driverStats.LastTripAt
+		}
+	}
 }
 
-// assignRandomDistances assigns random distances to drivers and sorts them
-func (s *matchingService) assignRandomDistances(drivers []model.DriverLocation) []model.DriverLocation {
-	// Assign random distances
-	for i := range drivers {
-		// Random distance between 0.5 and 5 km
-		drivers[i].Distance = 0.5 + rand.Float64()*4.5
+// runSearchStep queries the cells of one search step within its time budget
+func (s *matchingService) runSearchStep(ctx context.Context, step SearchStep, cells []string) ([]model.DriverLocation, error) {
+	if len(cells) == 0 {
+		return nil, nil
+	}
 
-		// Calculate estimated time of arrival (1 minute per km + random 1-3 minutes)
-		drivers[i].ETA = int(drivers[i].Distance) + rand.Intn(3) + 1
+	if step.TimeBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, step.TimeBudget)
+		defer cancel()
 	}
 
-	// Sort by distance
-	sort.Slice(drivers, func(i, j int) bool {
-		return drivers[i].Distance < drivers[j].Distance
-	})
+	return s.repository.FindDriversInCells(ctx, step.Resolution, cells)
+}
 
-	return drivers
+// rankDrivers orders drivers with the ranking strategy of the user's city or
+// experiment arm
+func (s *matchingService) rankDrivers(user model.EnrichedUserLocation, drivers []model.DriverLocation) []model.DriverLocation {
+	return s.rankingFor(user).Rank(user, drivers)
 }
 
 // getTopDrivers returns the top N drivers from a ranked list
@@ -215,7 +479,7 @@ func (s *matchingService) getTopDrivers(drivers []model.DriverLocation, n int) [
 }
 
 // filterOutDuplicateDrivers removes drivers that are already in the existingDrivers list
-func (s *matchingService) filterOutDuplicateDrivers(newDrivers, existingDrivers []model.DriverLocation) []model.DriverLocation {
+func (s *matchingService) filterOutDuplicateDrivers(newDrivers, existingDrivers []model.DriverLocation) ([]model.DriverLocation, []model.FilteredDriver) {
 	// Create a map of existing driver IDs for quick lookup
 	existingDriverMap := make(map[string]bool)
 	for _, driver := range existingDrivers {
@@ -224,26 +488,179 @@ func (s *matchingService) filterOutDuplicateDrivers(newDrivers, existingDrivers
 
 	// Filter out duplicates
 	var uniqueDrivers []model.DriverLocation
+	var filtered []model.FilteredDriver
 	for _, driver := range newDrivers {
-		if !existingDriverMap[driver.DriverID] {
-			uniqueDrivers = append(uniqueDrivers, driver)
+		if existingDriverMap[driver.DriverID] {
+			filtered = append(filtered, model.FilteredDriver{DriverID: driver.DriverID, Reason: model.FilterDuplicate})
+			continue
+		}
+		uniqueDrivers = append(uniqueDrivers, driver)
+	}
+
+	return uniqueDrivers, filtered
+}
+
+// filterOutIneligibleDrivers removes drivers that cannot serve the user:
+// drivers of cities that may not serve the user's location, drivers beyond
+// the maximum distance, drivers of another vehicle type than requested and
+// drivers not meeting the rider's requirements
+func (s *matchingService) filterOutIneligibleDrivers(user model.EnrichedUserLocation, drivers []model.DriverLocation) ([]model.DriverLocation, []model.FilteredDriver) {
+	cities := s.boundaries.citiesFor(user.City, user.Latitude, user.Longitude)
+	allowedCities := make(map[string]bool, len(cities))
+	for _, city := range cities {
+		allowedCities[city] = true
+	}
+
+	var eligible []model.DriverLocation
+	var filtered []model.FilteredDriver
+	crossCity := 0
+	for _, driver := range drivers {
+		distance := util.HaversineKm(user.Latitude, user.Longitude, driver.Latitude, driver.Longitude)
+
+		// Drivers without a recorded city predate city tagging and are kept
+		reason := ""
+		switch {
+		case driver.City != "" && !allowedCities[driver.City]:
+			reason = model.FilterOtherCity
+		case s.maxDistanceKm > 0 && distance > s.maxDistanceKm:
+			reason = model.FilterTooFar
+		case user.VehicleType != "" && driver.VehicleType != user.VehicleType:
+			reason = model.FilterWrongVehicle
+		case !meetsRequirements(user.Requirements, driver):
+			reason = model.FilterUnmetRequirement
+		}
+		if reason != "" {
+			filtered = append(filtered, model.FilteredDriver{DriverID: driver.DriverID, Reason: reason, Distance: distance})
+			continue
+		}
+
+		if driver.City != "" && driver.City != user.City {
+			crossCity++
+		}
+		eligible = append(eligible, driver)
+	}
+
+	if crossCity > 0 {
+		log.Printf("Including %d drivers from neighbouring cities %v for user %s in %s boundary zone",
+			crossCity, cities[1:], user.UserID, user.City)
+	}
+
+	return eligible, filtered
+}
+
+// filterOutBlockedDrivers removes drivers blocked from being matched with the
+// user by the user, the driver or an admin
+func (s *matchingService) filterOutBlockedDrivers(ctx context.Context, user model.EnrichedUserLocation, drivers []model.DriverLocation) ([]model.DriverLocation, []model.FilteredDriver) {
+	if s.blocks == nil || len(drivers) == 0 {
+		return drivers, nil
+	}
+
+	driverIDs := make([]string, len(drivers))
+	for i, driver := range drivers {
+		driverIDs[i] = driver.DriverID
+	}
+
+	// Matching a blocked pair is worse than a slower match, so a failed
+	// check drops the step's drivers rather than risking one
+	blocked, err := s.blocks.BlockedDrivers(ctx, user.UserID, driverIDs)
+	if err != nil {
+		log.Printf("Error checking blocked drivers for user %s: %v", user.UserID, err)
+		return nil, nil
+	}
+
+	var allowed []model.DriverLocation
+	var filtered []model.FilteredDriver
+	for _, driver := range drivers {
+		if blocked[driver.DriverID] {
+			filtered = append(filtered, model.FilteredDriver{DriverID: driver.DriverID, Reason: model.FilterBlocked})
+			continue
 		}
+		allowed = append(allowed, driver)
 	}
 
-	return uniqueDrivers
+	return allowed, filtered
+}
+
+// filterOutReservedDrivers removes drivers that are reserved for another request
+func (s *matchingService) filterOutReservedDrivers(ctx context.Context, user model.EnrichedUserLocation, drivers []model.DriverLocation) ([]model.DriverLocation, []model.FilteredDriver) {
+	if len(drivers) == 0 {
+		return drivers, nil
+	}
+
+	driverIDs := make([]string, len(drivers))
+	for i, driver := range drivers {
+		driverIDs[i] = driver.DriverID
+	}
+
+	// Offering a driver another rider holds would double-assign them, so a
+	// failed check drops the step's drivers like a failed block check
+	reserved, err := s.reservations.ReservedByOthers(ctx, driverIDs, offerHolder(user))
+	if err != nil {
+		log.Printf("Error checking driver reservations for user %s: %v", user.UserID, err)
+		return nil, nil
+	}
+
+	var available []model.DriverLocation
+	var filtered []model.FilteredDriver
+	for _, driver := range drivers {
+		if reserved[driver.DriverID] {
+			filtered = append(filtered, model.FilteredDriver{DriverID: driver.DriverID, Reason: model.FilterBusy})
+			continue
+		}
+		available = append(available, driver)
+	}
+
+	if len(reserved) > 0 {
+		log.Printf("Skipped %d reserved drivers for user %s", len(reserved), user.UserID)
+	}
+
+	return available, filtered
+}
+
+// reserveDrivers soft-reserves the drivers offered to a user and drops any
+// driver another matcher reserved in the meantime
+func (s *matchingService) reserveDrivers(ctx context.Context, user model.EnrichedUserLocation, drivers []model.DriverLocation) []model.DriverLocation {
+	var reservedDrivers []model.DriverLocation
+	var lost []model.FilteredDriver
+	for _, driver := range drivers {
+		held, err := s.reservations.SoftReserve(ctx, driver.DriverID, offerHolder(user), s.offerTTL)
+		if err != nil {
+			log.Printf("Error reserving driver %s: %v", driver.DriverID, err)
+			continue
+		}
+		if !held {
+			log.Printf("Driver %s was reserved by another request", driver.DriverID)
+			lost = append(lost, model.FilteredDriver{DriverID: driver.DriverID, Reason: model.FilterBusy, Distance: driver.Distance})
+			continue
+		}
+		reservedDrivers = append(reservedDrivers, driver)
+		s.publishEvent(user, model.MatchEvent{Type: model.EventOfferCreated, DriverID: driver.DriverID})
+	}
+
+	if len(lost) > 0 {
+		s.recordTrace(ctx, user, func(trace *model.SearchTrace) {
+			trace.Unreserved = append(trace.Unreserved, lost...)
+		})
+	}
+
+	return reservedDrivers
 }
 
 // formatDriverResponse creates a formatted response from the matched drivers
 func (s *matchingService) formatDriverResponse(user model.EnrichedUserLocation, drivers []model.DriverLocation) model.DriverResponse {
 	response := model.DriverResponse{
+		SearchID:    user.SearchID,
 		UserID:      user.UserID,
-		RequestTime: time.Now().Unix(),
-		Status:      "SUCCESS",
+		RequestTime: s.now().Unix(),
+		Status:      model.SearchStatusMatched,
+	}
+	if experiment, arm, ok := s.experimentFor(user); ok {
+		response.Experiment, response.Arm = experiment, arm.Name
 	}
 
 	// If no drivers found, set appropriate status
 	if len(drivers) == 0 {
-		response.Status = "NO_DRIVERS_AVAILABLE"
+		response.Status = model.SearchStatusNoDrivers
 		return response
 	}
 
@@ -255,6 +672,7 @@ func (s *matchingService) formatDriverResponse(user model.EnrichedUserLocation,
 			VehicleType: driver.VehicleType,
 			Distance:    driver.Distance,
 			ETA:         driver.ETA,
+			Score:       driver.Score,
 		}
 	}
 
@@ -263,7 +681,7 @@ func (s *matchingService) formatDriverResponse(user model.EnrichedUserLocation,
 }
 
 // processMatchingResults handles the results of driver matching
-func (s *matchingService) processMatchingResults(user model.EnrichedUserLocation, drivers []model.DriverLocation) {
+func (s *matchingService) processMatchingResults(user model.EnrichedUserLocation, drivers []model.DriverLocation, seq int64) {
 	if len(drivers) == 0 {
 		log.Printf("No drivers available for user %s", user.UserID)
 		return
@@ -271,42 +689,31 @@ func (s *matchingService) processMatchingResults(user model.EnrichedUserLocation
 
 	log.Printf("Found %d drivers for user %s", len(drivers), user.UserID)
 
-	response := s.formatDriverResponse(user, drivers)
+	ctx := context.Background()
+
+	notification := map[string]interface{}{
+		"event":       "driver_matches_updated",
+		"user_id":     user.UserID,
+		"search_id":   user.SearchID,
+		"match_count": len(drivers),
+		"seq":         seq,
+		"timestamp":   s.now().Unix(),
+	}
+	s.tagExperiment(user, notification)
+
+	notificationJSON, err := json.Marshal(notification)
+	if err != nil {
+		log.Printf("Error marshaling notification: %v", err)
+		return
+	}
 
+	// The replay harness runs without Redis
+	if s.redisClient == nil {
+		return
+	}
 
-    ctx := context.Background()
-    userKey := fmt.Sprintf("user:%s:matches", user.UserID)
-    
-    responseJSON, err := json.Marshal(response)
-    if err != nil {
-        log.Printf("Error marshaling response to JSON: %v", err)
-        return
-    }
-    
-    // Store in Redis with 5 minute expiration
-    err = s.redisClient.Set(ctx, userKey, responseJSON, 5*time.Minute).Err()
-    if err != nil {
-        log.Printf("Error storing matches in Redis: %v", err)
-        return
-    }
-    
-    log.Printf("Stored %d driver matches in Redis for user %s", len(drivers), user.UserID)
-    
-    notification := map[string]interface{}{
-        "event": "driver_matches_updated",
-        "user_id": user.UserID,
-        "match_count": len(drivers),
-        "timestamp": time.Now().Unix(),
-    }
-    
-    notificationJSON, err := json.Marshal(notification)
-    if err != nil {
-        log.Printf("Error marshaling notification: %v", err)
-        return
-    }
-    
-    err = s.redisClient.Publish(ctx, "user_updates", notificationJSON).Err()
-    if err != nil {
-        log.Printf("Error publishing update notification: %v", err)
-    }
-}
\ No newline at end of file
+	err = s.redisClient.Publish(ctx, "user_updates", notificationJSON).Err()
+	if err != nil {
+		log.Printf("Error publishing update notification: %v", err)
+	}
+}
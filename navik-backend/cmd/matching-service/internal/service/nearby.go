@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"matching-service/internal/model"
+	"matching-service/internal/repository"
+	"matching-service/internal/util"
+)
+
+const (
+	// nearbyResolution is the H3 resolution drivers are looked up at. Riders
+	// whose centers share an H7 cell share lookups.
+	nearbyResolution = 7
+	// h7EdgeKm and h7SpacingKm are the edge length of an H7 cell and the
+	// distance between neighbouring cell centers
+	h7EdgeKm    = 1.22
+	h7SpacingKm = 2.11
+	// headingStepDegrees rounds headings to the eight compass points
+	headingStepDegrees = 45
+)
+
+// NearbyConfig controls the live view of available cars on the rider home screen
+type NearbyConfig struct {
+	// Interval is how often a stream is refreshed, and how long lookups are
+	// shared between streams
+	Interval    time.Duration
+	MaxRadiusKm float64
+	MaxCars     int
+	// SnapResolution is the H3 resolution whose cell centers car positions
+	// are snapped to
+	SnapResolution int
+}
+
+// NearbyService shows riders the available cars around them, with positions
+// coarse enough not to track individual drivers
+type NearbyService interface {
+	// Nearby returns the available cars in the area, closest first. Car IDs
+	// are derived from streamKey, so they are stable within a stream only.
+	Nearby(ctx context.Context, area model.NearbyArea, streamKey []byte) ([]model.NearbyCar, error)
+	// Interval is how often streams of nearby cars are refreshed
+	Interval() time.Duration
+}
+
+type nearbyLookup struct {
+	drivers   []model.DriverLocation
+	fetchedAt time.Time
+}
+
+type nearbyService struct {
+	drivers      repository.DriverRepository
+	reservations repository.ReservationRepository
+	config       NearbyConfig
+
+	mu      sync.Mutex
+	lookups map[string]nearbyLookup
+}
+
+// NewNearbyService creates a nearby cars service
+func NewNearbyService(drivers repository.DriverRepository, reservations repository.ReservationRepository, config NearbyConfig) NearbyService {
+	return &nearbyService{
+		drivers:      drivers,
+		reservations: reservations,
+		config:       config,
+		lookups:      make(map[string]nearbyLookup),
+	}
+}
+
+func (s *nearbyService) Interval() time.Duration {
+	return s.config.Interval
+}
+
+// Nearby looks up the drivers around the area's center and hides their
+// identities and exact positions
+func (s *nearbyService) Nearby(ctx context.Context, area model.NearbyArea, streamKey []byte) ([]model.NearbyCar, error) {
+	radius := s.config.MaxRadiusKm
+	if area.RadiusKm > 0 && area.RadiusKm < radius {
+		radius = area.RadiusKm
+	}
+
+	drivers, err := s.lookup(ctx, area.Latitude, area.Longitude, radius)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []model.DriverLocation
+	for _, driver := range drivers {
+		if area.VehicleType != "" && driver.VehicleType != area.VehicleType {
+			continue
+		}
+		driver.Distance = util.HaversineKm(area.Latitude, area.Longitude, driver.Latitude, driver.Longitude)
+		if driver.Distance > radius {
+			continue
+		}
+		candidates = append(candidates, driver)
+	}
+
+	// Drivers offered to or assigned to a rider are not available
+	driverIDs := make([]string, len(candidates))
+	for i, driver := range candidates {
+		driverIDs[i] = driver.DriverID
+	}
+	reserved, err := s.reservations.ReservedByOthers(ctx, driverIDs, "")
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Distance < candidates[j].Distance
+	})
+
+	cars := []model.NearbyCar{}
+	for _, driver := range candidates {
+		if reserved[driver.DriverID] {
+			continue
+		}
+		if len(cars) == s.config.MaxCars {
+			break
+		}
+		cars = append(cars, s.obscure(driver, streamKey))
+	}
+	return cars, nil
+}
+
+// lookup returns the active drivers within radiusKm of the point, reusing a
+// lookup of the same H7 cell made within the refresh interval
+func (s *nearbyService) lookup(ctx context.Context, latitude, longitude, radiusKm float64) ([]model.DriverLocation, error) {
+	cell := util.GeoToH3Index(latitude, longitude, nearbyResolution)
+	// The point can be anywhere in its cell, so the ring must reach radiusKm
+	// beyond the cell's edge
+	k := int(math.Ceil((radiusKm + h7EdgeKm) / h7SpacingKm))
+	key := fmt.Sprintf("%s:%d", cell, k)
+	now := time.Now()
+
+	s.mu.Lock()
+	cached, ok := s.lookups[key]
+	s.mu.Unlock()
+	if ok && now.Sub(cached.fetchedAt) < s.config.Interval {
+		return cached.drivers, nil
+	}
+
+	drivers, err := s.drivers.FindDriversInCells(ctx, nearbyResolution, util.GetH3KRing(cell, k))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find nearby drivers: %w", err)
+	}
+
+	s.mu.Lock()
+	for key, lookup := range s.lookups {
+		if now.Sub(lookup.fetchedAt) >= s.config.Interval {
+			delete(s.lookups, key)
+		}
+	}
+	s.lookups[key] = nearbyLookup{drivers: drivers, fetchedAt: now}
+	s.mu.Unlock()
+
+	return drivers, nil
+}
+
+// obscure snaps a driver's position to the center of its H3 cell, rounds the
+// heading and replaces the driver ID with one derived from the stream key
+func (s *nearbyService) obscure(driver model.DriverLocation, streamKey []byte) model.NearbyCar {
+	cell := util.GeoToH3Index(driver.Latitude, driver.Longitude, s.config.SnapResolution)
+	latitude, longitude := util.H3ToGeo(cell)
+
+	mac := hmac.New(sha256.New, streamKey)
+	mac.Write([]byte(driver.DriverID))
+
+	return model.NearbyCar{
+		ID:          hex.EncodeToString(mac.Sum(nil))[:16],
+		Latitude:    latitude,
+		Longitude:   longitude,
+		Heading:     math.Mod(math.Round(driver.Heading/headingStepDegrees)*headingStepDegrees, 360),
+		VehicleType: driver.VehicleType,
+	}
+}
@@ -0,0 +1,435 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"matching-service/internal/model"
+	"matching-service/internal/repository"
+	"matching-service/internal/util"
+)
+
+var (
+	// ErrPoolInsertionInfeasible is returned when a rider no longer fits a trip
+	ErrPoolInsertionInfeasible = errors.New("rider no longer fits the pooled trip")
+	// ErrNotTripDriver is returned when a driver updates another driver's trip
+	ErrNotTripDriver = errors.New("driver is not assigned to the pooled trip")
+)
+
+// PoolConfig controls which riders may share a pooled trip and how its fare
+// is split
+type PoolConfig struct {
+	// Capacity is the number of riders a pooled vehicle carries at once
+	Capacity int
+	// MaxWaitMinutes bounds the time from match to pickup for a joining rider
+	MaxWaitMinutes float64
+	// MaxDetourMinutes bounds how much later any stop of the riders already on
+	// the trip may be served because of a new rider
+	MaxDetourMinutes float64
+	// MaxDetourRatio bounds a joining rider's ride time relative to riding alone
+	MaxDetourRatio float64
+	// The trip fare is BaseFare plus PerKmFare for the remaining route, split
+	// between riders in proportion to their direct distances
+	BaseFare  float64
+	PerKmFare float64
+	// TripTTL is how long a trip and its driver's reservation are kept
+	// without updates
+	TripTTL time.Duration
+}
+
+// poolInsertion is a feasible placement of a rider's pickup and drop-off in a trip
+type poolInsertion struct {
+	stops         []model.TripStop
+	addedMinutes  float64
+	detourMinutes float64
+}
+
+// routeETAs returns the stops with their ETAs from the driver's position
+func routeETAs(latitude, longitude float64, stops []model.TripStop) []model.TripStop {
+	timed := make([]model.TripStop, len(stops))
+	elapsed := 0.0
+	lat, lng := latitude, longitude
+	for i, stop := range stops {
+		elapsed += util.EstimateETAMinutes(util.HaversineKm(lat, lng, stop.Latitude, stop.Longitude))
+		stop.ETA = elapsed
+		timed[i] = stop
+		lat, lng = stop.Latitude, stop.Longitude
+	}
+	return timed
+}
+
+// routeKm returns the length of the route from the driver through the stops
+func routeKm(latitude, longitude float64, stops []model.TripStop) float64 {
+	total := 0.0
+	lat, lng := latitude, longitude
+	for _, stop := range stops {
+		total += util.HaversineKm(lat, lng, stop.Latitude, stop.Longitude)
+		lat, lng = stop.Latitude, stop.Longitude
+	}
+	return total
+}
+
+func stopKey(stop model.TripStop) string {
+	return stop.Type + "|" + stop.UserID
+}
+
+// bestInsertion tries every pickup and drop-off position for a rider in a
+// trip and returns the feasible one that adds the least driving time
+func bestInsertion(trip model.PooledTrip, pickup, drop model.TripStop, config PoolConfig) (*poolInsertion, bool) {
+	current := routeETAs(trip.Latitude, trip.Longitude, trip.Stops)
+	currentETAs := make(map[string]float64, len(current))
+	currentDuration := 0.0
+	for _, stop := range current {
+		currentETAs[stopKey(stop)] = stop.ETA
+		currentDuration = stop.ETA
+	}
+
+	onBoard := 0
+	for _, rider := range trip.Riders {
+		if rider.PickedUp {
+			onBoard++
+		}
+	}
+
+	directMinutes := util.EstimateETAMinutes(util.HaversineKm(pickup.Latitude, pickup.Longitude, drop.Latitude, drop.Longitude))
+
+	var best *poolInsertion
+	for i := 0; i <= len(trip.Stops); i++ {
+		for j := i; j <= len(trip.Stops); j++ {
+			stops := make([]model.TripStop, 0, len(trip.Stops)+2)
+			stops = append(stops, trip.Stops[:i]...)
+			stops = append(stops, pickup)
+			stops = append(stops, trip.Stops[i:j]...)
+			stops = append(stops, drop)
+			stops = append(stops, trip.Stops[j:]...)
+			stops = routeETAs(trip.Latitude, trip.Longitude, stops)
+
+			insertion, ok := checkInsertion(stops, currentETAs, onBoard, directMinutes, config)
+			if !ok {
+				continue
+			}
+			insertion.addedMinutes = stops[len(stops)-1].ETA - currentDuration
+			if best == nil || insertion.addedMinutes < best.addedMinutes {
+				best = insertion
+			}
+		}
+	}
+
+	return best, best != nil
+}
+
+// checkInsertion validates capacity, the joining rider's wait and ride time
+// and the delay to the stops already on the route
+func checkInsertion(stops []model.TripStop, currentETAs map[string]float64, onBoard int, directMinutes float64, config PoolConfig) (*poolInsertion, bool) {
+	var pickupETA float64
+	maxDelay := 0.0
+
+	for _, stop := range stops {
+		switch stop.Type {
+		case model.StopPickup:
+			onBoard++
+			if onBoard > config.Capacity {
+				return nil, false
+			}
+		case model.StopDrop:
+			onBoard--
+		}
+
+		if previous, ok := currentETAs[stopKey(stop)]; ok {
+			maxDelay = math.Max(maxDelay, stop.ETA-previous)
+			continue
+		}
+
+		// One of the joining rider's own stops
+		if stop.Type == model.StopPickup {
+			pickupETA = stop.ETA
+			if pickupETA > config.MaxWaitMinutes {
+				return nil, false
+			}
+		} else if stop.ETA-pickupETA > directMinutes*(1+config.MaxDetourRatio) {
+			return nil, false
+		}
+	}
+
+	if maxDelay > config.MaxDetourMinutes {
+		return nil, false
+	}
+
+	return &poolInsertion{stops: stops, detourMinutes: maxDelay}, true
+}
+
+// splitFare prices the trip's remaining route and splits it between riders in
+// proportion to the distance each would have travelled alone
+func splitFare(trip *model.PooledTrip, config PoolConfig) {
+	trip.Fare = config.BaseFare + config.PerKmFare*routeKm(trip.Latitude, trip.Longitude, trip.Stops)
+
+	totalDirect := 0.0
+	for _, rider := range trip.Riders {
+		totalDirect += rider.DirectDistanceKm
+	}
+	for i := range trip.Riders {
+		share := 1 / float64(len(trip.Riders))
+		if totalDirect > 0 {
+			share = trip.Riders[i].DirectDistanceKm / totalDirect
+		}
+		trip.Riders[i].Fare = math.Round(trip.Fare*share*100) / 100
+	}
+}
+
+// insertRider places the rider into the trip at its best position
+func insertRider(trip *model.PooledTrip, user model.EnrichedUserLocation, pickup, drop model.TripStop, config PoolConfig) (*poolInsertion, error) {
+	insertion, ok := bestInsertion(*trip, pickup, drop, config)
+	if !ok {
+		return nil, ErrPoolInsertionInfeasible
+	}
+
+	trip.Stops = insertion.stops
+	trip.Riders = append(trip.Riders, model.PoolRider{
+		UserID:           user.UserID,
+		DirectDistanceKm: util.HaversineKm(pickup.Latitude, pickup.Longitude, drop.Latitude, drop.Longitude),
+	})
+	splitFare(trip, config)
+	return insertion, nil
+}
+
+// matchPool matches a pooled ride request into the active trip where it adds
+// the least driving time, or starts a new trip with the nearest driver
+func (s *matchingService) matchPool(ctx context.Context, user model.EnrichedUserLocation) error {
+	if user.DropLatitude == 0 && user.DropLongitude == 0 {
+		return fmt.Errorf("pooled ride request of user %s has no drop-off", user.UserID)
+	}
+
+	pickup := model.TripStop{Type: model.StopPickup, UserID: user.UserID, Latitude: user.Latitude, Longitude: user.Longitude}
+	drop := model.TripStop{Type: model.StopDrop, UserID: user.UserID, Latitude: user.DropLatitude, Longitude: user.DropLongitude}
+
+	var trips []model.PooledTrip
+	for _, city := range s.boundaries.citiesFor(user.City, user.Latitude, user.Longitude) {
+		cityTrips, err := s.pooledTrips.ActiveTrips(ctx, city)
+		if err != nil {
+			return fmt.Errorf("error listing pooled trips in %s: %w", city, err)
+		}
+		trips = append(trips, cityTrips...)
+	}
+
+	var bestTrip *model.PooledTrip
+	var best *poolInsertion
+	for i := range trips {
+		trip := trips[i]
+		if user.VehicleType != "" && trip.VehicleType != user.VehicleType {
+			continue
+		}
+		if insertion, ok := bestInsertion(trip, pickup, drop, s.pool); ok && (best == nil || insertion.addedMinutes < best.addedMinutes) {
+			bestTrip, best = &trip, insertion
+		}
+	}
+
+	if bestTrip != nil {
+		// Re-evaluate on the latest state in case another rider joined meanwhile
+		var insertion *poolInsertion
+		trip, err := s.pooledTrips.Update(ctx, bestTrip.TripID, func(trip *model.PooledTrip) error {
+			var err error
+			insertion, err = insertRider(trip, user, pickup, drop, s.pool)
+			return err
+		})
+		if err == nil {
+			log.Printf("Pooled user %s into trip %s (+%.1f min, max detour %.1f min)",
+				user.UserID, trip.TripID, insertion.addedMinutes, insertion.detourMinutes)
+			// The driver stays reserved for as long as the trip is kept
+			if err := s.reservations.HardReserve(ctx, trip.DriverID, trip.ReservationHolder, s.pool.TripTTL); err != nil {
+				log.Printf("Error extending reservation of driver %s for pooled trip %s: %v", trip.DriverID, trip.TripID, err)
+			}
+			s.deliverPoolMatch(ctx, user, trip, insertion.detourMinutes)
+			return nil
+		}
+		log.Printf("Could not pool user %s into trip %s, starting a new trip: %v", user.UserID, bestTrip.TripID, err)
+	}
+
+	return s.startPooledTrip(ctx, user, pickup, drop)
+}
+
+// startPooledTrip opens a new pooled trip with the best available driver
+func (s *matchingService) startPooledTrip(ctx context.Context, user model.EnrichedUserLocation, pickup, drop model.TripStop) error {
+	drivers, err := s.findDriversForUser(ctx, user)
+	if err != nil {
+		return fmt.Errorf("error finding drivers: %w", err)
+	}
+
+	drivers = s.reserveDrivers(ctx, user, drivers)
+	if len(drivers) == 0 {
+		s.deliverResults(ctx, user, nil, nil)
+		return nil
+	}
+
+	// Only the chosen driver stays reserved, for the whole trip rather than
+	// for an offer, so that no solo rider is offered a driver mid-trip
+	driver := drivers[0]
+	holder := offerHolder(user)
+	if _, err := s.reservations.ReleaseAll(ctx, holder, driver.DriverID); err != nil {
+		log.Printf("Error releasing unused pool candidates of user %s: %v", user.UserID, err)
+	}
+	if err := s.reservations.HardReserve(ctx, driver.DriverID, holder, s.pool.TripTTL); err != nil {
+		log.Printf("Error reserving driver %s for pooled trip of user %s: %v", driver.DriverID, user.UserID, err)
+		s.deliverResults(ctx, user, nil, nil)
+		return nil
+	}
+
+	trip := &model.PooledTrip{
+		DriverID:          driver.DriverID,
+		City:              user.City,
+		VehicleType:       driver.VehicleType,
+		Capacity:          s.pool.Capacity,
+		Latitude:          driver.Latitude,
+		Longitude:         driver.Longitude,
+		ReservationHolder: holder,
+	}
+	if _, err := insertRider(trip, user, pickup, drop, s.pool); err != nil {
+		// The nearest driver is too far for the rider's maximum wait
+		trip.Stops = routeETAs(trip.Latitude, trip.Longitude, []model.TripStop{pickup, drop})
+		trip.Riders = []model.PoolRider{{
+			UserID:           user.UserID,
+			DirectDistanceKm: util.HaversineKm(pickup.Latitude, pickup.Longitude, drop.Latitude, drop.Longitude),
+		}}
+		splitFare(trip, s.pool)
+	}
+
+	if err := s.pooledTrips.Create(ctx, trip); err != nil {
+		releaseTripDriver(ctx, s.reservations, trip)
+		return fmt.Errorf("error creating pooled trip: %w", err)
+	}
+
+	log.Printf("Started pooled trip %s for user %s with driver %s", trip.TripID, user.UserID, driver.DriverID)
+	s.deliverPoolMatch(ctx, user, trip, 0)
+	return nil
+}
+
+// deliverPoolMatch sends the rider their pooled trip, and withdraws the rider
+// from the trip again if the search was cancelled meanwhile
+func (s *matchingService) deliverPoolMatch(ctx context.Context, user model.EnrichedUserLocation, trip *model.PooledTrip, detourMinutes float64) {
+	match := &model.PoolMatch{
+		TripID:        trip.TripID,
+		DriverID:      trip.DriverID,
+		Route:         trip.Stops,
+		Riders:        len(trip.Riders),
+		DetourMinutes: detourMinutes,
+	}
+
+	driver := model.DriverLocation{DriverID: trip.DriverID, VehicleType: trip.VehicleType}
+	for _, rider := range trip.Riders {
+		if rider.UserID == user.UserID {
+			match.Fare = rider.Fare
+		}
+	}
+	for _, stop := range trip.Stops {
+		if stop.Type == model.StopPickup && stop.UserID == user.UserID {
+			driver.ETA = int(math.Ceil(stop.ETA))
+			driver.Distance = util.HaversineKm(trip.Latitude, trip.Longitude, stop.Latitude, stop.Longitude)
+		}
+	}
+
+	if s.deliverResults(ctx, user, []model.DriverLocation{driver}, match) {
+		return
+	}
+
+	updated, err := s.pooledTrips.Update(ctx, trip.TripID, func(trip *model.PooledTrip) error {
+		removeRider(trip, user.UserID)
+		splitFare(trip, s.pool)
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, repository.ErrPooledTripNotFound) {
+			log.Printf("Error removing cancelled user %s from pooled trip %s: %v", user.UserID, trip.TripID, err)
+		}
+		return
+	}
+	if len(updated.Stops) == 0 {
+		releaseTripDriver(ctx, s.reservations, updated)
+	}
+}
+
+// releaseTripDriver frees the driver of a trip that has ended
+func releaseTripDriver(ctx context.Context, reservations repository.ReservationRepository, trip *model.PooledTrip) {
+	if _, err := reservations.Release(ctx, trip.DriverID, trip.ReservationHolder); err != nil {
+		log.Printf("Error releasing driver %s of pooled trip %s: %v", trip.DriverID, trip.TripID, err)
+	}
+}
+
+// removeRider drops a rider and their remaining stops from a trip
+func removeRider(trip *model.PooledTrip, userID string) {
+	var stops []model.TripStop
+	for _, stop := range trip.Stops {
+		if stop.UserID != userID {
+			stops = append(stops, stop)
+		}
+	}
+	trip.Stops = stops
+
+	var riders []model.PoolRider
+	for _, rider := range trip.Riders {
+		if rider.UserID != userID {
+			riders = append(riders, rider)
+		}
+	}
+	trip.Riders = riders
+}
+
+// PoolTripService lets drivers progress their pooled trips
+type PoolTripService interface {
+	// CompleteStop marks the trip's next stop as served by its driver
+	CompleteStop(ctx context.Context, driverID, tripID string) (*model.PooledTrip, error)
+}
+
+type poolTripService struct {
+	pooledTrips  repository.PooledTripRepository
+	reservations repository.ReservationRepository
+}
+
+// NewPoolTripService creates a new pooled trip service
+func NewPoolTripService(pooledTrips repository.PooledTripRepository, reservations repository.ReservationRepository) PoolTripService {
+	return &poolTripService{
+		pooledTrips:  pooledTrips,
+		reservations: reservations,
+	}
+}
+
+// CompleteStop moves the driver to the next stop, boarding or dropping its
+// rider. The driver is released once the last stop is served.
+func (s *poolTripService) CompleteStop(ctx context.Context, driverID, tripID string) (*model.PooledTrip, error) {
+	trip, err := s.pooledTrips.Update(ctx, tripID, func(trip *model.PooledTrip) error {
+		if trip.DriverID != driverID {
+			return ErrNotTripDriver
+		}
+		if len(trip.Stops) == 0 {
+			return nil
+		}
+
+		stop := trip.Stops[0]
+		trip.Stops = trip.Stops[1:]
+		trip.Latitude, trip.Longitude = stop.Latitude, stop.Longitude
+
+		var riders []model.PoolRider
+		for _, rider := range trip.Riders {
+			if rider.UserID == stop.UserID {
+				if stop.Type == model.StopDrop {
+					continue
+				}
+				rider.PickedUp = true
+			}
+			riders = append(riders, rider)
+		}
+		trip.Riders = riders
+		trip.Stops = routeETAs(trip.Latitude, trip.Longitude, trip.Stops)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(trip.Stops) == 0 {
+		releaseTripDriver(ctx, s.reservations, trip)
+	}
+	return trip, nil
+}
@@ -0,0 +1,315 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+
+	"matching-service/internal/model"
+	"matching-service/internal/repository"
+)
+
+// testPoolConfig is the pool config the tests vary
+var testPoolConfig = PoolConfig{
+	Capacity:         3,
+	MaxWaitMinutes:   8,
+	MaxDetourMinutes: 10,
+	MaxDetourRatio:   0.5,
+	BaseFare:         30,
+	PerKmFare:        8,
+}
+
+// testTrip is a trip whose driver is about 1km south of rider u1's pickup,
+// with u1 riding about 4km further north. Every hundredth of a degree north
+// takes about 3.3 minutes.
+func testTrip() model.PooledTrip {
+	return model.PooledTrip{
+		TripID:    "t1",
+		DriverID:  "d1",
+		Capacity:  3,
+		Latitude:  18.50,
+		Longitude: 73.80,
+		Stops: routeETAs(18.50, 73.80, []model.TripStop{
+			{Type: model.StopPickup, UserID: "u1", Latitude: 18.51, Longitude: 73.80},
+			{Type: model.StopDrop, UserID: "u1", Latitude: 18.55, Longitude: 73.80},
+		}),
+		Riders: []model.PoolRider{{UserID: "u1", DirectDistanceKm: 4.45}},
+	}
+}
+
+func TestInsertRider(t *testing.T) {
+	tests := []struct {
+		name string
+		// configure adjusts testPoolConfig for the case
+		configure func(config *PoolConfig)
+		pickup    [2]float64
+		drop      [2]float64
+		wantErr   error
+		wantStops []string
+	}{
+		{
+			name:      "on the way",
+			pickup:    [2]float64{18.52, 73.80},
+			drop:      [2]float64{18.54, 73.80},
+			wantStops: []string{"PICKUP u1", "PICKUP u2", "DROP u2", "DROP u1"},
+		},
+		{
+			name:      "capacity reached",
+			configure: func(config *PoolConfig) { config.Capacity = 1 },
+			pickup:    [2]float64{18.52, 73.80},
+			drop:      [2]float64{18.54, 73.80},
+			wantErr:   ErrPoolInsertionInfeasible,
+		},
+		{
+			name:      "after the trip within the wait limit",
+			configure: func(config *PoolConfig) { config.MaxWaitMinutes = 40 },
+			pickup:    [2]float64{18.60, 73.80},
+			drop:      [2]float64{18.62, 73.80},
+			wantStops: []string{"PICKUP u1", "DROP u1", "PICKUP u2", "DROP u2"},
+		},
+		{
+			name:    "over the wait limit",
+			pickup:  [2]float64{18.60, 73.80},
+			drop:    [2]float64{18.62, 73.80},
+			wantErr: ErrPoolInsertionInfeasible,
+		},
+		{
+			name: "off the route within the detour limit",
+			configure: func(config *PoolConfig) {
+				config.MaxWaitMinutes = 20
+				config.MaxDetourMinutes = 15
+			},
+			pickup:    [2]float64{18.52, 73.83},
+			drop:      [2]float64{18.53, 73.83},
+			wantStops: []string{"PICKUP u1", "PICKUP u2", "DROP u2", "DROP u1"},
+		},
+		{
+			name:      "off the route over the detour limit",
+			configure: func(config *PoolConfig) { config.MaxWaitMinutes = 20 },
+			pickup:    [2]float64{18.52, 73.83},
+			drop:      [2]float64{18.53, 73.83},
+			wantErr:   ErrPoolInsertionInfeasible,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testPoolConfig
+			if tt.configure != nil {
+				tt.configure(&config)
+			}
+			trip := testTrip()
+			user := model.EnrichedUserLocation{UserLocation: model.UserLocation{UserID: "u2"}}
+			pickup := model.TripStop{Type: model.StopPickup, UserID: "u2", Latitude: tt.pickup[0], Longitude: tt.pickup[1]}
+			drop := model.TripStop{Type: model.StopDrop, UserID: "u2", Latitude: tt.drop[0], Longitude: tt.drop[1]}
+
+			insertion, err := insertRider(&trip, user, pickup, drop, config)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("insertRider error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if len(trip.Stops) != 2 || len(trip.Riders) != 1 {
+					t.Errorf("rejected rider changed the trip: %d stops, %d riders", len(trip.Stops), len(trip.Riders))
+				}
+				return
+			}
+
+			var stops []string
+			for _, stop := range trip.Stops {
+				stops = append(stops, stop.Type+" "+stop.UserID)
+			}
+			if len(stops) != len(tt.wantStops) {
+				t.Fatalf("stops = %v, want %v", stops, tt.wantStops)
+			}
+			for i := range stops {
+				if stops[i] != tt.wantStops[i] {
+					t.Fatalf("stops = %v, want %v", stops, tt.wantStops)
+				}
+			}
+			if len(trip.Riders) != 2 || trip.Riders[1].UserID != "u2" {
+				t.Errorf("riders = %+v, want u1 and u2", trip.Riders)
+			}
+			if insertion.detourMinutes > config.MaxDetourMinutes {
+				t.Errorf("detour = %.1f min, over the limit of %.1f", insertion.detourMinutes, config.MaxDetourMinutes)
+			}
+		})
+	}
+}
+
+func TestSplitFare(t *testing.T) {
+	tests := []struct {
+		name       string
+		distances  []float64
+		wantShares []float64
+	}{
+		{name: "one rider", distances: []float64{4}, wantShares: []float64{1}},
+		{name: "equal rides", distances: []float64{3, 3}, wantShares: []float64{0.5, 0.5}},
+		{name: "longer ride pays more", distances: []float64{1, 3}, wantShares: []float64{0.25, 0.75}},
+		{name: "three riders", distances: []float64{1, 1, 1}, wantShares: []float64{1.0 / 3, 1.0 / 3, 1.0 / 3}},
+		{name: "no distances", distances: []float64{0, 0}, wantShares: []float64{0.5, 0.5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trip := testTrip()
+			trip.Riders = nil
+			for i, distance := range tt.distances {
+				trip.Riders = append(trip.Riders, model.PoolRider{UserID: string(rune('a' + i)), DirectDistanceKm: distance})
+			}
+
+			splitFare(&trip, testPoolConfig)
+
+			wantFare := testPoolConfig.BaseFare + testPoolConfig.PerKmFare*routeKm(trip.Latitude, trip.Longitude, trip.Stops)
+			if math.Abs(trip.Fare-wantFare) > 1e-9 {
+				t.Errorf("fare = %v, want %v", trip.Fare, wantFare)
+			}
+
+			total := 0.0
+			for i, rider := range trip.Riders {
+				total += rider.Fare
+				if math.Abs(rider.Fare-trip.Fare*tt.wantShares[i]) > 0.005 {
+					t.Errorf("rider %s fare = %v, want %v", rider.UserID, rider.Fare, trip.Fare*tt.wantShares[i])
+				}
+			}
+			// Each share is rounded to the cent
+			if math.Abs(total-trip.Fare) > 0.005*float64(len(trip.Riders)) {
+				t.Errorf("rider fares add up to %v, want the trip fare %v", total, trip.Fare)
+			}
+		})
+	}
+}
+
+func TestRemoveRider(t *testing.T) {
+	stop := func(stopType, userID string) model.TripStop {
+		return model.TripStop{Type: stopType, UserID: userID}
+	}
+	trip := func() model.PooledTrip {
+		return model.PooledTrip{
+			Stops: []model.TripStop{
+				stop(model.StopPickup, "u1"),
+				stop(model.StopPickup, "u2"),
+				stop(model.StopDrop, "u1"),
+				stop(model.StopPickup, "u3"),
+				stop(model.StopDrop, "u2"),
+				stop(model.StopDrop, "u3"),
+			},
+			Riders: []model.PoolRider{{UserID: "u1"}, {UserID: "u2"}, {UserID: "u3"}},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		userID     string
+		wantStops  []string
+		wantRiders []string
+	}{
+		{
+			name:       "middle rider",
+			userID:     "u2",
+			wantStops:  []string{"PICKUP u1", "DROP u1", "PICKUP u3", "DROP u3"},
+			wantRiders: []string{"u1", "u3"},
+		},
+		{
+			name:       "first rider",
+			userID:     "u1",
+			wantStops:  []string{"PICKUP u2", "PICKUP u3", "DROP u2", "DROP u3"},
+			wantRiders: []string{"u2", "u3"},
+		},
+		{
+			name:       "unknown rider",
+			userID:     "u9",
+			wantStops:  []string{"PICKUP u1", "PICKUP u2", "DROP u1", "PICKUP u3", "DROP u2", "DROP u3"},
+			wantRiders: []string{"u1", "u2", "u3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trip := trip()
+			removeRider(&trip, tt.userID)
+
+			var stops, riders []string
+			for _, stop := range trip.Stops {
+				stops = append(stops, stop.Type+" "+stop.UserID)
+			}
+			for _, rider := range trip.Riders {
+				riders = append(riders, rider.UserID)
+			}
+			if len(stops) != len(tt.wantStops) || len(riders) != len(tt.wantRiders) {
+				t.Fatalf("stops %v and riders %v, want %v and %v", stops, riders, tt.wantStops, tt.wantRiders)
+			}
+			for i := range stops {
+				if stops[i] != tt.wantStops[i] {
+					t.Fatalf("stops = %v, want %v", stops, tt.wantStops)
+				}
+			}
+			for i := range riders {
+				if riders[i] != tt.wantRiders[i] {
+					t.Fatalf("riders = %v, want %v", riders, tt.wantRiders)
+				}
+			}
+		})
+	}
+}
+
+func TestCompleteStopReleasesDriverAfterLastStop(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	pooledTrips := repository.NewPooledTripRepository(client, time.Hour)
+	reservations := repository.NewReservationRepository(client)
+	tripService := NewPoolTripService(pooledTrips, reservations)
+
+	if _, err := reservations.SoftReserve(ctx, "d1", "s1", time.Minute); err != nil {
+		t.Fatalf("SoftReserve: %v", err)
+	}
+	if err := reservations.HardReserve(ctx, "d1", "s1", time.Hour); err != nil {
+		t.Fatalf("HardReserve: %v", err)
+	}
+	trip := &model.PooledTrip{
+		DriverID: "d1",
+		City:     "pune",
+		Stops: []model.TripStop{
+			{Type: model.StopPickup, UserID: "u1", Latitude: 18.52, Longitude: 73.85},
+			{Type: model.StopDrop, UserID: "u1", Latitude: 18.56, Longitude: 73.91},
+		},
+		Riders:            []model.PoolRider{{UserID: "u1"}},
+		ReservationHolder: "s1",
+	}
+	if err := pooledTrips.Create(ctx, trip); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// reserved reports whether the driver is kept from other riders
+	reserved := func() bool {
+		t.Helper()
+		others, err := reservations.ReservedByOthers(ctx, []string{"d1"}, "another-search")
+		if err != nil {
+			t.Fatalf("ReservedByOthers: %v", err)
+		}
+		return others["d1"]
+	}
+
+	// Past the offer's lease the driver is still reserved for the trip
+	server.FastForward(2 * time.Minute)
+	if _, err := tripService.CompleteStop(ctx, "d1", trip.TripID); err != nil {
+		t.Fatalf("CompleteStop: %v", err)
+	}
+	if !reserved() {
+		t.Fatalf("driver released with a stop left")
+	}
+
+	if _, err := tripService.CompleteStop(ctx, "d1", trip.TripID); err != nil {
+		t.Fatalf("CompleteStop: %v", err)
+	}
+	if reserved() {
+		t.Errorf("driver still reserved after the last stop")
+	}
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"matching-service/internal/model"
+	"matching-service/internal/util"
+)
+
+// RankingStrategy orders candidate drivers for a rider, best first, and
+// attaches the score breakdown to each driver
+type RankingStrategy interface {
+	Name() string
+	Rank(user model.EnrichedUserLocation, drivers []model.DriverLocation) []model.DriverLocation
+}
+
+// RankingWeights are the weights of the signals combined into a driver's score
+type RankingWeights struct {
+	ETA        float64 `json:"eta"`
+	Rating     float64 `json:"rating"`
+	Acceptance float64 `json:"acceptance"`
+	Idle       float64 `json:"idle"`
+	Vehicle    float64 `json:"vehicle"`
+	Preference float64 `json:"preference"`
+}
+
+const (
+	// maxScoredETAMinutes is the ETA at which the ETA signal bottoms out
+	maxScoredETAMinutes = 30.0
+	// maxScoredIdleMinutes is the idle time at which the fairness signal saturates
+	maxScoredIdleMinutes = 60.0
+	// neutralSignal is used for signals a driver has no data for yet
+	neutralSignal = 0.5
+)
+
+// DefaultRankingStrategies are available to every city without configuration
+var DefaultRankingStrategies = map[string]RankingWeights{
+	"nearest":  {ETA: 1, Preference: 0.1},
+	"balanced": {ETA: 0.5, Rating: 0.2, Acceptance: 0.15, Idle: 0.1, Vehicle: 0.05, Preference: 0.1},
+	"fairness": {ETA: 0.4, Rating: 0.1, Acceptance: 0.1, Idle: 0.35, Vehicle: 0.05, Preference: 0.1},
+}
+
+type weightedRankingStrategy struct {
+	name    string
+	weights RankingWeights
+	now     func() time.Time
+}
+
+// NewWeightedRankingStrategy creates a strategy that ranks drivers by the
+// weighted sum of their normalised signals
+func NewWeightedRankingStrategy(name string, weights RankingWeights) RankingStrategy {
+	return &weightedRankingStrategy{
+		name:    name,
+		weights: weights,
+		now:     time.Now,
+	}
+}
+
+func (r *weightedRankingStrategy) Name() string {
+	return r.name
+}
+
+// Rank computes distance, ETA and score for every driver and sorts by score
+func (r *weightedRankingStrategy) Rank(user model.EnrichedUserLocation, drivers []model.DriverLocation) []model.DriverLocation {
+	now := r.now()
+
+	for i := range drivers {
+		driver := &drivers[i]
+		driver.Distance = util.HaversineKm(user.Latitude, user.Longitude, driver.Latitude, driver.Longitude)
+		etaMinutes := util.EstimateETAMinutes(driver.Distance)
+		driver.ETA = int(math.Ceil(etaMinutes))
+
+		score := &model.ScoreBreakdown{
+			Strategy:   r.name,
+			ETA:        r.weights.ETA * (1 - math.Min(etaMinutes/maxScoredETAMinutes, 1)),
+			Rating:     r.weights.Rating * ratingSignal(driver.Rating),
+			Acceptance: r.weights.Acceptance * acceptanceSignal(driver.AcceptanceRate),
+			Idle:       r.weights.Idle * idleSignal(driver.LastTripAt, now),
+			Vehicle:    r.weights.Vehicle * vehicleSignal(user.VehicleType, driver.VehicleType),
+			Preference: r.weights.Preference * preferenceSignal(user.Preferences, *driver),
+		}
+		score.Total = score.ETA + score.Rating + score.Acceptance + score.Idle + score.Vehicle + score.Preference
+		driver.Score = score
+	}
+
+	sort.SliceStable(drivers, func(i, j int) bool {
+		if drivers[i].Score.Total != drivers[j].Score.Total {
+			return drivers[i].Score.Total > drivers[j].Score.Total
+		}
+		return drivers[i].Distance < drivers[j].Distance
+	})
+
+	return drivers
+}
+
+// ratingSignal maps a 1-5 star rating to [0, 1]
+func ratingSignal(rating float64) float64 {
+	if rating <= 0 {
+		return neutralSignal
+	}
+	return math.Max(0, math.Min((rating-1)/4, 1))
+}
+
+func acceptanceSignal(rate float64) float64 {
+	if rate <= 0 {
+		return neutralSignal
+	}
+	return math.Min(rate, 1)
+}
+
+// idleSignal favours drivers who have waited longest since their last trip
+func idleSignal(lastTripAt int64, now time.Time) float64 {
+	if lastTripAt <= 0 {
+		return neutralSignal
+	}
+	idleMinutes := now.Sub(time.Unix(lastTripAt, 0)).Minutes()
+	return math.Max(0, math.Min(idleMinutes/maxScoredIdleMinutes, 1))
+}
+
+func vehicleSignal(requested, actual string) float64 {
+	if requested == "" || requested == actual {
+		return 1
+	}
+	return 0
+}
+
+// rankingStrategies selects the ranking strategy for a city
+type rankingStrategies struct {
+	byName   map[string]RankingStrategy
+	byCity   map[string]RankingStrategy
+	fallback RankingStrategy
+}
+
+func (r *rankingStrategies) forCity(city string) RankingStrategy {
+	if strategy, ok := r.byCity[city]; ok {
+		return strategy
+	}
+	return r.fallback
+}
+
+// named returns a strategy by name, e.g. for an experiment arm
+func (r *rankingStrategies) named(name string) (RankingStrategy, bool) {
+	strategy, ok := r.byName[name]
+	return strategy, ok
+}
+
+// RankingConfig selects a strategy per city. Strategies extends or overrides
+// DefaultRankingStrategies.
+type RankingConfig struct {
+	DefaultStrategy string
+	CityStrategies  map[string]string
+	Strategies      map[string]RankingWeights
+}
+
+func newRankingStrategies(config RankingConfig, now func() time.Time) *rankingStrategies {
+	weights := make(map[string]RankingWeights)
+	for name, w := range DefaultRankingStrategies {
+		weights[name] = w
+	}
+	for name, w := range config.Strategies {
+		weights[name] = w
+	}
+
+	lookup := func(name string) RankingStrategy {
+		w, ok := weights[name]
+		if !ok {
+			log.Printf("Warning: Unknown ranking strategy %q, using nearest", name)
+			name, w = "nearest", weights["nearest"]
+		}
+		return &weightedRankingStrategy{name: name, weights: w, now: now}
+	}
+
+	strategies := &rankingStrategies{
+		byName:   make(map[string]RankingStrategy, len(weights)),
+		byCity:   make(map[string]RankingStrategy),
+		fallback: lookup(config.DefaultStrategy),
+	}
+	for name, w := range weights {
+		strategies.byName[name] = &weightedRankingStrategy{name: name, weights: w, now: now}
+	}
+	for city, name := range config.CityStrategies {
+		strategies.byCity[city] = lookup(name)
+	}
+
+	return strategies
+}
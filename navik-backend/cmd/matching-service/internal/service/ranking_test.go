@@ -0,0 +1,194 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"matching-service/internal/model"
+)
+
+func TestRankingSignals(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{name: "unrated", got: ratingSignal(0), want: neutralSignal},
+		{name: "one star", got: ratingSignal(1), want: 0},
+		{name: "three stars", got: ratingSignal(3), want: 0.5},
+		{name: "five stars", got: ratingSignal(5), want: 1},
+		{name: "no answered offers", got: acceptanceSignal(0), want: neutralSignal},
+		{name: "acceptance rate", got: acceptanceSignal(0.8), want: 0.8},
+		{name: "acceptance rate capped", got: acceptanceSignal(1.5), want: 1},
+		{name: "no trips", got: idleSignal(0, now), want: neutralSignal},
+		{name: "just finished a trip", got: idleSignal(now.Unix(), now), want: 0},
+		{name: "idle half an hour", got: idleSignal(now.Add(-30*time.Minute).Unix(), now), want: 0.5},
+		{name: "idle over an hour", got: idleSignal(now.Add(-3*time.Hour).Unix(), now), want: 1},
+		{name: "trip in the future", got: idleSignal(now.Add(time.Minute).Unix(), now), want: 0},
+		{name: "any vehicle", got: vehicleSignal("", "auto"), want: 1},
+		{name: "requested vehicle", got: vehicleSignal("sedan", "sedan"), want: 1},
+		{name: "other vehicle", got: vehicleSignal("sedan", "auto"), want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if math.Abs(tt.got-tt.want) > 1e-9 {
+				t.Errorf("signal = %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightedRankingOrder(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	user := model.EnrichedUserLocation{UserLocation: model.UserLocation{Latitude: 19.0, Longitude: 72.8}}
+
+	// driverAt places a driver the given number of hundredths of a degree
+	// north of the rider, about 1.1km each
+	driverAt := func(id string, hundredths float64) model.DriverLocation {
+		return model.DriverLocation{DriverID: id, Latitude: 19.0 + hundredths/100, Longitude: 72.8, VehicleType: "auto"}
+	}
+	withStats := func(driver model.DriverLocation, rating, acceptance float64, idle time.Duration) model.DriverLocation {
+		driver.Rating = rating
+		driver.AcceptanceRate = acceptance
+		if idle > 0 {
+			driver.LastTripAt = now.Add(-idle).Unix()
+		}
+		return driver
+	}
+
+	tests := []struct {
+		name        string
+		weights     RankingWeights
+		vehicleType string
+		drivers     []model.DriverLocation
+		want        []string
+	}{
+		{
+			name:    "nearest first",
+			weights: DefaultRankingStrategies["nearest"],
+			drivers: []model.DriverLocation{driverAt("far", 5), driverAt("near", 1), driverAt("mid", 3)},
+			want:    []string{"near", "mid", "far"},
+		},
+		{
+			name:    "distance breaks ties",
+			weights: RankingWeights{},
+			drivers: []model.DriverLocation{driverAt("far", 2), driverAt("near", 1)},
+			want:    []string{"near", "far"},
+		},
+		{
+			name:    "higher rating first",
+			weights: RankingWeights{ETA: 0.1, Rating: 1},
+			drivers: []model.DriverLocation{
+				withStats(driverAt("three", 1), 3, 0, 0),
+				withStats(driverAt("five", 2), 5, 0, 0),
+			},
+			want: []string{"five", "three"},
+		},
+		{
+			name:    "unrated between low and high ratings",
+			weights: RankingWeights{Rating: 1},
+			drivers: []model.DriverLocation{
+				withStats(driverAt("two", 1), 2, 0, 0),
+				driverAt("unrated", 2),
+				withStats(driverAt("four", 3), 4, 0, 0),
+			},
+			want: []string{"four", "unrated", "two"},
+		},
+		{
+			name:    "higher acceptance first",
+			weights: RankingWeights{Acceptance: 1},
+			drivers: []model.DriverLocation{
+				withStats(driverAt("low", 1), 0, 0.2, 0),
+				driverAt("unanswered", 2),
+				withStats(driverAt("high", 3), 0, 0.9, 0),
+			},
+			want: []string{"high", "unanswered", "low"},
+		},
+		{
+			name:    "fairness favours longest idle",
+			weights: DefaultRankingStrategies["fairness"],
+			drivers: []model.DriverLocation{
+				withStats(driverAt("busy", 1), 0, 0, time.Minute),
+				withStats(driverAt("idle", 1), 0, 0, time.Hour),
+			},
+			want: []string{"idle", "busy"},
+		},
+		{
+			name:        "requested vehicle first",
+			weights:     RankingWeights{ETA: 0.1, Vehicle: 1},
+			vehicleType: "sedan",
+			drivers: []model.DriverLocation{
+				driverAt("auto", 1),
+				{DriverID: "sedan", Latitude: 19.05, Longitude: 72.8, VehicleType: "sedan"},
+			},
+			want: []string{"sedan", "auto"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy := &weightedRankingStrategy{name: "test", weights: tt.weights, now: func() time.Time { return now }}
+			rider := user
+			rider.VehicleType = tt.vehicleType
+
+			ranked := strategy.Rank(rider, tt.drivers)
+			if len(ranked) != len(tt.want) {
+				t.Fatalf("ranked %d drivers, want %d", len(ranked), len(tt.want))
+			}
+			for i, driver := range ranked {
+				if driver.DriverID != tt.want[i] {
+					t.Errorf("rank %d = %s, want %s", i, driver.DriverID, tt.want[i])
+				}
+
+				score := driver.Score
+				if score == nil || score.Strategy != "test" {
+					t.Fatalf("driver %s score = %+v, want strategy test", driver.DriverID, score)
+				}
+				sum := score.ETA + score.Rating + score.Acceptance + score.Idle + score.Vehicle + score.Preference
+				if math.Abs(score.Total-sum) > 1e-9 {
+					t.Errorf("driver %s total = %v, want sum of signals %v", driver.DriverID, score.Total, sum)
+				}
+				if driver.Distance <= 0 || driver.ETA <= 0 {
+					t.Errorf("driver %s distance %v and ETA %d not set", driver.DriverID, driver.Distance, driver.ETA)
+				}
+			}
+		})
+	}
+}
+
+func TestRankingStrategiesForCity(t *testing.T) {
+	strategies := newRankingStrategies(RankingConfig{
+		DefaultStrategy: "balanced",
+		CityStrategies:  map[string]string{"pune": "fairness", "delhi": "custom", "goa": "unknown"},
+		Strategies:      map[string]RankingWeights{"custom": {ETA: 0.2, Rating: 0.8}},
+	}, time.Now)
+
+	tests := []struct {
+		city string
+		want string
+	}{
+		{city: "mumbai", want: "balanced"},
+		{city: "pune", want: "fairness"},
+		{city: "delhi", want: "custom"},
+		{city: "goa", want: "nearest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.city, func(t *testing.T) {
+			if got := strategies.forCity(tt.city).Name(); got != tt.want {
+				t.Errorf("forCity(%s) = %s, want %s", tt.city, got, tt.want)
+			}
+		})
+	}
+
+	if _, ok := strategies.named("custom"); !ok {
+		t.Errorf("configured strategy custom not available by name")
+	}
+	if _, ok := strategies.named("unknown"); ok {
+		t.Errorf("unknown strategy available by name")
+	}
+}
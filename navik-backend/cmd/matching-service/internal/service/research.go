@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"matching-service/internal/model"
+)
+
+// ResearchConfig controls the background re-search of riders for whom no
+// driver was found
+type ResearchConfig struct {
+	Enabled bool
+	// Window is how long a session keeps searching before giving up
+	Window time.Duration
+	// InitialInterval is the wait after the first retry; each later wait is
+	// multiplied by IntervalFactor but never drops below MinInterval
+	InitialInterval time.Duration
+	MinInterval     time.Duration
+	IntervalFactor  float64
+	// MaxKRing caps how far the H7 ring around the rider grows
+	MaxKRing int
+}
+
+// researchSession is the background search of one rider
+type researchSession struct {
+	user   model.EnrichedUserLocation
+	cancel context.CancelFunc
+}
+
+// startResearch starts a session for the user, replacing any running one
+func (s *matchingService) startResearch(user model.EnrichedUserLocation) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.research.Window)
+	session := &researchSession{user: user, cancel: cancel}
+
+	s.sessionsMu.Lock()
+	if previous, ok := s.sessions[user.UserID]; ok {
+		previous.cancel()
+	}
+	s.sessions[user.UserID] = session
+	s.sessionsMu.Unlock()
+
+	log.Printf("No drivers for user %s, re-searching for up to %v", user.UserID, s.research.Window)
+	go s.runResearch(ctx, session)
+}
+
+// stopResearch stops the user's running session, if any
+func (s *matchingService) stopResearch(userID string) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+
+	if session, ok := s.sessions[userID]; ok {
+		session.cancel()
+		delete(s.sessions, userID)
+	}
+}
+
+// endResearch removes a session that has finished on its own
+func (s *matchingService) endResearch(session *researchSession) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+
+	if s.sessions[session.user.UserID] == session {
+		delete(s.sessions, session.user.UserID)
+	}
+	session.cancel()
+}
+
+// runResearch retries the search with a widening radius and a shortening
+// interval until a driver is reserved, the rider cancels or the window ends
+func (s *matchingService) runResearch(ctx context.Context, session *researchSession) {
+	defer s.endResearch(session)
+
+	user := session.user
+	basePlan := s.searchPlanFor(user)
+	interval := s.research.InitialInterval
+
+	for attempt := 1; ; attempt++ {
+		if s.searchCancelled(ctx, user) {
+			return
+		}
+
+		plan := widenSearchPlan(basePlan, attempt, s.research.MaxKRing)
+		drivers, busy, err := s.findDrivers(ctx, user, plan)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Re-search attempt %d for user %s failed: %v", attempt, user.UserID, err)
+		}
+
+		if len(drivers) > 0 && ctx.Err() == nil && !s.searchCancelled(ctx, user) {
+			drivers = s.reserveDrivers(ctx, user, drivers)
+			if len(drivers) > 0 {
+				log.Printf("Re-search attempt %d found %d drivers for user %s", attempt, len(drivers), user.UserID)
+				s.deliverResults(context.Background(), user, drivers, nil)
+				return
+			}
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+		s.publishProgress(ctx, user, attempt, busy)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(interval):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		interval = time.Duration(float64(interval) * s.research.IntervalFactor)
+		if interval < s.research.MinInterval {
+			interval = s.research.MinInterval
+		}
+	}
+
+	// Only a session that ran out of time reports the definitive failure; a
+	// replaced session leaves that to its successor
+	if ctx.Err() == context.DeadlineExceeded && !s.searchCancelled(context.Background(), user) {
+		log.Printf("Re-search window for user %s ended without drivers", user.UserID)
+		s.deliverResults(context.Background(), user, nil, nil)
+	}
+}
+
+// widenSearchPlan appends ever larger H7 rings to a plan so that each attempt
+// reaches further than the last
+func widenSearchPlan(plan SearchPlan, attempt, maxKRing int) SearchPlan {
+	kRing := attempt
+	if kRing > maxKRing {
+		kRing = maxKRing
+	}
+
+	widened := SearchPlan{
+		Name:  fmt.Sprintf("%s+research%d", plan.Name, attempt),
+		Steps: append([]SearchStep{}, plan.Steps...),
+	}
+	for k := 1; k <= kRing; k++ {
+		widened.Steps = append(widened.Steps, SearchStep{Resolution: 7, KRing: k})
+	}
+	return widened
+}
+
+// publishProgress tells the rider that the search is still running
+func (s *matchingService) publishProgress(ctx context.Context, user model.EnrichedUserLocation, attempt, busy int) {
+	message := "Still searching for drivers nearby"
+	if busy > 0 {
+		message = fmt.Sprintf("Still searching, %d drivers nearby but busy", busy)
+	}
+
+	progress := map[string]interface{}{
+		"search_id":    user.SearchID,
+		"user_id":      user.UserID,
+		"status":       model.SearchStatusSearching,
+		"attempt":      attempt,
+		"busy_drivers": busy,
+		"message":      message,
+		"request_time": s.now().Unix(),
+	}
+	s.tagExperiment(user, progress)
+
+	data, err := json.Marshal(progress)
+	if err != nil {
+		log.Printf("Error marshaling search progress: %v", err)
+		return
+	}
+
+	if _, err := s.matchStream.Publish(ctx, user.UserID, data); err != nil {
+		log.Printf("Error publishing search progress for user %s: %v", user.UserID, err)
+	}
+}
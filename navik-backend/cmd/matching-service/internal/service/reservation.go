@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"matching-service/internal/model"
+	"matching-service/internal/repository"
+)
+
+// ErrOfferUnavailable is returned when responding to an offer of a search
+// that was cancelled or found no drivers
+var ErrOfferUnavailable = errors.New("search is no longer taking offers")
+
+// ReservationService handles a driver's response to an offer
+type ReservationService interface {
+	AcceptOffer(ctx context.Context, driverID, searchID string) error
+	DeclineOffer(ctx context.Context, driverID, searchID string) error
+}
+
+type reservationService struct {
+	reservations  repository.ReservationRepository
+	matchStream   repository.MatchStreamRepository
+	searches      repository.SearchRepository
+	driverStats   repository.DriverStatsRepository
+	events        EventPublisher
+	assignmentTTL time.Duration
+}
+
+// NewReservationService creates a new reservation service
+func NewReservationService(reservations repository.ReservationRepository, matchStream repository.MatchStreamRepository, searches repository.SearchRepository, driverStats repository.DriverStatsRepository, events EventPublisher, assignmentTTL time.Duration) ReservationService {
+	return &reservationService{
+		reservations:  reservations,
+		matchStream:   matchStream,
+		searches:      searches,
+		driverStats:   driverStats,
+		events:        events,
+		assignmentTTL: assignmentTTL,
+	}
+}
+
+// offerHolder is who the offers of a search are leased to. Requests without
+// a search, such as replayed ones, lease their offers to the rider.
+func offerHolder(user model.EnrichedUserLocation) string {
+	if user.SearchID != "" {
+		return user.SearchID
+	}
+	return user.UserID
+}
+
+// AcceptOffer turns the driver's soft reservation for the search into an
+// assignment and releases the other drivers offered for it
+func (s *reservationService) AcceptOffer(ctx context.Context, driverID, searchID string) error {
+	if _, err := s.openSearch(ctx, searchID); err != nil {
+		return err
+	}
+
+	if err := s.reservations.HardReserve(ctx, driverID, searchID, s.assignmentTTL); err != nil {
+		return err
+	}
+
+	// A cancellation between the check and the assignment released the
+	// other offers but not this one, so check again and back out
+	search, err := s.openSearch(ctx, searchID)
+	if err != nil {
+		if _, releaseErr := s.reservations.Release(ctx, driverID, searchID); releaseErr != nil {
+			log.Printf("Error releasing driver %s from closed search %s: %v", driverID, searchID, releaseErr)
+		}
+		return err
+	}
+
+	// Two drivers may both hold an assignment if they accepted at once; the
+	// search records only the first, and the other backs out
+	if err := s.searches.Assign(ctx, searchID, driverID); err != nil {
+		if _, releaseErr := s.reservations.Release(ctx, driverID, searchID); releaseErr != nil {
+			log.Printf("Error releasing driver %s from search %s: %v", driverID, searchID, releaseErr)
+		}
+		if errors.Is(err, repository.ErrSearchCancelled) {
+			return ErrOfferUnavailable
+		}
+		return err
+	}
+
+	if _, err := s.reservations.ReleaseAll(ctx, searchID, driverID); err != nil {
+		log.Printf("Error releasing other offers of search %s: %v", searchID, err)
+	}
+	s.recordResponse(ctx, driverID, true)
+
+	s.notify(ctx, search.UserID, "DRIVER_ASSIGNED", driverID)
+	s.publishEvent(model.EventOfferAccepted, driverID, search)
+	return nil
+}
+
+// DeclineOffer releases the driver's reservation for the search. It fails
+// with ErrOfferNotFound if the driver holds no offer of the search, so only
+// a driver who was offered the search can decline it.
+func (s *reservationService) DeclineOffer(ctx context.Context, driverID, searchID string) error {
+	search, err := s.searches.Get(ctx, searchID)
+	if err != nil {
+		return err
+	}
+
+	released, err := s.reservations.Release(ctx, driverID, searchID)
+	if err != nil {
+		return err
+	}
+	if !released {
+		return repository.ErrOfferNotFound
+	}
+	s.recordResponse(ctx, driverID, false)
+
+	s.notify(ctx, search.UserID, "OFFER_DECLINED", driverID)
+	s.publishEvent(model.EventOfferDeclined, driverID, search)
+	return nil
+}
+
+// openSearch returns the search if its offers can still be accepted
+func (s *reservationService) openSearch(ctx context.Context, searchID string) (*model.Search, error) {
+	search, err := s.searches.Get(ctx, searchID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch search.Status {
+	case model.SearchStatusCancelled, model.SearchStatusNoDrivers:
+		return nil, ErrOfferUnavailable
+	}
+	return search, nil
+}
+
+// recordResponse counts the driver's answer towards their acceptance rate
+func (s *reservationService) recordResponse(ctx context.Context, driverID string, accepted bool) {
+	if err := s.driverStats.RecordResponse(ctx, driverID, accepted, time.Now()); err != nil {
+		log.Printf("Error recording response of driver %s: %v", driverID, err)
+	}
+}
+
+// publishEvent publishes an offer event for the search
+func (s *reservationService) publishEvent(eventType, driverID string, search *model.Search) {
+	if s.events == nil {
+		return
+	}
+
+	s.events.Publish(model.MatchEvent{
+		Type:     eventType,
+		City:     search.City,
+		SearchID: search.SearchID,
+		UserID:   search.UserID,
+		DriverID: driverID,
+	})
+}
+
+func (s *reservationService) notify(ctx context.Context, userID, status, driverID string) {
+	data, err := json.Marshal(map[string]interface{}{
+		"user_id":      userID,
+		"status":       status,
+		"driver_id":    driverID,
+		"request_time": time.Now().Unix(),
+	})
+	if err != nil {
+		log.Printf("Error marshaling %s update: %v", status, err)
+		return
+	}
+
+	if _, err := s.matchStream.Publish(ctx, userID, data); err != nil {
+		log.Printf("Error publishing %s update for user %s: %v", status, userID, err)
+	}
+}
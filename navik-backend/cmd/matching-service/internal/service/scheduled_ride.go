@@ -0,0 +1,371 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"matching-service/internal/model"
+	"matching-service/internal/repository"
+	"matching-service/internal/util"
+)
+
+var (
+	// ErrInvalidPickupTime is returned when a pickup is booked too soon or too far ahead
+	ErrInvalidPickupTime = errors.New("pickup time is outside the booking window")
+	// ErrInvalidScheduledRide is returned when a booking is missing its location
+	// or asks for a negative luggage capacity
+	ErrInvalidScheduledRide = errors.New("invalid scheduled ride")
+)
+
+// ScheduledRideConfig controls booking rules and dispatch timing
+type ScheduledRideConfig struct {
+	// MinAdvance and MaxAdvance bound how far ahead a pickup may be booked
+	MinAdvance time.Duration
+	MaxAdvance time.Duration
+	// Dispatch starts between MinLead and MaxLead before pickup: the scarcer
+	// the forecast supply, the earlier
+	MinLead    time.Duration
+	MaxLead    time.Duration
+	LowSupply  int
+	HighSupply int
+	// ReminderBefore is when the rider is reminded of the pickup
+	ReminderBefore time.Duration
+	// Cancelling later than FreeCancelBefore the pickup is a late cancellation
+	FreeCancelBefore time.Duration
+	PollInterval     time.Duration
+}
+
+// ScheduledRideService books and cancels rides in advance
+type ScheduledRideService interface {
+	BookRide(ctx context.Context, ride model.ScheduledRide) (*model.ScheduledRide, error)
+	ListRides(ctx context.Context, userID string) ([]model.ScheduledRide, error)
+	// CancelRide cancels a booking, and its search if it was already dispatched
+	CancelRide(ctx context.Context, userID, rideID, reason string) (*model.ScheduledRide, error)
+}
+
+type scheduledRideService struct {
+	rides         repository.ScheduledRideRepository
+	searchService SearchService
+	config        ScheduledRideConfig
+}
+
+// NewScheduledRideService creates a new scheduled ride service
+func NewScheduledRideService(rides repository.ScheduledRideRepository, searchService SearchService, config ScheduledRideConfig) ScheduledRideService {
+	return &scheduledRideService{
+		rides:         rides,
+		searchService: searchService,
+		config:        config,
+	}
+}
+
+// BookRide stores a ride and queues its dispatch planning and reminder
+func (s *scheduledRideService) BookRide(ctx context.Context, ride model.ScheduledRide) (*model.ScheduledRide, error) {
+	if ride.City == "" || ride.Latitude < -90 || ride.Latitude > 90 || ride.Longitude < -180 || ride.Longitude > 180 {
+		return nil, ErrInvalidScheduledRide
+	}
+	for _, constraints := range []*model.RideConstraints{ride.Requirements, ride.Preferences} {
+		if constraints != nil && constraints.MinLuggage < 0 {
+			return nil, ErrInvalidScheduledRide
+		}
+	}
+
+	now := time.Now()
+	pickupAt := time.Unix(ride.PickupAt, 0)
+	if pickupAt.Before(now.Add(s.config.MinAdvance)) || pickupAt.After(now.Add(s.config.MaxAdvance)) {
+		return nil, ErrInvalidPickupTime
+	}
+
+	ride.Status = model.ScheduledRideBooked
+	ride.CreatedAt = now.Unix()
+	if err := s.rides.Create(ctx, &ride); err != nil {
+		return nil, err
+	}
+
+	if err := s.rides.Schedule(ctx, repository.ScheduleQueuePlan, ride.RideID, pickupAt.Add(-s.config.MaxLead)); err != nil {
+		return nil, err
+	}
+	if remindAt := pickupAt.Add(-s.config.ReminderBefore); remindAt.After(now) {
+		if err := s.rides.Schedule(ctx, repository.ScheduleQueueRemind, ride.RideID, remindAt); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("Booked scheduled ride %s for user %s at %v", ride.RideID, ride.UserID, pickupAt)
+	return &ride, nil
+}
+
+// ListRides returns the user's scheduled rides
+func (s *scheduledRideService) ListRides(ctx context.Context, userID string) ([]model.ScheduledRide, error) {
+	return s.rides.ListForUser(ctx, userID)
+}
+
+// CancelRide cancels a booking. Cancelling after the free cancellation
+// cutoff is recorded as a late cancellation. The ride is marked cancelled
+// first, so a dispatch racing with the cancellation either sees it and
+// cancels its own search, or stored the search before and it is cancelled
+// here. Cancelling again retries the search cancellation.
+func (s *scheduledRideService) CancelRide(ctx context.Context, userID, rideID, reason string) (*model.ScheduledRide, error) {
+	ride, err := s.rides.Update(ctx, rideID, func(ride *model.ScheduledRide) error {
+		if ride.UserID != userID {
+			return repository.ErrScheduledRideNotFound
+		}
+		if ride.Status == model.ScheduledRideCancelled {
+			return nil
+		}
+
+		now := time.Now()
+		ride.Status = model.ScheduledRideCancelled
+		ride.CancelReason = reason
+		ride.CancelledAt = now.Unix()
+		ride.LateCancellation = now.After(time.Unix(ride.PickupAt, 0).Add(-s.config.FreeCancelBefore))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.rides.Unschedule(ctx, rideID); err != nil {
+		return nil, err
+	}
+
+	if ride.SearchID != "" {
+		if _, err := s.searchService.CancelSearch(ctx, userID, ride.SearchID, ride.CancelReason); err != nil &&
+			!errors.Is(err, repository.ErrSearchNotFound) {
+			return nil, fmt.Errorf("failed to cancel search of ride %s: %w", rideID, err)
+		}
+	}
+
+	log.Printf("Cancelled scheduled ride %s of user %s (late: %t): %s", rideID, userID, ride.LateCancellation, ride.CancelReason)
+	return ride, nil
+}
+
+// SupplyForecaster estimates how many drivers will be available around a
+// pickup at a given time
+type SupplyForecaster interface {
+	ForecastSupply(ctx context.Context, latitude, longitude float64, at time.Time) (int, error)
+}
+
+type currentSupplyForecaster struct {
+	repository repository.DriverRepository
+}
+
+// NewCurrentSupplyForecaster creates a forecaster that uses the drivers
+// currently active in and around the pickup's H8 cell as the forecast. It is
+// only consulted within the maximum lead time of the pickup, where current
+// supply is a reasonable estimate.
+func NewCurrentSupplyForecaster(repo repository.DriverRepository) SupplyForecaster {
+	return &currentSupplyForecaster{
+		repository: repo,
+	}
+}
+
+func (f *currentSupplyForecaster) ForecastSupply(ctx context.Context, latitude, longitude float64, at time.Time) (int, error) {
+	cells := util.GetH3KRing(util.GeoToH3Index(latitude, longitude, 8), 1)
+	drivers, err := f.repository.FindDriversInCells(ctx, 8, cells)
+	if err != nil {
+		return 0, err
+	}
+	return len(drivers), nil
+}
+
+// dispatchRetryDelay is how long a failed dispatch waits before it is retried
+const dispatchRetryDelay = 30 * time.Second
+
+// claimBatchSize is how many due rides one poll handles per queue
+const claimBatchSize = 100
+
+// claimLease is how long a claimed ride is held by one scheduler. A ride that
+// is not completed within it, because its handling failed or the scheduler
+// stopped, is claimed again.
+const claimLease = 2 * time.Minute
+
+// RideScheduler plans, dispatches and reminds scheduled rides
+type RideScheduler struct {
+	rides           repository.ScheduledRideRepository
+	locationService LocationService
+	searchService   SearchService
+	matchStream     repository.MatchStreamRepository
+	forecaster      SupplyForecaster
+	config          ScheduledRideConfig
+}
+
+// NewRideScheduler creates a ride scheduler
+func NewRideScheduler(rides repository.ScheduledRideRepository, locationService LocationService, searchService SearchService,
+	matchStream repository.MatchStreamRepository, forecaster SupplyForecaster, config ScheduledRideConfig) *RideScheduler {
+	return &RideScheduler{
+		rides:           rides,
+		locationService: locationService,
+		searchService:   searchService,
+		matchStream:     matchStream,
+		forecaster:      forecaster,
+		config:          config,
+	}
+}
+
+// Run polls the scheduler queues until the context is cancelled
+func (s *RideScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *RideScheduler) poll(ctx context.Context) {
+	s.process(ctx, repository.ScheduleQueueRemind, s.remind)
+	s.process(ctx, repository.ScheduleQueuePlan, s.plan)
+	s.process(ctx, repository.ScheduleQueueDispatch, s.dispatch)
+}
+
+// process claims the due rides of a queue and handles those still booked.
+// Handled rides, and rides that no longer need handling, are completed;
+// rides whose handling failed are claimed again once their lease ends.
+func (s *RideScheduler) process(ctx context.Context, queue string, handle func(ctx context.Context, ride *model.ScheduledRide) error) {
+	rideIDs, err := s.rides.ClaimDue(ctx, queue, time.Now(), claimBatchSize, claimLease)
+	if err != nil {
+		log.Printf("Error claiming rides from %s queue: %v", queue, err)
+		return
+	}
+
+	for _, rideID := range rideIDs {
+		ride, err := s.rides.Get(ctx, rideID)
+		if err != nil && !errors.Is(err, repository.ErrScheduledRideNotFound) {
+			log.Printf("Error loading scheduled ride %s: %v", rideID, err)
+			continue
+		}
+
+		if err == nil && ride.Status == model.ScheduledRideBooked {
+			if err := handle(ctx, ride); err != nil && !errors.Is(err, repository.ErrScheduledRideNotBooked) {
+				log.Printf("Error handling scheduled ride %s in %s queue: %v", rideID, queue, err)
+				continue
+			}
+		}
+
+		if err := s.rides.Complete(ctx, queue, rideID); err != nil {
+			log.Printf("Error completing scheduled ride %s: %v", rideID, err)
+		}
+	}
+}
+
+// plan chooses when to dispatch a ride from the forecast supply at pickup
+func (s *RideScheduler) plan(ctx context.Context, ride *model.ScheduledRide) error {
+	pickupAt := time.Unix(ride.PickupAt, 0)
+
+	lead := s.config.MaxLead
+	supply, err := s.forecaster.ForecastSupply(ctx, ride.Latitude, ride.Longitude, pickupAt)
+	if err != nil {
+		log.Printf("Error forecasting supply for ride %s, using maximum lead: %v", ride.RideID, err)
+	} else {
+		lead = s.leadTime(supply)
+	}
+
+	dispatchAt := pickupAt.Add(-lead)
+	_, err = s.rides.Update(ctx, ride.RideID, func(ride *model.ScheduledRide) error {
+		if ride.Status != model.ScheduledRideBooked {
+			return repository.ErrScheduledRideNotBooked
+		}
+		ride.DispatchAt = dispatchAt.Unix()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Scheduled ride %s will dispatch %v before pickup (forecast supply %d)", ride.RideID, lead, supply)
+	return s.rides.Schedule(ctx, repository.ScheduleQueueDispatch, ride.RideID, dispatchAt)
+}
+
+// leadTime interpolates between the maximum lead at low supply and the
+// minimum lead at high supply
+func (s *RideScheduler) leadTime(supply int) time.Duration {
+	if supply <= s.config.LowSupply {
+		return s.config.MaxLead
+	}
+	if supply >= s.config.HighSupply {
+		return s.config.MinLead
+	}
+
+	ratio := float64(supply-s.config.LowSupply) / float64(s.config.HighSupply-s.config.LowSupply)
+	return s.config.MaxLead - time.Duration(ratio*float64(s.config.MaxLead-s.config.MinLead))
+}
+
+// dispatch starts the ride's search through the regular matching pipeline
+func (s *RideScheduler) dispatch(ctx context.Context, ride *model.ScheduledRide) error {
+	loc := model.UserLocation{
+		UserID:      ride.UserID,
+		City:        ride.City,
+		Latitude:    ride.Latitude,
+		Longitude:   ride.Longitude,
+		Timestamp:   time.Now().Unix(),
+		RequestType: "SCHEDULED",
+		VehicleType: ride.VehicleType,
+
+		Requirements: ride.Requirements,
+		Preferences:  ride.Preferences,
+	}
+
+	// The ride ID as idempotency key keeps a retried dispatch on one search
+	search, err := s.locationService.UpdateLocation(ctx, loc, "scheduled:"+ride.RideID)
+	if err != nil {
+		if scheduleErr := s.rides.Schedule(ctx, repository.ScheduleQueueDispatch, ride.RideID, time.Now().Add(dispatchRetryDelay)); scheduleErr != nil {
+			log.Printf("Error rescheduling dispatch of ride %s: %v", ride.RideID, scheduleErr)
+		}
+		return err
+	}
+
+	// The rider may have cancelled while the search was being started, in
+	// which case the search is cancelled here as the cancellation missed it
+	var cancelReason string
+	_, err = s.rides.Update(ctx, ride.RideID, func(ride *model.ScheduledRide) error {
+		if ride.Status != model.ScheduledRideBooked {
+			cancelReason = ride.CancelReason
+			return repository.ErrScheduledRideNotBooked
+		}
+		ride.Status = model.ScheduledRideDispatched
+		ride.DispatchedAt = time.Now().Unix()
+		ride.SearchID = search.SearchID
+		return nil
+	})
+	if errors.Is(err, repository.ErrScheduledRideNotBooked) {
+		if _, err := s.searchService.CancelSearch(ctx, ride.UserID, search.SearchID, cancelReason); err != nil &&
+			!errors.Is(err, repository.ErrSearchNotFound) {
+			return fmt.Errorf("failed to cancel search of cancelled ride %s: %w", ride.RideID, err)
+		}
+		log.Printf("Cancelled search %s of scheduled ride %s cancelled during dispatch", search.SearchID, ride.RideID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Dispatched scheduled ride %s as search %s", ride.RideID, search.SearchID)
+	return nil
+}
+
+// remind tells the rider about the upcoming pickup
+func (s *RideScheduler) remind(ctx context.Context, ride *model.ScheduledRide) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"status":       "RIDE_REMINDER",
+		"user_id":      ride.UserID,
+		"ride_id":      ride.RideID,
+		"pickup_at":    ride.PickupAt,
+		"request_time": time.Now().Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal reminder: %w", err)
+	}
+
+	_, err = s.matchStream.Publish(ctx, ride.UserID, data)
+	return err
+}
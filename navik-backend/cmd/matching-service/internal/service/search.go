@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"matching-service/internal/model"
+	"matching-service/internal/repository"
+)
+
+// SearchService manages a rider's ride searches after they are started
+type SearchService interface {
+	// CancelSearch stops a search and withdraws the offers made for it.
+	// Cancelling an already cancelled search succeeds without side effects.
+	CancelSearch(ctx context.Context, userID, searchID, reason string) (*model.Search, error)
+	// GetTrace returns the recorded matching decisions of a search
+	GetTrace(ctx context.Context, searchID string) (*model.SearchTrace, error)
+	// RateDriver records the rider's 1-5 star rating of the driver who
+	// accepted their search. A search's driver can be rated once.
+	RateDriver(ctx context.Context, userID, searchID string, stars int) (*model.Search, error)
+}
+
+// ErrInvalidRating is returned for a rating outside 1 to 5 stars
+var ErrInvalidRating = errors.New("rating must be between 1 and 5 stars")
+
+type searchService struct {
+	searches     repository.SearchRepository
+	traces       repository.SearchTraceRepository
+	reservations repository.ReservationRepository
+	driverStats  repository.DriverStatsRepository
+	matchStream  repository.MatchStreamRepository
+	events       EventPublisher
+}
+
+// NewSearchService creates a new search service
+func NewSearchService(searches repository.SearchRepository, traces repository.SearchTraceRepository, reservations repository.ReservationRepository, driverStats repository.DriverStatsRepository, matchStream repository.MatchStreamRepository, events EventPublisher) SearchService {
+	return &searchService{
+		searches:     searches,
+		traces:       traces,
+		reservations: reservations,
+		driverStats:  driverStats,
+		matchStream:  matchStream,
+		events:       events,
+	}
+}
+
+// CancelSearch marks the search cancelled, releases the drivers it offered
+// and the driver who accepted it, and tells them and the rider
+func (s *searchService) CancelSearch(ctx context.Context, userID, searchID, reason string) (*model.Search, error) {
+	search, err := s.searches.Get(ctx, searchID)
+	if err != nil {
+		return nil, err
+	}
+	if search.UserID != userID {
+		return nil, repository.ErrSearchNotFound
+	}
+
+	search, err = s.searches.Cancel(ctx, searchID, reason)
+	if errors.Is(err, repository.ErrSearchCancelled) {
+		return s.searches.Get(ctx, searchID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Search %s of user %s cancelled %ds after it started (results delivered: %t): %s",
+		searchID, userID, search.CancelledAt-search.CreatedAt, search.CompletedAt != 0, reason)
+
+	err = s.traces.Update(ctx, searchID, func(trace *model.SearchTrace) {
+		trace.Outcome = model.SearchStatusCancelled
+	})
+	if err != nil {
+		log.Printf("Error recording cancellation on trace of search %s: %v", searchID, err)
+	}
+
+	// Offers are leased to the search, so only this search's offers are
+	// withdrawn
+	released, err := s.reservations.ReleaseAll(ctx, searchID, "")
+	if err != nil {
+		log.Printf("Error releasing offers of cancelled search %s: %v", searchID, err)
+	}
+
+	for _, driverID := range released {
+		s.notify(ctx, driverID, map[string]interface{}{
+			"status":    "OFFER_CANCELLED",
+			"user_id":   userID,
+			"search_id": searchID,
+			"reason":    reason,
+		})
+	}
+
+	// The driver who accepted holds an assignment rather than an offer, which
+	// ReleaseAll leaves alone
+	if search.DriverID != "" {
+		if _, err := s.reservations.Release(ctx, search.DriverID, searchID); err != nil {
+			log.Printf("Error releasing driver %s of cancelled search %s: %v", search.DriverID, searchID, err)
+		}
+		s.notify(ctx, search.DriverID, map[string]interface{}{
+			"status":    "SEARCH_CANCELLED",
+			"user_id":   userID,
+			"search_id": searchID,
+			"reason":    reason,
+		})
+	}
+
+	if s.events != nil {
+		s.events.Publish(model.MatchEvent{
+			Type:     model.EventSearchCancelled,
+			City:     search.City,
+			SearchID: searchID,
+			UserID:   userID,
+			Status:   model.SearchStatusCancelled,
+			Reason:   reason,
+		})
+	}
+
+	s.notify(ctx, userID, map[string]interface{}{
+		"status":    model.SearchStatusCancelled,
+		"user_id":   userID,
+		"search_id": searchID,
+		"reason":    reason,
+	})
+
+	return search, nil
+}
+
+// GetTrace returns the trace of a search
+func (s *searchService) GetTrace(ctx context.Context, searchID string) (*model.SearchTrace, error) {
+	return s.traces.Get(ctx, searchID)
+}
+
+// RateDriver marks the search rated, then adds the rating to the driver's
+// stats, so that a repeated request cannot count twice. If the stats cannot
+// be updated the search is marked unrated again for the rider to retry.
+func (s *searchService) RateDriver(ctx context.Context, userID, searchID string, stars int) (*model.Search, error) {
+	if stars < 1 || stars > 5 {
+		return nil, ErrInvalidRating
+	}
+
+	search, err := s.searches.Get(ctx, searchID)
+	if err != nil {
+		return nil, err
+	}
+	if search.UserID != userID {
+		return nil, repository.ErrSearchNotFound
+	}
+
+	search, err = s.searches.Rate(ctx, searchID, stars)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.driverStats.RecordRating(ctx, search.DriverID, stars); err != nil {
+		if unrateErr := s.searches.Unrate(ctx, searchID); unrateErr != nil {
+			log.Printf("Error clearing unrecorded rating of search %s: %v", searchID, unrateErr)
+		}
+		return nil, err
+	}
+
+	log.Printf("User %s rated driver %s of search %s %d stars", userID, search.DriverID, searchID, stars)
+	return search, nil
+}
+
+// notify publishes an update on a user's or driver's match stream
+func (s *searchService) notify(ctx context.Context, recipientID string, update map[string]interface{}) {
+	update["request_time"] = time.Now().Unix()
+
+	data, err := json.Marshal(update)
+	if err != nil {
+		log.Printf("Error marshaling %s update: %v", update["status"], err)
+		return
+	}
+
+	if _, err := s.matchStream.Publish(ctx, recipientID, data); err != nil {
+		log.Printf("Error publishing %s update to %s: %v", update["status"], recipientID, err)
+	}
+}
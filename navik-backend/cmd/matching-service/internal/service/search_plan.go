@@ -0,0 +1,118 @@
+package service
+
+import (
+	"time"
+)
+
+// SearchStep is one step of an expanding-ring driver search
+type SearchStep struct {
+	// Resolution is the H3 resolution of the cells queried in this step
+	Resolution int
+	// KRing is the ring radius around the rider's cell; 0 queries only that cell
+	KRing int
+	// MinResults stops the search after this step once this many drivers were
+	// found; 0 uses the service's minimum number of drivers to return
+	MinResults int
+	// TimeBudget bounds the step's queries; 0 means no limit beyond the request
+	TimeBudget time.Duration
+}
+
+// SearchPlan is an ordered list of steps run until enough drivers are found
+type SearchPlan struct {
+	Name  string
+	Steps []SearchStep
+}
+
+// SearchPlanWindow applies a plan during an hour range in the plan location's
+// local time. EndHour is exclusive and may wrap past midnight.
+type SearchPlanWindow struct {
+	Plan      string
+	StartHour int
+	EndHour   int
+}
+
+// SearchPlanConfig selects a search plan per city and time of day
+type SearchPlanConfig struct {
+	DefaultPlan string
+	Plans       map[string][]SearchStep
+	// CityPlans lists time windows per city; the first matching window wins and
+	// the city falls back to DefaultPlan outside all of them
+	CityPlans map[string][]SearchPlanWindow
+	Location  *time.Location
+}
+
+// DefaultSearchPlan reproduces the original fixed search: the rider's H9
+// cell, its H9 ring, then the H8 cell, the H8 ring and finally the H7 cell
+var DefaultSearchPlan = []SearchStep{
+	{Resolution: 9, KRing: 0},
+	{Resolution: 9, KRing: 1},
+	{Resolution: 8, KRing: 0},
+	{Resolution: 8, KRing: 1},
+	{Resolution: 7, KRing: 0},
+}
+
+// searchPlans selects the search plan for a city at a given time
+type searchPlans struct {
+	plans       map[string]SearchPlan
+	defaultPlan SearchPlan
+	cityPlans   map[string][]SearchPlanWindow
+	location    *time.Location
+}
+
+func newSearchPlans(config SearchPlanConfig) *searchPlans {
+	plans := map[string]SearchPlan{
+		"default": {Name: "default", Steps: DefaultSearchPlan},
+	}
+	for name, steps := range config.Plans {
+		plans[name] = SearchPlan{Name: name, Steps: steps}
+	}
+
+	defaultPlan, ok := plans[config.DefaultPlan]
+	if !ok {
+		defaultPlan = plans["default"]
+	}
+
+	location := config.Location
+	if location == nil {
+		location = time.Local
+	}
+
+	return &searchPlans{
+		plans:       plans,
+		defaultPlan: defaultPlan,
+		cityPlans:   config.CityPlans,
+		location:    location,
+	}
+}
+
+func (p *searchPlans) forCity(city string, now time.Time) SearchPlan {
+	hour := now.In(p.location).Hour()
+
+	for _, window := range p.cityPlans[city] {
+		if !window.covers(hour) {
+			continue
+		}
+		if plan, ok := p.plans[window.Plan]; ok {
+			return plan
+		}
+	}
+
+	return p.defaultPlan
+}
+
+func (w SearchPlanWindow) covers(hour int) bool {
+	// A window with equal start and end covers the whole day
+	if w.StartHour == w.EndHour {
+		return true
+	}
+	if w.StartHour < w.EndHour {
+		return hour >= w.StartHour && hour < w.EndHour
+	}
+	return hour >= w.StartHour || hour < w.EndHour
+}
+
+// named returns a plan by name, e.g. for an experiment arm
+func (p *searchPlans) named(name string) (SearchPlan, bool) {
+	plan, ok := p.plans[name]
+	return plan, ok
+}
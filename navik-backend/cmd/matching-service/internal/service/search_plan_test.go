@@ -0,0 +1,115 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSearchPlanWindowCovers(t *testing.T) {
+	tests := []struct {
+		name   string
+		window SearchPlanWindow
+		hour   int
+		want   bool
+	}{
+		{name: "before daytime window", window: SearchPlanWindow{StartHour: 8, EndHour: 20}, hour: 7, want: false},
+		{name: "start of daytime window", window: SearchPlanWindow{StartHour: 8, EndHour: 20}, hour: 8, want: true},
+		{name: "end of daytime window", window: SearchPlanWindow{StartHour: 8, EndHour: 20}, hour: 19, want: true},
+		{name: "end hour is exclusive", window: SearchPlanWindow{StartHour: 8, EndHour: 20}, hour: 20, want: false},
+		{name: "window to midnight", window: SearchPlanWindow{StartHour: 20, EndHour: 24}, hour: 23, want: true},
+		{name: "night window before midnight", window: SearchPlanWindow{StartHour: 22, EndHour: 6}, hour: 23, want: true},
+		{name: "night window after midnight", window: SearchPlanWindow{StartHour: 22, EndHour: 6}, hour: 0, want: true},
+		{name: "night window end", window: SearchPlanWindow{StartHour: 22, EndHour: 6}, hour: 6, want: false},
+		{name: "outside night window", window: SearchPlanWindow{StartHour: 22, EndHour: 6}, hour: 12, want: false},
+		{name: "whole day", window: SearchPlanWindow{StartHour: 5, EndHour: 5}, hour: 3, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.window.covers(tt.hour); got != tt.want {
+				t.Errorf("%d-%d covers(%d) = %t, want %t",
+					tt.window.StartHour, tt.window.EndHour, tt.hour, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchPlansForCity(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+	wide := []SearchStep{{Resolution: 8, KRing: 2}}
+	narrow := []SearchStep{{Resolution: 9, KRing: 0}, {Resolution: 9, KRing: 1}}
+
+	plans := newSearchPlans(SearchPlanConfig{
+		DefaultPlan: "narrow",
+		Plans:       map[string][]SearchStep{"wide": wide, "narrow": narrow},
+		CityPlans: map[string][]SearchPlanWindow{
+			"pune": {
+				{Plan: "wide", StartHour: 22, EndHour: 6},
+				{Plan: "default", StartHour: 8, EndHour: 11},
+			},
+			"delhi": {
+				{Plan: "missing", StartHour: 0, EndHour: 0},
+				{Plan: "wide", StartHour: 0, EndHour: 0},
+			},
+		},
+		Location: kolkata,
+	})
+
+	// at returns the instant of an hour in Kolkata, given in UTC
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 3, 1, hour, minute, 0, 0, kolkata).UTC()
+	}
+
+	tests := []struct {
+		name string
+		city string
+		now  time.Time
+		want string
+	}{
+		{name: "city without windows", city: "mumbai", now: at(23, 0), want: "narrow"},
+		{name: "night window", city: "pune", now: at(23, 0), want: "wide"},
+		{name: "night window after midnight", city: "pune", now: at(5, 59), want: "wide"},
+		{name: "second window", city: "pune", now: at(9, 30), want: "default"},
+		{name: "outside windows", city: "pune", now: at(14, 0), want: "narrow"},
+		{name: "hour in plan timezone", city: "pune", now: at(22, 30), want: "wide"},
+		{name: "unknown plan skipped", city: "delhi", now: at(12, 0), want: "wide"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := plans.forCity(tt.city, tt.now).Name; got != tt.want {
+				t.Errorf("forCity(%s, %s) = %s, want %s", tt.city, tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchPlansDefault(t *testing.T) {
+	tests := []struct {
+		name        string
+		defaultPlan string
+		want        string
+		wantSteps   int
+	}{
+		{name: "built in", defaultPlan: "default", want: "default", wantSteps: len(DefaultSearchPlan)},
+		{name: "configured", defaultPlan: "wide", want: "wide", wantSteps: 1},
+		{name: "unknown falls back to built in", defaultPlan: "missing", want: "default", wantSteps: len(DefaultSearchPlan)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plans := newSearchPlans(SearchPlanConfig{
+				DefaultPlan: tt.defaultPlan,
+				Plans:       map[string][]SearchStep{"wide": {{Resolution: 8, KRing: 2}}},
+				Location:    time.UTC,
+			})
+			plan := plans.forCity("mumbai", time.Now())
+			if plan.Name != tt.want || len(plan.Steps) != tt.wantSteps {
+				t.Errorf("default plan = %s with %d steps, want %s with %d", plan.Name, len(plan.Steps), tt.want, tt.wantSteps)
+			}
+		})
+	}
+}
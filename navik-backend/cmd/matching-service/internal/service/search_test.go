@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+
+	"matching-service/internal/model"
+	"matching-service/internal/repository"
+)
+
+// stubDriverStats fails to record ratings while fail is set
+type stubDriverStats struct {
+	fail    bool
+	ratings []int
+}
+
+func (f *stubDriverStats) RecordResponse(ctx context.Context, driverID string, accepted bool, at time.Time) error {
+	return nil
+}
+
+func (f *stubDriverStats) RecordRating(ctx context.Context, driverID string, stars int) error {
+	if f.fail {
+		return errors.New("stats unavailable")
+	}
+	f.ratings = append(f.ratings, stars)
+	return nil
+}
+
+func (f *stubDriverStats) Get(ctx context.Context, driverIDs []string) (map[string]model.DriverStats, error) {
+	return nil, nil
+}
+
+func TestRateDriverRetriesUnrecordedRating(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	searches := repository.NewSearchRepository(client, time.Hour)
+	stats := &stubDriverStats{fail: true}
+	searchService := NewSearchService(searches, nil, nil, stats, nil, nil)
+
+	search, _, err := searches.Create(ctx, "u1", "pune", "")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := searches.Assign(ctx, search.SearchID, "d1"); err != nil {
+		t.Fatalf("Assign: %v", err)
+	}
+
+	if _, err := searchService.RateDriver(ctx, "u1", search.SearchID, 4); err == nil {
+		t.Fatalf("RateDriver succeeded while stats were unavailable")
+	}
+
+	stats.fail = false
+	rated, err := searchService.RateDriver(ctx, "u1", search.SearchID, 4)
+	if err != nil {
+		t.Fatalf("retried RateDriver: %v", err)
+	}
+	if rated.DriverRating != 4 || len(stats.ratings) != 1 {
+		t.Errorf("rating = %d with %d recorded, want 4 with 1 recorded", rated.DriverRating, len(stats.ratings))
+	}
+
+	if _, err := searchService.RateDriver(ctx, "u1", search.SearchID, 5); !errors.Is(err, repository.ErrSearchRated) {
+		t.Errorf("second RateDriver error = %v, want %v", err, repository.ErrSearchRated)
+	}
+}
+
+func TestCancelSearchReleasesAssignedDriver(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	searches := repository.NewSearchRepository(client, time.Hour)
+	reservations := repository.NewReservationRepository(client)
+	matchStream := repository.NewMatchStreamRepository(client, 100, time.Hour)
+	searchService := NewSearchService(searches, repository.NewSearchTraceRepository(client, time.Hour),
+		reservations, &stubDriverStats{}, matchStream, nil)
+
+	search, _, err := searches.Create(ctx, "u1", "pune", "")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := reservations.SoftReserve(ctx, "d1", search.SearchID, time.Minute); err != nil {
+		t.Fatalf("SoftReserve: %v", err)
+	}
+	if err := reservations.HardReserve(ctx, "d1", search.SearchID, time.Hour); err != nil {
+		t.Fatalf("HardReserve: %v", err)
+	}
+	if err := searches.Assign(ctx, search.SearchID, "d1"); err != nil {
+		t.Fatalf("Assign: %v", err)
+	}
+
+	if _, err := searchService.CancelSearch(ctx, "u1", search.SearchID, "rider"); err != nil {
+		t.Fatalf("CancelSearch: %v", err)
+	}
+
+	reserved, err := reservations.ReservedByOthers(ctx, []string{"d1"}, "another-search")
+	if err != nil {
+		t.Fatalf("ReservedByOthers: %v", err)
+	}
+	if reserved["d1"] {
+		t.Errorf("assigned driver still reserved after the search was cancelled")
+	}
+
+	latest, err := matchStream.Latest(ctx, "d1")
+	if err != nil || latest == nil {
+		t.Fatalf("driver got no update: %v", err)
+	}
+	var update struct {
+		Status   string `json:"status"`
+		SearchID string `json:"search_id"`
+	}
+	if err := json.Unmarshal(latest.Data, &update); err != nil {
+		t.Fatalf("parse update: %v", err)
+	}
+	if update.Status != "SEARCH_CANCELLED" || update.SearchID != search.SearchID {
+		t.Errorf("driver update = %s, want SEARCH_CANCELLED for %s", latest.Data, search.SearchID)
+	}
+}
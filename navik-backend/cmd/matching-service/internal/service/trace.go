@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"matching-service/internal/model"
+)
+
+// recordTrace applies a change to the trace of the user's search. Tracing is
+// best effort and never fails the match.
+func (s *matchingService) recordTrace(ctx context.Context, user model.EnrichedUserLocation, change func(trace *model.SearchTrace)) {
+	if user.SearchID == "" || s.traces == nil {
+		return
+	}
+
+	err := s.traces.Update(ctx, user.SearchID, func(trace *model.SearchTrace) {
+		trace.UserID = user.UserID
+		trace.City = user.City
+		trace.Latitude = user.Latitude
+		trace.Longitude = user.Longitude
+		trace.VehicleType = user.VehicleType
+		if experiment, arm, ok := s.experimentFor(user); ok {
+			trace.Experiment, trace.Arm = experiment, arm.Name
+		}
+		change(trace)
+	})
+	if err != nil {
+		log.Printf("Error recording trace of search %s: %v", user.SearchID, err)
+	}
+}
+
+// recordOutcome records the latest status of the user's search on its trace
+func (s *matchingService) recordOutcome(ctx context.Context, user model.EnrichedUserLocation, outcome string) {
+	s.recordTrace(ctx, user, func(trace *model.SearchTrace) {
+		trace.Outcome = outcome
+	})
+}
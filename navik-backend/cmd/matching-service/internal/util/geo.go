@@ -0,0 +1,25 @@
+package util
+
+import "math"
+
+const earthRadiusKm = 6371.0
+
+// AverageCitySpeedKmh is the speed used to turn a straight-line distance into
+// an ETA until a routing service is wired in
+const AverageCitySpeedKmh = 20.0
+
+// HaversineKm returns the great-circle distance between two points in kilometres
+func HaversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLng := (lng2 - lng1) * math.Pi / 180
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return earthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// EstimateETAMinutes estimates the travel time for a distance in kilometres
+func EstimateETAMinutes(distanceKm float64) float64 {
+	return distanceKm / AverageCitySpeedKmh * 60
+}
@@ -14,6 +14,12 @@ func GeoToH3Index(lat, lng float64, resolution int) string {
 	return h3.ToString(h3Index)
 }
 
+// H3ToGeo returns the center of an H3 cell
+func H3ToGeo(h3Index string) (float64, float64) {
+	center := h3.ToGeo(h3.FromString(h3Index))
+	return center.Latitude, center.Longitude
+}
+
 // GetH3Neighbors returns the neighboring H3 cells for a given H3 index
 func GetH3Neighbors(h3Index string) []string {
 	// Convert string index to H3 index
@@ -34,6 +40,18 @@ func GetH3Neighbors(h3Index string) []string {
 	return neighborStrings
 }
 
+// GetH3KRing returns every H3 cell within k steps of the given cell, including the cell itself
+func GetH3KRing(h3Index string, k int) []string {
+	cells := h3.KRing(h3.FromString(h3Index), k)
+
+	cellStrings := make([]string, len(cells))
+	for i, cell := range cells {
+		cellStrings[i] = h3.ToString(cell)
+	}
+
+	return cellStrings
+}
+
 // SafePrefix returns a safe prefix of the string
 func SafePrefix(s string, length int) string {
 	if len(s) < length {
@@ -0,0 +1,85 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// TailConsumer reads every partition of a set of topics from the newest
+// offset without joining a consumer group, so that each instance sees all
+// messages
+type TailConsumer struct {
+	consumer sarama.Consumer
+	topics   []string
+}
+
+func NewTailConsumer(brokers []string, topics []string) (*TailConsumer, error) {
+	config := sarama.NewConfig()
+	config.Consumer.Return.Errors = true
+	config.Net.DialTimeout = 10 * time.Second
+	config.Version = sarama.V2_8_0_0
+
+	consumer, err := sarama.NewConsumer(brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer: %w", err)
+	}
+
+	log.Printf("Tail consumer connected to brokers: %v", brokers)
+	return &TailConsumer{
+		consumer: consumer,
+		topics:   topics,
+	}, nil
+}
+
+func (c *TailConsumer) Close() error {
+	return c.consumer.Close()
+}
+
+// Start begins consuming every partition of the topics and calls handle for
+// each message until the context is cancelled. Partition consumers are open
+// when Start returns, so no message published afterwards is missed.
+func (c *TailConsumer) Start(ctx context.Context, handle func(msg *sarama.ConsumerMessage)) error {
+
+	for _, topic := range c.topics {
+		partitions, err := c.consumer.Partitions(topic)
+		if err != nil {
+			return fmt.Errorf("failed to list partitions of %s: %w", topic, err)
+		}
+
+		for _, partition := range partitions {
+			pc, err := c.consumer.ConsumePartition(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return fmt.Errorf("failed to consume %s/%d: %w", topic, partition, err)
+			}
+
+			go func(pc sarama.PartitionConsumer) {
+				defer pc.AsyncClose()
+
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case msg, ok := <-pc.Messages():
+						if !ok {
+							return
+						}
+						handle(msg)
+					case err, ok := <-pc.Errors():
+						if !ok {
+							return
+						}
+						log.Printf("Tail consumer error: %v", err)
+					}
+				}
+			}(pc)
+		}
+
+		log.Printf("Tailing topic %s (%d partitions)", topic, len(partitions))
+	}
+
+	return nil
+}
@@ -5,10 +5,26 @@ import aiohttp
 from datetime import datetime
 
 
+async def login(session, email, password):
+    login_url = "http://172.31.115.2/api/auth/login"
+    async with session.post(login_url, json={"email": email, "password": password}) as resp:
+        if resp.status != 200:
+            print(f"❌ Login failed: {resp.status}")
+            return None
+        data = await resp.json()
+        return data["access_token"], data["user_id"]
+
+
 async def test_websocket_flow():
-    user_id = "customer-rajesh876@example.com"
-    ws_url = f"ws://172.31.115.2/ws?user_id={user_id}"
+    email = "customer-rajesh876@example.com"
+    ws_url = "ws://172.31.115.2/ws"
     api_url = "http://172.31.115.2/api/matching"
+
+    async with aiohttp.ClientSession() as session:
+        creds = await login(session, email, "SecurePass123!")
+    if creds is None:
+        return
+    access_token, user_id = creds
     
     test_location = {
         "user_id": user_id,
@@ -18,9 +34,10 @@ async def test_websocket_flow():
         "request_type": "RIDE_REQUEST"
     }
 
-    async with connect(ws_url) as websocket:
+    headers = {"Authorization": f"Bearer {access_token}"}
+    async with connect(ws_url, extra_headers=headers) as websocket:
         async with aiohttp.ClientSession() as session:
-            async with session.post(api_url, json=test_location) as resp:
+            async with session.post(api_url, json=test_location, headers=headers) as resp:
                 if resp.status != 200:
                     print(resp.text)
                     print(f"❌ HTTP POST failed: {resp.status}")
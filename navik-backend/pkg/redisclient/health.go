@@ -0,0 +1,61 @@
+package redisclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// StatusUp is reported when Redis answers a ping
+	StatusUp = "up"
+	// StatusDown is reported when it does not
+	StatusDown = "down"
+)
+
+// Health reports whether Redis is reachable and how the connection pool is used
+type Health struct {
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	LatencyMs int64      `json:"latency_ms"`
+	Pool      PoolHealth `json:"pool"`
+}
+
+// PoolHealth are the connection pool counters, summed over every node
+type PoolHealth struct {
+	Hits       uint32 `json:"hits"`
+	Misses     uint32 `json:"misses"`
+	Timeouts   uint32 `json:"timeouts"`
+	TotalConns uint32 `json:"total_conns"`
+	IdleConns  uint32 `json:"idle_conns"`
+	StaleConns uint32 `json:"stale_conns"`
+}
+
+// Check pings Redis and reports the client's health
+func Check(ctx context.Context, client redis.UniversalClient) Health {
+	start := time.Now()
+	err := client.Ping(ctx).Err()
+
+	health := Health{
+		Status:    StatusUp,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		health.Status = StatusDown
+		health.Error = err.Error()
+	}
+
+	if stats := client.PoolStats(); stats != nil {
+		health.Pool = PoolHealth{
+			Hits:       stats.Hits,
+			Misses:     stats.Misses,
+			Timeouts:   stats.Timeouts,
+			TotalConns: stats.TotalConns,
+			IdleConns:  stats.IdleConns,
+			StaleConns: stats.StaleConns,
+		}
+	}
+
+	return health
+}
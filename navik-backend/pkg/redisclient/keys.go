@@ -0,0 +1,28 @@
+package redisclient
+
+import "strings"
+
+// UserKey returns the key of a user's data: "user:{<id>}", followed by any
+// parts, so UserKey("42", "stream") is "user:{42}:stream". The braces are a
+// cluster hash tag that keeps all of a user's keys in one slot, so scripts
+// can update several of them at once.
+func UserKey(userID string, parts ...string) string {
+	return strings.Join(append([]string{"user", "{" + userID + "}"}, parts...), ":")
+}
+
+// UserChannel returns the user's pub/sub channel, "user:<id>"
+func UserChannel(userID string) string {
+	return "user:" + userID
+}
+
+// BlacklistKey returns the key that marks an access token as revoked. The
+// authentication service writes it on logout and every service that validates
+// tokens checks it.
+func BlacklistKey(tokenID string) string {
+	return "blacklist:" + tokenID
+}
+
+// AccessTokenKey returns the key caching a valid access token of a user
+func AccessTokenKey(userID, tokenID string) string {
+	return "access_token:" + userID + ":" + tokenID
+}
@@ -0,0 +1,231 @@
+// Package redisclient creates Redis clients from service configuration.
+//
+// Every service that shares the Redis deployment imports this module, so that
+// connection settings and key names mean the same in all of them.
+package redisclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// ModeStandalone connects to a single Redis server
+	ModeStandalone = "standalone"
+	// ModeSentinel connects to the master of a Sentinel-monitored deployment
+	// and follows failovers
+	ModeSentinel = "sentinel"
+	// ModeCluster connects to a Redis Cluster
+	ModeCluster = "cluster"
+)
+
+// maxConnectBackoff caps the delay between startup connection attempts
+const maxConnectBackoff = 30 * time.Second
+
+// Config describes how to reach Redis
+type Config struct {
+	// Mode is standalone, sentinel or cluster
+	Mode string `json:"mode"`
+	// Addrs is the server address in standalone mode, the Sentinel addresses
+	// in sentinel mode and the seed nodes in cluster mode
+	Addrs []string `json:"addrs"`
+	// MasterName is the Sentinel master to connect to
+	MasterName       string    `json:"master_name"`
+	Username         string    `json:"username"`
+	Password         string    `json:"password"`
+	SentinelPassword string    `json:"sentinel_password"`
+	DB               int       `json:"db"`
+	TLS              TLSConfig `json:"tls"`
+
+	// PoolSize is the maximum number of connections per node, 0 for the
+	// client default of ten per CPU
+	PoolSize       int `json:"pool_size"`
+	MinIdleConns   int `json:"min_idle_conns"`
+	DialTimeoutMs  int `json:"dial_timeout_ms"`
+	ReadTimeoutMs  int `json:"read_timeout_ms"`
+	WriteTimeoutMs int `json:"write_timeout_ms"`
+
+	// ConnectAttempts is how many times New pings Redis before giving up,
+	// backing off from ConnectBackoffMs
+	ConnectAttempts  int `json:"connect_attempts"`
+	ConnectBackoffMs int `json:"connect_backoff_ms"`
+}
+
+// TLSConfig enables TLS to Redis
+type TLSConfig struct {
+	Enabled bool `json:"enabled"`
+	// ServerName overrides the name verified in the server certificate
+	ServerName string `json:"server_name"`
+	// CAFile is a PEM bundle trusted in addition to the system roots
+	CAFile             string `json:"ca_file"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+// SetDefaults fills in the settings that are not configured
+func (c *Config) SetDefaults() {
+	if c.Mode == "" {
+		c.Mode = ModeStandalone
+	}
+
+	if len(c.Addrs) == 0 {
+		c.Addrs = []string{"redis:6379"}
+	}
+
+	if c.DialTimeoutMs == 0 {
+		c.DialTimeoutMs = 5000
+	}
+
+	if c.ReadTimeoutMs == 0 {
+		c.ReadTimeoutMs = 3000
+	}
+
+	if c.WriteTimeoutMs == 0 {
+		c.WriteTimeoutMs = 3000
+	}
+
+	if c.ConnectAttempts == 0 {
+		c.ConnectAttempts = 10
+	}
+
+	if c.ConnectBackoffMs == 0 {
+		c.ConnectBackoffMs = 500
+	}
+}
+
+// Validate reports settings that cannot work together
+func (c Config) Validate() error {
+	switch c.Mode {
+	case ModeStandalone:
+		if len(c.Addrs) != 1 {
+			return fmt.Errorf("standalone mode needs exactly one address, got %d", len(c.Addrs))
+		}
+	case ModeSentinel:
+		if c.MasterName == "" {
+			return errors.New("sentinel mode needs a master name")
+		}
+	case ModeCluster:
+		if c.DB != 0 {
+			return fmt.Errorf("cluster mode only has database 0, got %d", c.DB)
+		}
+	default:
+		return fmt.Errorf("invalid mode %q: must be standalone, sentinel or cluster", c.Mode)
+	}
+
+	if len(c.Addrs) == 0 {
+		return errors.New("no addresses configured")
+	}
+
+	if c.PoolSize < 0 || c.MinIdleConns < 0 || c.ConnectAttempts < 0 {
+		return errors.New("pool sizes and connect attempts must not be negative")
+	}
+
+	return nil
+}
+
+// New creates a client for the configured topology and waits for Redis to
+// answer, so that services started alongside Redis do not fail on their first
+// commands
+func New(ctx context.Context, cfg Config) (redis.UniversalClient, error) {
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	backoff := time.Duration(cfg.ConnectBackoffMs) * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, time.Duration(cfg.DialTimeoutMs)*time.Millisecond)
+		err = client.Ping(pingCtx).Err()
+		cancel()
+		if err == nil {
+			log.Printf("Connected to Redis (%s) at %s", cfg.Mode, strings.Join(cfg.Addrs, ","))
+			return client, nil
+		}
+
+		if attempt >= cfg.ConnectAttempts {
+			client.Close()
+			return nil, fmt.Errorf("redis not reachable after %d attempts: %w", attempt, err)
+		}
+
+		log.Printf("Redis not ready (attempt %d/%d): %v, retrying in %v", attempt, cfg.ConnectAttempts, err, backoff)
+		select {
+		case <-ctx.Done():
+			client.Close()
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
+	}
+}
+
+func newClient(cfg Config) (redis.UniversalClient, error) {
+	tlsConfig, err := cfg.TLS.build()
+	if err != nil {
+		return nil, err
+	}
+
+	options := &redis.UniversalOptions{
+		Addrs:            cfg.Addrs,
+		MasterName:       cfg.MasterName,
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		SentinelPassword: cfg.SentinelPassword,
+		DB:               cfg.DB,
+		TLSConfig:        tlsConfig,
+		PoolSize:         cfg.PoolSize,
+		MinIdleConns:     cfg.MinIdleConns,
+		DialTimeout:      time.Duration(cfg.DialTimeoutMs) * time.Millisecond,
+		ReadTimeout:      time.Duration(cfg.ReadTimeoutMs) * time.Millisecond,
+		WriteTimeout:     time.Duration(cfg.WriteTimeoutMs) * time.Millisecond,
+	}
+
+	switch cfg.Mode {
+	case ModeSentinel:
+		return redis.NewFailoverClient(options.Failover()), nil
+	case ModeCluster:
+		return redis.NewClusterClient(options.Cluster()), nil
+	default:
+		return redis.NewClient(options.Simple()), nil
+	}
+}
+
+func (c TLSConfig) build() (*tls.Config, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in redis CA file %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
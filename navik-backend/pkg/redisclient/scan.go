@@ -0,0 +1,41 @@
+package redisclient
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// scanCount is how many keys each SCAN call asks for
+const scanCount = 100
+
+// Scan calls fn with the keys matching pattern, a batch at a time. In cluster
+// mode each master holds only its own slots, so every master is scanned and
+// fn may be called concurrently.
+func Scan(ctx context.Context, client redis.UniversalClient, pattern string, fn func(keys []string) error) error {
+	if cluster, ok := client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+			return scanNode(ctx, master, pattern, fn)
+		})
+	}
+	return scanNode(ctx, client, pattern, fn)
+}
+
+func scanNode(ctx context.Context, client redis.Cmdable, pattern string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(ctx, cursor, pattern, scanCount).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}